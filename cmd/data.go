@@ -0,0 +1,160 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/cmd/data"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+func init() {
+
+	c := new(cobra.Command)
+	c.Use = "data"
+	c.Short = "Manages the historic rates that simulations and optimizations run on."
+	c.Long = util.Banner
+
+	var from, to string
+	var granularity int
+
+	backfill := new(cobra.Command)
+	backfill.Use = "backfill"
+	backfill.Short = "Fetches every missing rate of a time frame and reports the coverage of each product."
+	backfill.Long = util.Banner
+	backfill.Example = `
+	# Fetches every minute rate of June 2021 the database is missing, for the configured products.
+	nuchal data backfill --from 2021-06-01 --to 2021-07-01
+
+	# Fetches every 5 minute rate since June 24th for XLM and ALGO.
+	nuchal data backfill --usd XLM,ALGO --from 2021-06-24T00:00:00Z --granularity 300`
+	backfill.Args = cobra.NoArgs
+	backfill.Run = func(cmd *cobra.Command, args []string) {
+
+		session, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug)
+		if err != nil {
+			panic(err)
+		}
+
+		alpha, omega, err := timeFrame(session, from, to)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := data.NewBackfill(session, alpha, omega, granularity); err != nil {
+			panic(err)
+		}
+	}
+
+	backfill.Flags().StringVar(&from, "from", "", "start of the time frame, RFC3339 or yyyy-mm-dd, defaults to the period alpha")
+	backfill.Flags().StringVar(&to, "to", "", "end of the time frame, RFC3339 or yyyy-mm-dd, defaults to now with --from, else the period omega")
+	backfill.Flags().IntVar(&granularity, "granularity", cbp.Minute, fmt.Sprintf("seconds of each rate, one of %v", cbp.Granularities))
+
+	var format string
+
+	imp := new(cobra.Command)
+	imp.Use = "import [file]"
+	imp.Short = "Stores the rates of a csv or jsonl file, skipping those already stored."
+	imp.Long = util.Banner
+	imp.Example = `
+	# Stores the minute rates of a csv file with a unix,product_id,open,high,low,close,volume header.
+	nuchal data import rates.csv
+
+	# Stores the 5 minute rates of a file with one json rate per line.
+	nuchal data import rates.txt --format jsonl --granularity 300`
+	imp.Args = cobra.ExactArgs(1)
+	imp.Run = func(cmd *cobra.Command, args []string) {
+
+		if _, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug); err != nil {
+			panic(err)
+		}
+
+		if err := data.NewImport(args[0], format, granularity); err != nil {
+			panic(err)
+		}
+	}
+
+	imp.Flags().StringVar(&format, "format", "", fmt.Sprintf("%s or %s, defaults to the file extension", data.CSV, data.JSONL))
+	imp.Flags().IntVar(&granularity, "granularity", cbp.Minute, fmt.Sprintf("seconds of each rate, one of %v", cbp.Granularities))
+
+	exp := new(cobra.Command)
+	exp.Use = "export [file]"
+	exp.Short = "Writes the stored rates of a time frame to a csv or jsonl file."
+	exp.Long = util.Banner
+	exp.Example = `
+	# Writes every stored minute rate of June 2021 for the configured products.
+	nuchal data export rates.csv --from 2021-06-01 --to 2021-07-01
+
+	# Writes the 5 minute rates of the configured period for XLM, one json rate per line.
+	nuchal data export xlm.jsonl --usd XLM --granularity 300`
+	exp.Args = cobra.ExactArgs(1)
+	exp.Run = func(cmd *cobra.Command, args []string) {
+
+		session, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug)
+		if err != nil {
+			panic(err)
+		}
+
+		alpha, omega, err := timeFrame(session, from, to)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := data.NewExport(session, args[0], format, alpha, omega, granularity); err != nil {
+			panic(err)
+		}
+	}
+
+	exp.Flags().StringVar(&format, "format", "", fmt.Sprintf("%s or %s, defaults to the file extension", data.CSV, data.JSONL))
+	exp.Flags().StringVar(&from, "from", "", "start of the time frame, RFC3339 or yyyy-mm-dd, defaults to the period alpha")
+	exp.Flags().StringVar(&to, "to", "", "end of the time frame, RFC3339 or yyyy-mm-dd, defaults to now with --from, else the period omega")
+	exp.Flags().IntVar(&granularity, "granularity", cbp.Minute, fmt.Sprintf("seconds of each rate, one of %v", cbp.Granularities))
+
+	c.AddCommand(backfill, imp, exp)
+	rootCmd.AddCommand(c)
+}
+
+// timeFrame returns the given from and to times, defaulting to the period of the session, or to now when only from
+// is given.
+func timeFrame(session *config.Session, from, to string) (alpha, omega time.Time, err error) {
+	alpha, omega = *session.Alpha, *session.Omega
+	if from != "" {
+		if alpha, err = parseTime(from); err != nil {
+			return
+		}
+	}
+	if to != "" {
+		omega, err = parseTime(to)
+	} else if from != "" {
+		omega = time.Now().UTC().Truncate(time.Minute)
+	}
+	return
+}
+
+// parseTime parses the given RFC3339 time or yyyy-mm-dd date.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
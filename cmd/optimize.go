@@ -0,0 +1,86 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cmd
+
+import (
+	"github.com/nelsw/nuchal/pkg/cmd/sim"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+func init() {
+
+	var out string
+	var walkForward bool
+	var in, oos time.Duration
+	search := sim.Search{}
+
+	c := new(cobra.Command)
+	c.Use = "optimize"
+	c.Short = "Searches pattern gain, loss, delta and size values for the best simulation results per product."
+	c.Long = util.Banner
+	c.Example = `
+	# Prints a patterns block with the highest net profit combination of the default values for each product.
+	nuchal optimize
+
+	# Evaluates 500 random combinations between the given bounds and ranks them by win rate.
+	nuchal optimize --method random --samples 500 --gains .01,.05 --losses .01,.2 --objective winrate
+
+	# Ranks combinations by the smallest max drawdown and writes the patterns block to a file.
+	nuchal optimize --objective drawdown --out patterns.yml
+
+	# Tunes on every rolling 4 hour window and scores the best values on the hour that follows.
+	nuchal optimize --walk-forward --in-sample 4h --out-of-sample 1h`
+
+	c.Run = func(cmd *cobra.Command, args []string) {
+
+		session, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug)
+		if err != nil {
+			panic(err)
+		}
+
+		if walkForward {
+			err = sim.NewWalkForward(session, search, in, oos)
+		} else {
+			err = sim.NewOptimization(session, search, out)
+		}
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	c.PersistentFlags().StringVar(&search.Method, "method", sim.Grid, "search method, grid or random")
+	c.PersistentFlags().StringVar(&search.Objective, "objective", sim.NetProfit, "rank by net, winrate or drawdown")
+	c.PersistentFlags().Float64SliceVar(&search.Gains, "gains", []float64{.01, .0195, .03, .05}, "gain values")
+	c.PersistentFlags().Float64SliceVar(&search.Losses, "losses", []float64{.01, .05, .1, .195}, "loss values")
+	c.PersistentFlags().Float64SliceVar(&search.Deltas, "deltas", []float64{.0005, .001, .002}, "delta values")
+	c.PersistentFlags().Float64SliceVar(&search.Sizes, "sizes", nil, "size values, defaults to the pattern size")
+	c.PersistentFlags().IntVar(&search.Samples, "samples", 100, "random combinations per product")
+	c.PersistentFlags().Int64Var(&search.Seed, "seed", time.Now().UnixNano(), "random search seed")
+	c.PersistentFlags().IntVar(&search.Workers, "workers", 0, "parallel simulations, defaults to the cpu count")
+	c.PersistentFlags().Float64Var(&search.Balance, "balance", 1000, "USD balance for percent and kelly sizing")
+	c.PersistentFlags().StringVar(&out, "out", "", "write the patterns block to a file instead of stdout")
+	c.PersistentFlags().BoolVar(&walkForward, "walk-forward", false, "tune and score on rolling period folds")
+	c.PersistentFlags().DurationVar(&in, "in-sample", time.Hour*4, "walk forward tuning duration")
+	c.PersistentFlags().DurationVar(&oos, "out-of-sample", time.Hour, "walk forward scoring duration")
+	rootCmd.AddCommand(c)
+}
@@ -19,6 +19,8 @@
 package cmd
 
 import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/cmd/report"
 	"github.com/nelsw/nuchal/pkg/config"
 	"github.com/nelsw/nuchal/pkg/util"
@@ -34,14 +36,22 @@ func init() {
 	c.Example = `
 	# Prints USD, Cryptocurrency, and total value of the configured Coinbase Pro account.
 	# Also prints position and trading information, namely size, value, balance and holds.
-	nuchal report`
+	nuchal report
+
+	# Matches sells to the most recent buys when computing realized and unrealized profit and loss.
+	nuchal report --lots lifo`
+
+	var lots string
+
 	c.Run = func(cmd *cobra.Command, args []string) {
 		if session, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug); err != nil {
 			panic(err)
-		} else if err := report.New(session); err != nil {
+		} else if err := report.New(session, lots); err != nil {
 			panic(err)
 		}
 	}
 
+	c.Flags().StringVar(&lots, "lots", cbp.FIFO, fmt.Sprintf("lot method matching sells to buys, %s, %s or %s", cbp.FIFO, cbp.LIFO, cbp.SpecificID))
+
 	rootCmd.AddCommand(c)
 }
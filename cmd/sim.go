@@ -27,7 +27,9 @@ import (
 
 func init() {
 
-	var winnersOnly, noLosers bool
+	var winnersOnly, noLosers, portfolio, history, diff bool
+	var output string
+	var p sim.Portfolio
 
 	c := new(cobra.Command)
 	c.Use = "sim"
@@ -42,7 +44,26 @@ func init() {
 
 	# Prints a simulation result report where the net gain for each product simulation was greater than zero and also 
 	# where the amount of positions trading are zero.	
-	nuchal sim -w --winners-only`
+	nuchal sim -w --winners-only
+
+	# Writes every simulation and chart to csv files in the results directory, json and jsonl are also supported.
+	nuchal sim --output csv
+
+	# Lists every saved simulation run, each run is saved when it completes.
+	nuchal sim --history
+
+	# Shows how pattern criteria, net, win count and volume changed from run 3 to run 7.
+	nuchal sim --diff 3 7
+
+	# Backtests every product on a single timeline sharing $500, with at most 3 positions open at once.
+	nuchal sim --portfolio --portfolio-usd 500 --max-positions 3 --max-exposure 200`
+
+	c.Args = func(cmd *cobra.Command, args []string) error {
+		if diff {
+			return cobra.ExactArgs(2)(cmd, args)
+		}
+		return cobra.NoArgs(cmd, args)
+	}
 
 	c.Run = func(cmd *cobra.Command, args []string) {
 
@@ -51,12 +72,29 @@ func init() {
 			panic(err)
 		}
 
-		if err := sim.New(session, winnersOnly, noLosers); err != nil {
+		if history {
+			err = sim.NewHistory()
+		} else if diff {
+			err = sim.NewDiff(args[0], args[1])
+		} else if portfolio {
+			err = sim.NewPortfolio(session, p)
+		} else {
+			err = sim.New(session, winnersOnly, noLosers, p.USD, output)
+		}
+
+		if err != nil {
 			panic(err)
 		}
 	}
 
 	c.PersistentFlags().BoolVarP(&winnersOnly, "winners-only", "w", false, "")
 	c.PersistentFlags().BoolVarP(&noLosers, "no-losers", "t", false, "")
+	c.PersistentFlags().StringVarP(&output, "output", "o", "", "Write results as json, jsonl or csv")
+	c.PersistentFlags().BoolVar(&history, "history", false, "List saved simulation runs")
+	c.PersistentFlags().BoolVar(&diff, "diff", false, "Compare two saved simulation runs by id")
+	c.PersistentFlags().BoolVar(&portfolio, "portfolio", false, "Backtest every product with shared capital")
+	c.PersistentFlags().Float64Var(&p.USD, "portfolio-usd", 1000, "USD balance for sizing entries, shared by every product in a portfolio")
+	c.PersistentFlags().IntVar(&p.MaxPositions, "max-positions", 0, "most positions open at once, 0 is unlimited")
+	c.PersistentFlags().Float64Var(&p.MaxExposure, "max-exposure", 0, "most USD open per product, 0 is unlimited")
 	rootCmd.AddCommand(c)
 }
@@ -27,7 +27,8 @@ import (
 
 func init() {
 
-	var drop, hold, sell, exit, eject bool
+	var drop, hold, sell, exit, eject, paper bool
+	var paperUsd float64
 
 	c := new(cobra.Command)
 	c.Use = "trade"
@@ -37,7 +38,8 @@ func init() {
   # Trade buys & sells products at prices or at times that meet or exceed pattern criteria, for a specified duration.
   nuchal trade
 
-  # Hold creates a limit entry order at the goal price for every active trading position in your available balance.
+  # Hold brackets every active trading position with a take-profit at the goal price and a stop loss at the loss price,
+  # then watches every open bracket, including those of previous runs, until one side fills and cancels the other.
   nuchal trade --hold
 
   # Sell all available positions (active trades) at prices or at times that meet or exceed pattern criteria.
@@ -50,7 +52,13 @@ func init() {
   nuchal trade --drop
 
   # Sells everything at market price.
-  nuchal trade --eject`
+  nuchal trade --eject
+
+  # Trade with live prices against a simulated account, persisting every fill for later comparison.
+  nuchal trade --paper --paper-usd 500
+
+  # Paper applies to every mode, eg. selling the positions of the simulated account.
+  nuchal trade --paper --sell`
 
 	c.Run = func(cmd *cobra.Command, args []string) {
 
@@ -59,6 +67,12 @@ func init() {
 			panic(err)
 		}
 
+		if paper {
+			if _, err := trade.Paper(paperUsd); err != nil {
+				panic(err)
+			}
+		}
+
 		if hold {
 			err = trade.NewHolds(session)
 		} else if sell {
@@ -74,10 +88,12 @@ func init() {
 		}
 	}
 
-	c.PersistentFlags().BoolVar(&hold, "hold", false, "Set a limit order for each trading position")
+	c.PersistentFlags().BoolVar(&hold, "hold", false, "Bracket each trading position with a take-profit and stop loss")
 	c.PersistentFlags().BoolVar(&sell, "sell", false, "Close positions at the goal price or higher")
 	c.PersistentFlags().BoolVar(&exit, "exit", false, "Liquidate all open positions at market price")
 	c.PersistentFlags().BoolVar(&drop, "drop", false, "Cancel all hold orders to sell and convert")
 	c.PersistentFlags().BoolVar(&eject, "eject", false, "Sells everything at market price")
+	c.PersistentFlags().BoolVar(&paper, "paper", false, "Trade live prices against a simulated account, in any mode")
+	c.PersistentFlags().Float64Var(&paperUsd, "paper-usd", 1000, "USD balance of the simulated account")
 	rootCmd.AddCommand(c)
 }
@@ -3,18 +3,18 @@ module github.com/nelsw/nuchal
 go 1.16
 
 require (
+	github.com/glebarez/sqlite v1.11.0
 	github.com/go-echarts/go-echarts/v2 v2.2.4
 	github.com/gorilla/websocket v1.4.2
-	github.com/joho/godotenv v1.3.0 // indirect
+	github.com/joho/godotenv v1.3.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/preichenberger/go-coinbasepro/v2 v2.0.5
 	github.com/rs/zerolog v1.15.0
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.7.0
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/yaml.v2 v2.4.0
-	gorm.io/driver/postgres v1.0.8
-	gorm.io/gorm v1.21.9
+	gorm.io/driver/postgres v1.5.7
+	gorm.io/gorm v1.25.7
 )
@@ -0,0 +1,278 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"sort"
+)
+
+// Book is a local level 2 order book of a single product, built from the snapshot and l2update messages of the level2
+// channel. Bids are sorted highest first and asks lowest first when read.
+type Book struct {
+	ProductID string
+	bids      map[float64]float64
+	asks      map[float64]float64
+}
+
+// Level is the aggregate size resting at a single price.
+type Level struct {
+	Price float64
+	Size  float64
+}
+
+// NewBook returns an empty order book for the given product.
+func NewBook(productID string) *Book {
+	return &Book{ProductID: productID, bids: map[float64]float64{}, asks: map[float64]float64{}}
+}
+
+// Apply applies the given level2 message to the book, a snapshot replaces every level and an l2update changes the size
+// of a level, removing it when the size is zero.
+func (b *Book) Apply(message cb.Message) {
+	switch message.Type {
+	case "snapshot":
+		b.bids = map[float64]float64{}
+		b.asks = map[float64]float64{}
+		for _, entry := range message.Bids {
+			b.set("buy", entry.Price, entry.Size)
+		}
+		for _, entry := range message.Asks {
+			b.set("sell", entry.Price, entry.Size)
+		}
+	case "l2update":
+		for _, change := range message.Changes {
+			b.set(change.Side, change.Price, change.Size)
+		}
+	}
+}
+
+func (b *Book) set(side, price, size string) {
+	levels := b.asks
+	if side == "buy" {
+		levels = b.bids
+	}
+	if p, s := util.Float64(price), util.Float64(size); s == 0 {
+		delete(levels, p)
+	} else {
+		levels[p] = s
+	}
+}
+
+// Clone returns a copy of the book, safe to read while the original is updated.
+func (b *Book) Clone() *Book {
+	c := NewBook(b.ProductID)
+	for price, size := range b.bids {
+		c.bids[price] = size
+	}
+	for price, size := range b.asks {
+		c.asks[price] = size
+	}
+	return c
+}
+
+// Bids returns every bid level, highest price first.
+func (b *Book) Bids() []Level {
+	levels := toLevels(b.bids)
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Price > levels[j].Price
+	})
+	return levels
+}
+
+// Asks returns every ask level, lowest price first.
+func (b *Book) Asks() []Level {
+	levels := toLevels(b.asks)
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Price < levels[j].Price
+	})
+	return levels
+}
+
+func toLevels(m map[float64]float64) []Level {
+	levels := make([]Level, 0, len(m))
+	for price, size := range m {
+		levels = append(levels, Level{price, size})
+	}
+	return levels
+}
+
+// BestBid returns the highest bid level, and false if there are no bids.
+func (b *Book) BestBid() (Level, bool) {
+	var best Level
+	for price, size := range b.bids {
+		if price > best.Price {
+			best = Level{price, size}
+		}
+	}
+	return best, best.Price > 0
+}
+
+// BestAsk returns the lowest ask level, and false if there are no asks.
+func (b *Book) BestAsk() (Level, bool) {
+	var best Level
+	for price, size := range b.asks {
+		if best.Price == 0 || price < best.Price {
+			best = Level{price, size}
+		}
+	}
+	return best, best.Price > 0
+}
+
+// Mid returns the price halfway between the best bid and the best ask, or zero if either side is empty.
+func (b *Book) Mid() float64 {
+	bid, ok := b.BestBid()
+	if !ok {
+		return 0
+	}
+	ask, ok := b.BestAsk()
+	if !ok {
+		return 0
+	}
+	return (bid.Price + ask.Price) / 2
+}
+
+// Spread returns the difference between the best ask and the best bid as a fraction of the mid price.
+func (b *Book) Spread() (float64, error) {
+	mid := b.Mid()
+	if mid == 0 {
+		return 0, errors.New("book is empty")
+	}
+	bid, _ := b.BestBid()
+	ask, _ := b.BestAsk()
+	return (ask.Price - bid.Price) / mid, nil
+}
+
+// Depth returns the USD value of the bids and of the asks resting within the given basis points of the mid price.
+func (b *Book) Depth(bps float64) (bids, asks float64) {
+	mid := b.Mid()
+	if mid == 0 {
+		return 0, 0
+	}
+	for price, size := range b.bids {
+		if price >= mid*(1-bps/10000) {
+			bids += price * size
+		}
+	}
+	for price, size := range b.asks {
+		if price <= mid*(1+bps/10000) {
+			asks += price * size
+		}
+	}
+	return bids, asks
+}
+
+// Impact returns the estimated average price of a market order of the given side and base size, walking the book, and
+// its distance from the mid price as a fraction of the mid price. An error is returned if the book is too thin to
+// fill the order.
+func (b *Book) Impact(side string, size float64) (price, impact float64, err error) {
+
+	mid := b.Mid()
+	if mid == 0 {
+		return 0, 0, errors.New("book is empty")
+	}
+
+	levels := b.Asks()
+	if side == "sell" {
+		levels = b.Bids()
+	}
+
+	var filled, value float64
+	for _, level := range levels {
+		qty := level.Size
+		if remaining := size - filled; qty > remaining {
+			qty = remaining
+		}
+		filled += qty
+		value += qty * level.Price
+		if filled >= size {
+			break
+		}
+	}
+
+	if filled < size || filled == 0 {
+		return 0, 0, fmt.Errorf("book is too thin to %s %f", side, size)
+	}
+
+	price = value / filled
+	if side == "sell" {
+		return price, (mid - price) / mid, nil
+	}
+	return price, (price - mid) / mid, nil
+}
+
+// GetBestBid returns the best bid of the given product from its live order book, or from its ticker until the market
+// data hub has received the book.
+func GetBestBid(productID string) (float64, error) {
+	if book, ok := GetBook(productID); ok {
+		if bid, ok := book.BestBid(); ok {
+			return bid.Price, nil
+		}
+	}
+	ticker, err := exchange.GetTicker(productID)
+	if err != nil {
+		return 0, err
+	}
+	if bid := util.Float64(ticker.Bid); bid > 0 {
+		return bid, nil
+	}
+	return 0, fmt.Errorf("no %s bid", productID)
+}
+
+// Liquid returns an error if the spread of the given book, or the impact of the given market buy order on it, exceeds
+// the pattern thresholds. A missing book only passes when neither threshold is set.
+func (p *Pattern) Liquid(book *Book, order *cb.Order) error {
+
+	if p.Spread == 0 && p.Impact == 0 {
+		return nil
+	}
+	if book == nil {
+		return fmt.Errorf("no %s order book", p.ID)
+	}
+
+	spread, err := book.Spread()
+	if err != nil {
+		return err
+	}
+	if p.Spread > 0 && spread > p.Spread {
+		return fmt.Errorf("spread of %f exceeds %f", spread, p.Spread)
+	}
+
+	if p.Impact == 0 {
+		return nil
+	}
+
+	size := util.Float64(order.Size)
+	if size == 0 {
+		ask, _ := book.BestAsk()
+		size = util.Float64(order.Funds) / ask.Price
+	}
+
+	_, impact, err := book.Impact("buy", size)
+	if err != nil {
+		return err
+	}
+	if impact > p.Impact {
+		return fmt.Errorf("impact of %f exceeds %f", impact, p.Impact)
+	}
+
+	return nil
+}
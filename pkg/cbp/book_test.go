@@ -0,0 +1,99 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+)
+
+func newTestBook() *Book {
+	book := NewBook("BTC-USD")
+	book.Apply(cb.Message{
+		Type:      "snapshot",
+		ProductID: "BTC-USD",
+		Bids:      []cb.SnapshotEntry{{Price: "99", Size: "1"}, {Price: "98", Size: "2"}, {Price: "90", Size: "10"}},
+		Asks:      []cb.SnapshotEntry{{Price: "101", Size: "1"}, {Price: "102", Size: "2"}, {Price: "110", Size: "10"}},
+	})
+	return book
+}
+
+func TestBook(t *testing.T) {
+
+	book := newTestBook()
+
+	if bid, _ := book.BestBid(); bid.Price != 99 {
+		t.Errorf("expected a best bid of 99, got %f", bid.Price)
+	}
+	if spread, err := book.Spread(); err != nil || spread != .02 {
+		t.Errorf("expected a spread of 2%%, got %f", spread)
+	}
+	if bids, asks := book.Depth(250); bids != 99+196 || asks != 101+204 {
+		t.Errorf("expected depth within 250 bps of 295 and 305, got %f and %f", bids, asks)
+	}
+
+	price, impact, err := book.Impact("buy", 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if price != 101.5 || math.Abs(impact-.015) > 1e-9 {
+		t.Errorf("expected an average price of 101.5 and 1.5%% impact, got %f and %f", price, impact)
+	}
+	if _, _, err := book.Impact("sell", 100); err == nil {
+		t.Errorf("expected a thin book error")
+	}
+
+	book.Apply(cb.Message{Type: "l2update", ProductID: "BTC-USD", Changes: []cb.SnapshotChange{
+		{Side: "sell", Price: "101", Size: "0"},
+		{Side: "buy", Price: "100", Size: "3"},
+	}})
+
+	if ask, _ := book.BestAsk(); ask.Price != 102 {
+		t.Errorf("expected an emptied level to be removed, got a best ask of %f", ask.Price)
+	}
+	if bids := book.Bids(); len(bids) != 4 || bids[0].Price != 100 || bids[0].Size != 3 {
+		t.Errorf("expected a new best bid of 3 at 100, got %v", bids)
+	}
+}
+
+func TestPatternLiquid(t *testing.T) {
+
+	order := &cb.Order{ProductID: "BTC-USD", Side: "buy", Type: "market", Size: "2"}
+
+	pattern := &Pattern{ID: "BTC-USD"}
+	if err := pattern.Liquid(nil, order); err != nil {
+		t.Errorf("expected no thresholds to pass without a book, got %v", err)
+	}
+
+	pattern.Spread = .01
+	if err := pattern.Liquid(nil, order); err == nil {
+		t.Errorf("expected a missing book to fail")
+	}
+	if err := pattern.Liquid(newTestBook(), order); err == nil {
+		t.Errorf("expected a 2%% spread to fail")
+	}
+
+	pattern.Spread, pattern.Impact = .05, .01
+	if err := pattern.Liquid(newTestBook(), order); err == nil {
+		t.Errorf("expected a 1.5%% impact to fail")
+	}
+	if err := pattern.Liquid(newTestBook(), &cb.Order{Funds: "101"}); err != nil {
+		t.Errorf("expected a single level funds order to pass, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"time"
+)
+
+// Minute is the default candle granularity in seconds, and the granularity of every stored rate.
+const Minute = 60
+
+// Granularities are the candle granularities, in seconds, built live from matches. Each is also a Coinbase Pro historic
+// rate granularity, so live and historic candles are comparable.
+var Granularities = []int{Minute, 300, 900, 3600}
+
+// Candles aggregates the matches of a single product into OHLCV rates of a single granularity, aligned to the clock.
+type Candles struct {
+	productID   string
+	granularity time.Duration
+	this        *Rate
+	next        time.Time // start of the period after the last closed rate
+}
+
+// NewCandles returns a candle aggregator for the given product and granularity in seconds.
+func NewCandles(productID string, granularity int) (*Candles, error) {
+	if !IsGranularity(granularity) {
+		return nil, fmt.Errorf("granularity %d is not one of %v", granularity, Granularities)
+	}
+	return &Candles{productID: productID, granularity: time.Duration(granularity) * time.Second}, nil
+}
+
+// IsGranularity returns true if the given granularity in seconds is one of Granularities.
+func IsGranularity(granularity int) bool {
+	for _, g := range Granularities {
+		if g == granularity {
+			return true
+		}
+	}
+	return false
+}
+
+// RateGranularity returns the pattern granularity in seconds, which defaults to a minute.
+func (p *Pattern) RateGranularity() int {
+	if p.Granularity == 0 {
+		return Minute
+	}
+	return p.Granularity
+}
+
+// Add folds the given match message into the open rate, and returns the previous rate if the match begins a later
+// period. Matches of a period already returned are ignored, as are messages of other types or products.
+func (c *Candles) Add(message cb.Message) *Rate {
+
+	if message.Type != "match" || message.ProductID != c.productID {
+		return nil
+	}
+
+	price := util.Float64(message.Price)
+	size := util.Float64(message.Size)
+	start := message.Time.Time().UTC().Truncate(c.granularity)
+
+	if start.Before(c.next) {
+		return nil // late match of a closed rate
+	}
+
+	if c.this != nil && start.Equal(c.this.Time()) {
+		if price > c.this.High {
+			c.this.High = price
+		}
+		if price < c.this.Low {
+			c.this.Low = price
+		}
+		c.this.Close = price
+		c.this.Volume += size
+		return nil
+	}
+
+	closed := c.close()
+	c.this = NewRate(c.productID, cb.HistoricRate{
+		Time:   start,
+		Open:   price,
+		High:   price,
+		Low:    price,
+		Close:  price,
+		Volume: size,
+	})
+
+	return closed
+}
+
+// Flush returns the open rate if its period has ended by the given time, so quiet products still close on time.
+func (c *Candles) Flush(now time.Time) *Rate {
+	if c.this == nil || now.Before(c.this.Time().Add(c.granularity)) {
+		return nil
+	}
+	return c.close()
+}
+
+// close returns the open rate, if any, and ignores any later matches of its period.
+func (c *Candles) close() *Rate {
+	closed := c.this
+	if closed != nil {
+		c.next = closed.Time().Add(c.granularity)
+	}
+	c.this = nil
+	return closed
+}
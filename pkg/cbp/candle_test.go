@@ -0,0 +1,82 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestCandles(t *testing.T) {
+
+	if _, err := NewCandles("BTC-USD", 120); err == nil {
+		t.Errorf("expected an error for a granularity Coinbase Pro doesn't offer")
+	}
+
+	candles, err := NewCandles("BTC-USD", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, price, size string) cb.Message {
+		return cb.Message{Type: "match", ProductID: "BTC-USD", Time: cb.Time(alpha.Add(d)), Price: price, Size: size}
+	}
+
+	for _, message := range []cb.Message{
+		at(time.Minute*2, "2", "1"),
+		at(time.Minute*3, "3", ".5"),
+		at(time.Minute*3, "1", ".5"), // a new high doesn't skip a later low
+		{Type: "match", ProductID: "ETH-USD", Time: cb.Time(alpha), Price: "9", Size: "9"},
+		{Type: "ticker", ProductID: "BTC-USD", Time: cb.Time(alpha), Price: "9"},
+		at(time.Minute*4+time.Second*59, "1.5", "1"),
+	} {
+		if rate := candles.Add(message); rate != nil {
+			t.Fatalf("unexpected rate %+v", rate.HistoricRate)
+		}
+	}
+
+	if rate := candles.Flush(alpha.Add(time.Minute * 4)); rate != nil {
+		t.Errorf("expected the rate to stay open until its period ends")
+	}
+
+	rate := candles.Add(at(time.Minute*5, "4", "1"))
+	if rate == nil {
+		t.Fatal("expected a rate once a match of the next period arrives")
+	}
+	if !rate.Time().Equal(alpha) {
+		t.Errorf("expected the rate aligned to the 5 minute boundary, got %s", rate.Time())
+	}
+	if rate.Open != 2 || rate.High != 3 || rate.Low != 1 || rate.Close != 1.5 || rate.Volume != 3 {
+		t.Errorf("unexpected rate %+v", rate.HistoricRate)
+	}
+
+	if rate := candles.Add(at(time.Minute*4, "100", "1")); rate != nil {
+		t.Errorf("expected a late match of a closed rate to be ignored")
+	}
+
+	rate = candles.Flush(alpha.Add(time.Minute * 10))
+	if rate == nil || rate.Open != 4 || rate.High != 4 || rate.Volume != 1 {
+		t.Fatalf("expected the quiet period to flush, got %v", rate)
+	}
+	if rate := candles.Add(at(time.Minute*9, "5", "1")); rate != nil || candles.Flush(alpha.Add(time.Hour)) != nil {
+		t.Errorf("expected a late match of a flushed rate to be ignored")
+	}
+}
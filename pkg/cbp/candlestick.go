@@ -0,0 +1,163 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	TweezerBottom      = "tweezer"
+	Hammer             = "hammer"
+	BullishEngulfing   = "engulfing"
+	MorningStar        = "morning_star"
+	ThreeWhiteSoldiers = "three_white_soldiers"
+	PiercingLine       = "piercing_line"
+)
+
+// Candlestick is a bullish candlestick pattern used to recognize trade entries.
+type Candlestick struct {
+
+	// Window is the amount of rates the candlestick spans.
+	Window int
+
+	// Matches returns true if the given rates, oldest first and exactly Window long, print the candlestick.
+	// Delta is the size of an acceptable difference between prices that the candlestick expects to be equal.
+	Matches func(rates []Rate, delta float64) bool
+}
+
+var (
+	candlesticksMu sync.RWMutex
+	candlesticks   = map[string]Candlestick{
+		TweezerBottom:      {3, matchesTweezerBottom},
+		Hammer:             {3, matchesHammer},
+		BullishEngulfing:   {2, matchesBullishEngulfing},
+		MorningStar:        {3, matchesMorningStar},
+		ThreeWhiteSoldiers: {3, matchesThreeWhiteSoldiers},
+		PiercingLine:       {2, matchesPiercingLine},
+	}
+)
+
+// RegisterCandlestick adds or replaces a candlestick, making it selectable by name with the pattern type field.
+func RegisterCandlestick(name string, candlestick Candlestick) {
+	candlesticksMu.Lock()
+	defer candlesticksMu.Unlock()
+	candlesticks[name] = candlestick
+}
+
+// GetCandlestick returns the candlestick registered with the given name.
+func GetCandlestick(name string) (Candlestick, bool) {
+	candlesticksMu.RLock()
+	defer candlesticksMu.RUnlock()
+	candlestick, ok := candlesticks[name]
+	return candlestick, ok
+}
+
+// GetCandlestickNames returns the sorted names of every registered candlestick.
+func GetCandlestickNames() []string {
+	candlesticksMu.RLock()
+	defer candlesticksMu.RUnlock()
+	var names []string
+	for name := range candlesticks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (v *Rate) body() float64 {
+	return math.Abs(v.Open - v.Close)
+}
+
+func (v *Rate) midpoint() float64 {
+	return (v.Open + v.Close) / 2
+}
+
+// matchesTweezerBottom is two down rates followed by an up rate, where the last two share a bottom.
+func matchesTweezerBottom(rates []Rate, delta float64) bool {
+	then, that, this := rates[0], rates[1], rates[2]
+	return then.IsInit() &&
+		then.IsDown() &&
+		that.IsInit() &&
+		that.IsDown() &&
+		this.IsUp() &&
+		math.Abs(math.Min(that.Low, that.Close)-math.Min(this.Low, this.Open)) <= delta
+}
+
+// matchesHammer is two down rates followed by a rate with a small body at the top of a lower shadow at least twice
+// its size, and an upper shadow no larger than delta.
+func matchesHammer(rates []Rate, delta float64) bool {
+	then, that, this := rates[0], rates[1], rates[2]
+	body := this.body()
+	return then.IsDown() &&
+		that.IsDown() &&
+		this.Low < that.Low &&
+		math.Min(this.Open, this.Close)-this.Low >= body*2 &&
+		this.High-math.Max(this.Open, this.Close) <= delta
+}
+
+// matchesBullishEngulfing is a down rate followed by an up rate whose body engulfs it.
+func matchesBullishEngulfing(rates []Rate, delta float64) bool {
+	that, this := rates[0], rates[1]
+	return that.IsDown() &&
+		this.IsUp() &&
+		this.Open <= that.Close+delta &&
+		this.Close >= that.Open
+}
+
+// matchesMorningStar is a down rate, a rate with a body no larger than a third of it that opens below its close, and
+// an up rate that closes above its midpoint.
+func matchesMorningStar(rates []Rate, delta float64) bool {
+	then, that, this := rates[0], rates[1], rates[2]
+	return then.IsDown() &&
+		that.body() <= then.body()/3 &&
+		math.Max(that.Open, that.Close) <= then.Close+delta &&
+		this.IsUp() &&
+		this.Close > then.midpoint()
+}
+
+// matchesThreeWhiteSoldiers is three up rates, each opening within the body of and closing above the rate before it.
+func matchesThreeWhiteSoldiers(rates []Rate, delta float64) bool {
+	for i, rate := range rates {
+		if !rate.IsUp() || rate.body() <= delta {
+			return false
+		}
+		if i == 0 {
+			continue
+		}
+		prev := rates[i-1]
+		if rate.Open < prev.Open || rate.Open > prev.Close || rate.Close <= prev.Close {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPiercingLine is a down rate followed by an up rate that opens below its low and closes above its midpoint
+// without reaching its open.
+func matchesPiercingLine(rates []Rate, delta float64) bool {
+	that, this := rates[0], rates[1]
+	return that.IsDown() &&
+		this.IsUp() &&
+		this.Open <= that.Low+delta &&
+		this.Close > that.midpoint() &&
+		this.Close < that.Open
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+// ohlc returns a rate for each given open, high, low, close quartet.
+func ohlc(quartets ...[4]float64) []Rate {
+	var rates []Rate
+	for i, q := range quartets {
+		rates = append(rates, *NewRate("BTC-USD", cb.HistoricRate{
+			Time:  time.Unix(int64(i*60), 0),
+			Open:  q[0],
+			High:  q[1],
+			Low:   q[2],
+			Close: q[3],
+		}))
+	}
+	return rates
+}
+
+func TestPatternMatches(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		rates []Rate
+		want  bool
+	}{
+		{TweezerBottom, ohlc([4]float64{12, 12, 10, 10}, [4]float64{10.5, 10.5, 9, 9}, [4]float64{9, 10, 9, 10}), true},
+		{TweezerBottom, ohlc([4]float64{12, 12, 10, 10}, [4]float64{10.5, 10.5, 9, 9}, [4]float64{9.5, 10, 9.5, 10}), false},
+		{Hammer, ohlc([4]float64{12, 12, 11, 11}, [4]float64{11, 11, 10, 10}, [4]float64{9.8, 10, 9, 10}), true},
+		{Hammer, ohlc([4]float64{12, 12, 11, 11}, [4]float64{11, 11, 10, 10}, [4]float64{9.8, 11, 9, 10}), false},
+		{BullishEngulfing, ohlc([4]float64{11, 11, 10, 10}, [4]float64{10, 11.5, 10, 11.5}), true},
+		{BullishEngulfing, ohlc([4]float64{11, 11, 10, 10}, [4]float64{10, 10.5, 10, 10.5}), false},
+		{MorningStar, ohlc([4]float64{13, 13, 10, 10}, [4]float64{9.8, 9.9, 9.6, 9.7}, [4]float64{9.7, 12, 9.7, 12}), true},
+		{MorningStar, ohlc([4]float64{13, 13, 10, 10}, [4]float64{9.8, 9.9, 9.6, 9.7}, [4]float64{9.7, 11, 9.7, 11}), false},
+		{ThreeWhiteSoldiers, ohlc([4]float64{10, 11, 10, 11}, [4]float64{10.5, 12, 10.5, 12}, [4]float64{11.5, 13, 11.5, 13}), true},
+		{ThreeWhiteSoldiers, ohlc([4]float64{10, 11, 10, 11}, [4]float64{11.5, 12, 11.5, 12}, [4]float64{11.5, 13, 11.5, 13}), false},
+		{PiercingLine, ohlc([4]float64{12, 12, 10, 10}, [4]float64{9.5, 11.5, 9.5, 11.5}), true},
+		{PiercingLine, ohlc([4]float64{12, 12, 10, 10}, [4]float64{9.5, 10.5, 9.5, 10.5}), false},
+	}
+
+	for _, tt := range tests {
+		pattern := &Pattern{ID: "BTC-USD", Delta: .001, Type: tt.name}
+		if got := pattern.Matches(tt.rates); got != tt.want {
+			t.Errorf("%s matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatternWindow(t *testing.T) {
+
+	pattern := new(Pattern)
+	if pattern.Window() != 3 {
+		t.Errorf("expected the default tweezer window of 3, got %d", pattern.Window())
+	}
+
+	pattern.Type = "unknown"
+	if pattern.Window() != 0 || pattern.Matches(ohlc([4]float64{1, 1, 1, 1})) {
+		t.Errorf("expected an unknown type to never match")
+	}
+
+	RegisterCandlestick("doji", Candlestick{1, func(rates []Rate, delta float64) bool {
+		return rates[0].body() <= delta
+	}})
+
+	pattern.Type = "doji"
+	if !pattern.Matches(ohlc([4]float64{9, 9, 9, 9}, [4]float64{1, 2, 0, 1})) {
+		t.Errorf("expected a registered candlestick to match the most recent window")
+	}
+}
@@ -20,16 +20,14 @@ package cbp
 
 import (
 	"errors"
-	"fmt"
-	ws "github.com/gorilla/websocket"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/nelsw/nuchal/pkg/util"
 	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
-	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -39,6 +37,8 @@ type Config struct {
 		Key        string `envconfig:"COINBASE_PRO_KEY" yaml:"key"`
 		Passphrase string `envconfig:"COINBASE_PRO_PASSPHRASE" yaml:"pass"`
 		Secret     string `envconfig:"COINBASE_PRO_SECRET" yaml:"secret"`
+		Url        string `envconfig:"COINBASE_PRO_URL" yaml:"url"`
+		Websocket  string `envconfig:"COINBASE_PRO_WEBSOCKET" yaml:"websocket"`
 		Fees       struct {
 			Maker float64 `envconfig:"COINBASE_PRO_MAKER_FEE" yaml:"maker"`
 			Taker float64 `envconfig:"COINBASE_PRO_TAKER_FEE" yaml:"taker"`
@@ -46,9 +46,12 @@ type Config struct {
 	} `yaml:"cbp"`
 }
 
+// ErrRejected is returned when Coinbase rejects an order on creation, eg. a post-only order that would have taken
+// liquidity.
+var ErrRejected = errors.New("order rejected")
+
 var (
 	cfg      *Config
-	client   *cb.Client
 	products = map[string]Product{}
 	usdRegex = regexp.MustCompile(`^((\w{3,5})(-USD))$`)
 )
@@ -72,20 +75,18 @@ func Init(name string, dbProducts *[]Product) (*time.Time, error) {
 		}
 	}
 
-	baseUrl := "https://api.pro.coinbase.com"
-	if err != nil {
-		baseUrl = "https://api-public.sandbox.pro.coinbase.com"
-	}
-
-	client = &cb.Client{
-		baseUrl,
-		cfg.Api.Secret,
-		cfg.Api.Key,
-		cfg.Api.Passphrase,
-		&http.Client{
-			Timeout: 15 * time.Second,
-		},
-		0,
+	if exchange == nil {
+		baseUrl := cfg.Api.Url
+		if baseUrl == "" && err != nil {
+			baseUrl = coinbaseSandboxUrl
+		} else if baseUrl == "" {
+			baseUrl = coinbaseUrl
+		}
+		wsUrl := cfg.Api.Websocket
+		if wsUrl == "" {
+			wsUrl = coinbaseWebsocketUrl
+		}
+		exchange = NewCoinbase(baseUrl, wsUrl, cfg.Api.Key, cfg.Api.Passphrase, cfg.Api.Secret)
 	}
 
 	if len(*dbProducts) > 0 {
@@ -101,7 +102,7 @@ func Init(name string, dbProducts *[]Product) (*time.Time, error) {
 		}
 	} else {
 		var allProducts []cb.Product
-		allProducts, err = client.GetProducts()
+		allProducts, err = exchange.GetProducts()
 		if err != nil {
 			return nil, err
 		}
@@ -126,7 +127,7 @@ func Init(name string, dbProducts *[]Product) (*time.Time, error) {
 	}
 
 	var tme cb.ServerTime
-	if tme, err = client.GetTime(); err != nil {
+	if tme, err = exchange.GetTime(); err != nil {
 		return nil, err
 	}
 
@@ -148,10 +149,16 @@ func validate() error {
 }
 
 func Maker() float64 {
+	if cfg == nil {
+		return 0
+	}
 	return cfg.Api.Fees.Maker
 }
 
 func Taker() float64 {
+	if cfg == nil {
+		return 0
+	}
 	return cfg.Api.Fees.Taker
 }
 
@@ -168,10 +175,13 @@ func GetAllProductIDs() []string {
 	return productIDs
 }
 
+// GetRates returns the historic rates of the given product for every page of params, oldest first, as Coinbase Pro
+// returns every page newest first.
 func GetRates(productID string, params *[]cb.GetHistoricRatesParams) ([]Rate, error) {
 	var rates []Rate
 	for _, params := range *params {
-		if out, err := client.GetHistoricRates(productID, params); err != nil {
+		throttle()
+		if out, err := exchange.GetHistoricRates(productID, params); err != nil {
 			return nil, err
 		} else {
 			for _, rate := range out {
@@ -179,14 +189,22 @@ func GetRates(productID string, params *[]cb.GetHistoricRatesParams) ([]Rate, er
 			}
 		}
 	}
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Unix < rates[j].Unix
+	})
 	return rates, nil
 }
 
 func GetHistoricRates(productID string, alpha, omega time.Time) ([]Rate, error) {
+	return GetHistoricCandles(productID, alpha, omega, Minute)
+}
+
+// GetHistoricCandles returns the historic rates of the given product and granularity in seconds between alpha and omega.
+func GetHistoricCandles(productID string, alpha, omega time.Time, granularity int) ([]Rate, error) {
 
 	cur := util.GetCurrency(productID)
 
-	out, err := client.GetHistoricRates(productID, cb.GetHistoricRatesParams{alpha, omega, 60})
+	out, err := exchange.GetHistoricRates(productID, cb.GetHistoricRatesParams{Start: alpha, End: omega, Granularity: granularity})
 	if err != nil {
 		log.Debug().Err(err).Msgf("%s ... %s ... coinbase", util.Tuna, cur)
 		return nil, err
@@ -201,27 +219,50 @@ func GetHistoricRates(productID string, alpha, omega time.Time) ([]Rate, error)
 }
 
 func GetFills(productID string) (*[]cb.Fill, error) {
+	fills, err := exchange.GetFills(productID)
+	if err != nil {
+		return nil, err
+	}
+	return &fills, nil
+}
 
-	cursor := client.ListFills(cb.ListFillsParams{ProductID: productID})
-
-	var newChunks, allChunks []cb.Fill
-	for cursor.HasMore {
+// GetFillsAfter returns every fill of the given product with a trade id above the given one, eg. the fills made since
+// those a ledger has.
+func GetFillsAfter(productID string, tradeID int) (*[]cb.Fill, error) {
+	fills, err := exchange.GetFillsAfter(productID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	return &fills, nil
+}
 
-		if err := cursor.NextPage(&newChunks); err != nil {
-			return nil, err
+func fillsAfter(fills []cb.Fill, tradeID int) []cb.Fill {
+	var after []cb.Fill
+	for _, fill := range fills {
+		if fill.TradeID > tradeID {
+			after = append(after, fill)
 		}
+	}
+	return after
+}
 
-		for _, chunk := range newChunks {
-			allChunks = append(allChunks, chunk)
+// GetAvailableUsd returns the USD balance available to trade, which excludes holds.
+func GetAvailableUsd() (float64, error) {
+	accounts, err := exchange.GetAccounts()
+	if err != nil {
+		return 0, err
+	}
+	for _, account := range accounts {
+		if account.Currency == "USD" {
+			return util.Float64(account.Available), nil
 		}
 	}
-
-	return &allChunks, nil
+	return 0, nil
 }
 
 func GetActivePositions() (map[string]Position, error) {
 
-	accounts, err := client.GetAccounts()
+	accounts, err := exchange.GetAccounts()
 	if err != nil {
 		return nil, err
 	}
@@ -247,7 +288,7 @@ func GetActivePositions() (map[string]Position, error) {
 		}
 
 		var ticker cb.Ticker
-		if ticker, err = client.GetTicker(productID); err != nil {
+		if ticker, err = exchange.GetTicker(productID); err != nil {
 			return nil, err
 		}
 
@@ -277,31 +318,23 @@ func GetTradingPositions() (map[string]Position, error) {
 }
 
 func GetOrders(productID string) (*[]cb.Order, error) {
-
-	cursor := client.ListOrders(cb.ListOrdersParams{ProductID: productID})
-
-	var newChunks, allChunks []cb.Order
-	for cursor.HasMore {
-
-		if err := cursor.NextPage(&newChunks); err != nil {
-			return nil, err
-		}
-
-		for _, chunk := range newChunks {
-			allChunks = append(allChunks, chunk)
-		}
+	orders, err := exchange.GetOrders(productID)
+	if err != nil {
+		return nil, err
 	}
-
-	return &allChunks, nil
+	return &orders, nil
 }
 
-// CreateOrder creates an order on Coinbase and returns the order once it is no longer pending and has settled.
-// Given that there are many different types of orders that can be created in many different scenarios, it is the
-// responsibility of the method calling this function to perform logging.
+// CreateOrder creates an order on Coinbase and returns the order once it is no longer pending and has settled. An order
+// rejected on creation returns ErrRejected at once, as Coinbase does not keep rejected orders to get. Given that there
+// are many different types of orders that can be created in many different scenarios, it is the responsibility of the
+// method calling this function to perform logging.
 func CreateOrder(order *cb.Order, attempt ...int) (*cb.Order, error) {
 
-	r, err := client.CreateOrder(order)
-	if err == nil {
+	r, err := exchange.CreateOrder(order)
+	if err == nil && r.Status == "rejected" {
+		return nil, ErrRejected
+	} else if err == nil {
 		return GetOrder(r.ID)
 	}
 
@@ -315,11 +348,21 @@ func CreateOrder(order *cb.Order, attempt ...int) (*cb.Order, error) {
 	return CreateOrder(order, i)
 }
 
+// FindOrder returns the order equal to the given id, or to the given client order id when prefixed with "client:",
+// without retrying when it is not found.
+func FindOrder(id string) (*cb.Order, error) {
+	order, err := exchange.GetOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 // GetOrder is a recursive function that returns an order equal to the given id once it is settled and not pending.
 // This function also performs extensive logging given its variable and seriously critical nature.
 func GetOrder(id string, attempt ...int) (*cb.Order, error) {
 
-	order, err := client.GetOrder(id)
+	order, err := exchange.GetOrder(id)
 
 	if err == nil && order.Status != "pending" {
 		return &order, nil
@@ -344,7 +387,7 @@ func GetOrder(id string, attempt ...int) (*cb.Order, error) {
 // CancelOrder is a recursive function that cancels an order equal to the given id.
 func CancelOrder(id string, attempt ...int) error {
 
-	err := client.CancelOrder(id)
+	err := exchange.CancelOrder(id)
 	if err == nil {
 		return nil
 	}
@@ -359,83 +402,22 @@ func CancelOrder(id string, attempt ...int) error {
 	return CancelOrder(id, i)
 }
 
-// GetPrice gets the latest ticker price for the given productID. This method does not perform logging as it is executed
-// thousands of times per second.
-func GetPrice(wsConn *ws.Conn, productID string) (*float64, error) {
-
-	if err := wsConn.WriteJSON(&cb.Message{
-		Type:     "subscribe",
-		Channels: []cb.MessageChannel{{"ticker", []string{productID}}},
-	}); err != nil {
-		return nil, err
-	}
-
-	var receivedMessage cb.Message
-	for {
-		if err := wsConn.ReadJSON(&receivedMessage); err != nil {
-			return nil, err
-		}
-		if receivedMessage.Type != "subscriptions" {
-			break
-		}
-	}
-
-	if receivedMessage.Type != "ticker" {
-		err := fmt.Errorf("message type != ticker, %v", receivedMessage)
-		return nil, err
-	}
-
-	f, err := strconv.ParseFloat(receivedMessage.Price, 64)
-	return &f, err
-}
-
+// GetRate returns the next one minute rate of the given product from the market data hub.
 func GetRate(productID string) (*Rate, error) {
 
-	var wsDialer ws.Dialer
-	wsConn, _, err := wsDialer.Dial("wss://ws-feed.pro.coinbase.com", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	defer func(wsConn *ws.Conn) {
-		if err := wsConn.Close(); err != nil {
-		}
-	}(wsConn)
-
-	end := time.Now().Add(time.Minute)
-
-	var low, high, open, vol float64
-	for {
+	rates, cancel := SubscribeRates(productID)
+	defer cancel()
 
-		price, err := GetPrice(wsConn, productID)
-		if err != nil {
-			return nil, err
-		}
-
-		vol++
-
-		if low == 0 {
-			low = *price
-			high = *price
-			open = *price
-		} else if high < *price {
-			high = *price
-		} else if low > *price {
-			low = *price
-		}
-
-		if now := time.Now(); now.After(end) {
-			return &Rate{
-				now.UnixNano(),
-				productID,
-				cb.HistoricRate{now, low, high, open, *price, vol},
-			}, nil
-		}
+	rate, ok := <-rates
+	if !ok {
+		return nil, ErrHubStopped
 	}
+
+	return &rate, nil
 }
 
 func GetTickerPrice(productID string) (*float64, error) {
-	ticker, err := client.GetTicker(productID)
+	ticker, err := exchange.GetTicker(productID)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,194 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	coinbaseUrl          = "https://api.pro.coinbase.com"
+	coinbaseSandboxUrl   = "https://api-public.sandbox.pro.coinbase.com"
+	coinbaseWebsocketUrl = "wss://ws-feed.pro.coinbase.com"
+)
+
+// coinbase is the Coinbase Pro implementation of Exchange.
+type coinbase struct {
+	client *cb.Client
+	wsUrl  string
+}
+
+// NewCoinbase returns a Coinbase Pro Exchange for the given urls and api credentials.
+func NewCoinbase(baseUrl, wsUrl, key, passphrase, secret string) Exchange {
+	c := new(coinbase)
+	c.wsUrl = wsUrl
+	c.client = &cb.Client{
+		BaseURL:    baseUrl,
+		Secret:     secret,
+		Key:        key,
+		Passphrase: passphrase,
+		HTTPClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+	return c
+}
+
+func (c *coinbase) GetTime() (cb.ServerTime, error) {
+	return c.client.GetTime()
+}
+
+func (c *coinbase) GetProducts() ([]cb.Product, error) {
+	return c.client.GetProducts()
+}
+
+func (c *coinbase) GetHistoricRates(productID string, params cb.GetHistoricRatesParams) ([]cb.HistoricRate, error) {
+	return c.client.GetHistoricRates(productID, params)
+}
+
+func (c *coinbase) GetTicker(productID string) (cb.Ticker, error) {
+	return c.client.GetTicker(productID)
+}
+
+func (c *coinbase) GetFills(productID string) ([]cb.Fill, error) {
+	return c.GetFillsAfter(productID, 0)
+}
+
+// GetFillsAfter pages through fills newest first, and stops at the first page reaching the given trade id.
+func (c *coinbase) GetFillsAfter(productID string, tradeID int) ([]cb.Fill, error) {
+
+	cursor := c.client.ListFills(cb.ListFillsParams{ProductID: productID})
+
+	var newChunks, allChunks []cb.Fill
+	for cursor.HasMore {
+
+		if err := cursor.NextPage(&newChunks); err != nil {
+			return nil, err
+		}
+
+		reached := false
+		for _, chunk := range newChunks {
+			if chunk.TradeID <= tradeID {
+				reached = true
+				continue
+			}
+			allChunks = append(allChunks, chunk)
+		}
+		if reached {
+			break
+		}
+	}
+
+	return allChunks, nil
+}
+
+func (c *coinbase) GetOrders(productID string) ([]cb.Order, error) {
+
+	cursor := c.client.ListOrders(cb.ListOrdersParams{ProductID: productID})
+
+	var newChunks, allChunks []cb.Order
+	for cursor.HasMore {
+
+		if err := cursor.NextPage(&newChunks); err != nil {
+			return nil, err
+		}
+
+		for _, chunk := range newChunks {
+			allChunks = append(allChunks, chunk)
+		}
+	}
+
+	return allChunks, nil
+}
+
+func (c *coinbase) GetAccounts() ([]cb.Account, error) {
+	return c.client.GetAccounts()
+}
+
+func (c *coinbase) CreateOrder(order *cb.Order) (cb.Order, error) {
+	return c.client.CreateOrder(order)
+}
+
+func (c *coinbase) GetOrder(id string) (cb.Order, error) {
+	return c.client.GetOrder(id)
+}
+
+func (c *coinbase) CancelOrder(id string) error {
+	return c.client.CancelOrder(id)
+}
+
+func (c *coinbase) NewFeed(productIDs []string) (Feed, error) {
+	var wsDialer ws.Dialer
+	wsConn, _, err := wsDialer.Dial(c.wsUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	feed := &coinbaseFeed{wsConn: wsConn}
+	if err := feed.Subscribe(productIDs); err != nil {
+		_ = wsConn.Close()
+		return nil, err
+	}
+	return feed, nil
+}
+
+// coinbaseFeed is a Feed backed by a single Coinbase Pro websocket connection.
+type coinbaseFeed struct {
+	mu     sync.Mutex
+	wsConn *ws.Conn
+}
+
+// Subscribe sends a single subscribe message for the ticker, matches and level2 channels of the given products.
+func (f *coinbaseFeed) Subscribe(productIDs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wsConn.WriteJSON(&cb.Message{
+		Type: "subscribe",
+		Channels: []cb.MessageChannel{
+			{Name: "ticker", ProductIds: productIDs},
+			{Name: "matches", ProductIds: productIDs},
+			{Name: "level2", ProductIds: productIDs},
+		},
+	})
+}
+
+// Message gets the next message of the feed. This method does not perform logging as it is executed thousands of
+// times per second.
+func (f *coinbaseFeed) Message() (cb.Message, error) {
+	for {
+		var receivedMessage cb.Message
+		if err := f.wsConn.ReadJSON(&receivedMessage); err != nil {
+			return receivedMessage, err
+		}
+		if receivedMessage.Type == "error" {
+			return receivedMessage, fmt.Errorf("%s, %s", receivedMessage.Message, receivedMessage.Reason)
+		}
+		if receivedMessage.Type != "subscriptions" {
+			return receivedMessage, nil
+		}
+	}
+}
+
+func (f *coinbaseFeed) Close() error {
+	return f.wsConn.Close()
+}
@@ -0,0 +1,78 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	MarketEntry = "market"
+	LimitEntry  = "limit"
+)
+
+// IsLimitEntry returns true if entries are post-only limit buys, and an error if the entry is unknown.
+func (p *Pattern) IsLimitEntry() (bool, error) {
+	switch p.Entry {
+	case "", MarketEntry:
+		return false, nil
+	case LimitEntry:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown entry [%s]", p.Entry)
+}
+
+// RepriceFor returns how long a limit entry follows the best bid before it is cancelled.
+func (p *Pattern) RepriceFor() time.Duration {
+	if p.Reprice <= 0 {
+		return time.Minute
+	}
+	return time.Duration(p.Reprice) * time.Second
+}
+
+// LimitPrice returns the price of a limit entry, Offset below the given best bid.
+func (p *Pattern) LimitPrice(bid float64) float64 {
+	return bid * (1 - p.Offset)
+}
+
+// NewPostOnlyBuyOrder returns a post-only limit buy at the limit price of the given best bid, for the size of the given
+// sized market buy order. Limit orders can't be placed with funds, so a funds order is sized at the limit price.
+func (p *Pattern) NewPostOnlyBuyOrder(bid float64, sized *cb.Order) *cb.Order {
+
+	price := p.LimitPrice(bid)
+
+	size := sized.Size
+	if size == "" {
+		size = strconv.FormatFloat(util.Float64(sized.Funds)/price, 'f', -1, 64)
+	}
+
+	o := new(cb.Order)
+	o.ProductID = p.ID
+	o.Side = "buy"
+	o.Type = "limit"
+	o.Price = p.PrecisePrice(price)
+	o.Size = p.PreciseSize(size)
+	o.PostOnly = true
+	o.ClientOID = sized.ClientOID
+	return o
+}
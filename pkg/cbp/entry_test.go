@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestPatternEntry(t *testing.T) {
+
+	pattern := &Pattern{ID: "BTC-USD"}
+	if limit, err := pattern.IsLimitEntry(); limit || err != nil || pattern.RepriceFor() != time.Minute {
+		t.Errorf("expected a market entry by default")
+	}
+
+	pattern.Entry = "stop"
+	if _, err := pattern.IsLimitEntry(); err == nil {
+		t.Errorf("expected an unknown entry error")
+	}
+
+	pattern.Entry, pattern.Offset, pattern.Reprice = LimitEntry, .01, 30
+	if limit, err := pattern.IsLimitEntry(); !limit || err != nil || pattern.RepriceFor() != time.Second*30 {
+		t.Errorf("expected a limit entry repriced for 30 seconds")
+	}
+
+	o := pattern.NewPostOnlyBuyOrder(100, &cb.Order{Funds: "99", ClientOID: "oid"})
+	if o.Type != "limit" || o.Side != "buy" || !o.PostOnly || o.Price != "99" || o.Size != "1" || o.ClientOID != "oid" {
+		t.Errorf("unexpected post-only order %+v", o)
+	}
+	if o.Funds != "" {
+		t.Errorf("expected a limit order without funds")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+)
+
+// Exchange defines every market data and account operation nuchal requires from a trading venue.
+// Coinbase Pro is the default implementation, alternatives may be provided with SetExchange before calling Init.
+type Exchange interface {
+
+	// GetTime returns the current exchange server time.
+	GetTime() (cb.ServerTime, error)
+
+	// GetProducts returns every product the exchange offers.
+	GetProducts() ([]cb.Product, error)
+
+	// GetHistoricRates returns candles for the given product and params.
+	GetHistoricRates(productID string, params cb.GetHistoricRatesParams) ([]cb.HistoricRate, error)
+
+	// GetTicker returns the latest ticker for the given product.
+	GetTicker(productID string) (cb.Ticker, error)
+
+	// GetFills returns every fill for the given product.
+	GetFills(productID string) ([]cb.Fill, error)
+
+	// GetFillsAfter returns every fill for the given product with a trade id above the given one.
+	GetFillsAfter(productID string, tradeID int) ([]cb.Fill, error)
+
+	// GetOrders returns every open order for the given product.
+	GetOrders(productID string) ([]cb.Order, error)
+
+	// GetAccounts returns every account in the portfolio.
+	GetAccounts() ([]cb.Account, error)
+
+	// CreateOrder submits the given order and returns the order as received by the exchange.
+	CreateOrder(order *cb.Order) (cb.Order, error)
+
+	// GetOrder returns the order equal to the given id.
+	GetOrder(id string) (cb.Order, error)
+
+	// CancelOrder cancels the order equal to the given id.
+	CancelOrder(id string) error
+
+	// NewFeed opens a single live feed of the ticker, matches and level2 channels of the given products.
+	NewFeed(productIDs []string) (Feed, error)
+}
+
+// Feed is a live feed of websocket messages for many products over a single connection.
+type Feed interface {
+
+	// Message blocks until the next message is received, subscription acknowledgements are not returned.
+	Message() (cb.Message, error)
+
+	// Subscribe adds the given products to the feed.
+	Subscribe(productIDs []string) error
+
+	// Close releases the connection.
+	Close() error
+}
+
+// PriceStream is a live feed of ticker prices for a single product.
+type PriceStream interface {
+
+	// Price blocks until the next ticker price is received.
+	Price() (*float64, error)
+
+	// Close releases any resources held by the stream.
+	Close() error
+}
+
+var exchange Exchange
+
+// SetExchange overrides the exchange used by this package, it must be called before Init.
+// Any running market data hub is stopped, as it is connected to the previous exchange.
+func SetExchange(e Exchange) {
+	StopHub()
+	exchange = e
+}
+
+// GetExchange returns the exchange used by this package.
+func GetExchange() Exchange {
+	return exchange
+}
+
+// NewPriceStream returns a feed of ticker prices for the given product, shared with the market data hub connection.
+func NewPriceStream(productID string) (PriceStream, error) {
+	prices, cancel := SubscribePrices(productID)
+	return &hubStream{prices, cancel}, nil
+}
+
+// hubStream is a PriceStream backed by a market data hub subscription.
+type hubStream struct {
+	prices <-chan float64
+	cancel func()
+}
+
+func (s *hubStream) Price() (*float64, error) {
+	price, ok := <-s.prices
+	if !ok {
+		return nil, ErrHubStopped
+	}
+	return &price, nil
+}
+
+func (s *hubStream) Close() error {
+	s.cancel()
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"errors"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+type stubExchange struct {
+	accounts []cb.Account
+	fills    []cb.Fill
+	created  *cb.Order
+	gets     int
+}
+
+func (s *stubExchange) GetTime() (cb.ServerTime, error) {
+	return cb.ServerTime{Epoch: float64(time.Now().Unix())}, nil
+}
+
+func (s *stubExchange) GetProducts() ([]cb.Product, error) {
+	return nil, nil
+}
+
+// GetHistoricRates returns a rate for every granularity of the requested page, newest first like Coinbase Pro.
+func (s *stubExchange) GetHistoricRates(_ string, p cb.GetHistoricRatesParams) ([]cb.HistoricRate, error) {
+	var rates []cb.HistoricRate
+	if p.Granularity <= 0 {
+		return rates, nil
+	}
+	for t := p.End; !t.Before(p.Start); t = t.Add(-time.Second * time.Duration(p.Granularity)) {
+		rates = append(rates, cb.HistoricRate{Time: t, Low: 1, High: 1, Open: 1, Close: 1, Volume: 1})
+	}
+	return rates, nil
+}
+
+func (s *stubExchange) GetTicker(string) (cb.Ticker, error) {
+	return cb.Ticker{Price: "2.00"}, nil
+}
+
+func (s *stubExchange) GetFills(string) ([]cb.Fill, error) {
+	return s.fills, nil
+}
+
+func (s *stubExchange) GetFillsAfter(_ string, tradeID int) ([]cb.Fill, error) {
+	return fillsAfter(s.fills, tradeID), nil
+}
+
+func (s *stubExchange) GetOrders(string) ([]cb.Order, error) {
+	return nil, nil
+}
+
+func (s *stubExchange) GetAccounts() ([]cb.Account, error) {
+	return s.accounts, nil
+}
+
+func (s *stubExchange) CreateOrder(*cb.Order) (cb.Order, error) {
+	if s.created != nil {
+		return *s.created, nil
+	}
+	return cb.Order{}, errors.New("Insufficient funds")
+}
+
+func (s *stubExchange) GetOrder(id string) (cb.Order, error) {
+	s.gets++
+	return cb.Order{ID: id, Status: "done"}, nil
+}
+
+func (s *stubExchange) CancelOrder(string) error {
+	return nil
+}
+
+func (s *stubExchange) NewFeed([]string) (Feed, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestGetTradingPositions(t *testing.T) {
+
+	SetExchange(&stubExchange{
+		accounts: []cb.Account{
+			{Currency: "USD", Balance: "100.00", Hold: "0"},
+			{Currency: "XLM", Balance: "10", Hold: "0"},
+			{Currency: "ALGO", Balance: "0", Hold: "0"},
+		},
+		fills: []cb.Fill{
+			{Side: "buy", Price: "1.00", Size: "10"},
+		},
+	})
+	defer SetExchange(nil)
+
+	positions, err := GetTradingPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(positions) != 1 {
+		t.Fatalf("expected 1 trading position, got %d", len(positions))
+	}
+
+	position, ok := positions["XLM-USD"]
+	if !ok {
+		t.Fatal("expected an XLM-USD trading position")
+	}
+
+	if position.Value() != 20 {
+		t.Errorf("expected a position value of 20, got %f", position.Value())
+	}
+
+	if trades := position.GetActiveTrades(); len(trades) != 1 {
+		t.Errorf("expected 1 active trade, got %d", len(trades))
+	}
+}
+
+func TestCreateOrderInsufficientFunds(t *testing.T) {
+
+	SetExchange(new(stubExchange))
+	defer SetExchange(nil)
+
+	if _, err := CreateOrder(new(cb.Order)); err == nil || err.Error() != "Insufficient funds" {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+}
+
+func TestCreateOrderRejected(t *testing.T) {
+
+	stub := &stubExchange{created: &cb.Order{ID: "post", Status: "rejected"}}
+	SetExchange(stub)
+	defer SetExchange(nil)
+
+	if _, err := CreateOrder(&cb.Order{PostOnly: true}); err != ErrRejected || stub.gets != 0 {
+		t.Errorf("expected a rejected order without getting it, got %v after %d gets", err, stub.gets)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	ClimbExit     = "climb"
+	GuardExit     = "guard"
+	TargetExit    = "target"
+	TrailingExit  = "trailing"
+	AtrExit       = "atr"
+	TimeExit      = "time"
+	BreakEvenExit = "breakeven"
+
+	StopFill   = "stop"
+	LimitFill  = "limit"
+	MarketFill = "market"
+)
+
+// Exit decides when, and at what price, a position entered with a pattern is sold, one rate at a time. Simulations
+// and trades share it, so both exit the same way.
+//
+//	climb     (default) once the goal is met, or break-even is met within Minutes (45), stops there and raises the
+//	          stop to every higher close, without a stop at the loss price until then
+//	guard     once the goal is met, stops at the goal and raises the stop to every higher close, and sells at
+//	          break-even after Minutes (75) if the goal was never met
+//	target    sells at the goal price
+//	trailing  stops Trail (or Loss) below the highest price since the entry
+//	atr       stops Trail (or 2) average true ranges below the highest close since the entry
+//	time      sells at the goal price, or at market after Minutes
+//	breakeven sells at the goal price, and raises the stop to break-even once a rate closes above it after Minutes
+//
+// Every exit but climb also stops at the pattern loss price.
+type Exit struct {
+	pattern *Pattern
+	opened  time.Time
+	atr     float64
+	high    float64
+	armed   bool
+
+	// Entry is the price the position was entered at, and Goal and Loss are derived from it by the pattern.
+	Entry, Goal, Loss float64
+
+	// Stop is the price of the stop order protecting the position, it only ever rises.
+	Stop float64
+
+	// Limit is the price of the limit order taking profit, or zero if the exit has none.
+	Limit float64
+}
+
+// NewExit returns the exit of a position entered at the given price and time, with the given average true range.
+func (p *Pattern) NewExit(entry, atr float64, opened time.Time) (*Exit, error) {
+
+	e := &Exit{pattern: p, opened: opened, atr: atr, high: entry}
+	e.Entry = entry
+	e.Goal = p.GoalPrice(entry)
+	e.Loss = p.LossPrice(entry)
+	e.Stop = e.Loss
+
+	switch p.Exit {
+	case "", ClimbExit:
+		e.Stop = 0
+	case GuardExit, TrailingExit, AtrExit:
+	case TargetExit, TimeExit, BreakEvenExit:
+		e.Limit = e.Goal
+	default:
+		return nil, fmt.Errorf("unknown exit [%s]", p.Exit)
+	}
+
+	e.trail(entry)
+	return e, nil
+}
+
+// Restore resumes the exit of a position protected by a stop at the given price, eg. after a restart.
+func (e *Exit) Restore(stop float64) {
+	e.Stop = math.Max(e.Stop, stop)
+	e.armed = e.armed || e.Stop >= e.Goal || (e.climb() && e.Stop > 0)
+}
+
+// BreakEven returns the price that returns the entry cost, fees included.
+func (e *Exit) BreakEven() float64 {
+	return e.Entry + e.Entry*Taker()
+}
+
+// Next updates the exit with the next rate, and returns the exit price and the kind of order filled at that price
+// when the position is sold during the rate. Otherwise, it returns an empty kind. A stop only fills once it was in
+// place before the rate, as a stop armed or raised during the rate has no order resting at it yet.
+func (e *Exit) Next(rate Rate) (float64, string) {
+
+	if e.Stop > 0 && rate.Low <= e.Stop {
+		return e.Stop, StopFill
+	}
+
+	if e.Limit > 0 && rate.High >= e.Limit {
+		return e.Limit, LimitFill
+	}
+
+	elapsed := rate.Time().Sub(e.opened) > time.Minute*time.Duration(e.minutes())
+
+	switch e.pattern.Exit {
+	case "", ClimbExit:
+		if !e.armed && rate.High >= e.Goal {
+			e.arm(e.Goal)
+		} else if !e.armed && !elapsed && rate.High >= e.BreakEven() {
+			e.arm(e.BreakEven())
+		}
+		if e.armed {
+			e.Stop = math.Max(e.Stop, rate.Close)
+		}
+	case GuardExit:
+		if rate.High >= e.Goal {
+			e.armed = true
+			e.Stop = math.Max(e.Stop, e.Goal)
+		}
+		if e.armed {
+			e.Stop = math.Max(e.Stop, rate.Close)
+		} else if elapsed && rate.High >= e.BreakEven() {
+			return e.BreakEven(), LimitFill
+		}
+	case TrailingExit:
+		e.trail(rate.High)
+	case AtrExit:
+		e.trail(rate.Close)
+	case TimeExit:
+		if elapsed {
+			return rate.Close, MarketFill
+		}
+	case BreakEvenExit:
+		if elapsed && rate.Close > e.BreakEven() {
+			e.Stop = math.Max(e.Stop, e.BreakEven())
+		}
+	}
+
+	return 0, ""
+}
+
+// arm starts a climb with a stop at the given price.
+func (e *Exit) arm(stop float64) {
+	e.armed = true
+	e.Stop = math.Max(e.Stop, stop)
+}
+
+func (e *Exit) climb() bool {
+	return e.pattern.Exit == "" || e.pattern.Exit == ClimbExit
+}
+
+// trail raises the stop of trailing exits below the given price, when it is a new high.
+func (e *Exit) trail(price float64) {
+
+	e.high = math.Max(e.high, price)
+
+	switch e.pattern.Exit {
+	case TrailingExit:
+		trail := e.pattern.Trail
+		if trail == 0 {
+			trail = e.pattern.Loss
+		}
+		e.Stop = math.Max(e.Stop, e.high-e.high*trail)
+	case AtrExit:
+		trail := e.pattern.Trail
+		if trail == 0 {
+			trail = 2
+		}
+		if e.atr > 0 {
+			e.Stop = math.Max(e.Stop, e.high-e.atr*trail)
+		}
+	}
+}
+
+func (e *Exit) minutes() int {
+	if e.pattern.Minutes > 0 {
+		return e.pattern.Minutes
+	} else if e.climb() {
+		return 45
+	}
+	return 75
+}
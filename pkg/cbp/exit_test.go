@@ -0,0 +1,106 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExitNext(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		pattern Pattern
+		atr     float64
+		rates   []Rate
+		want    float64
+		kind    string
+		index   int
+	}{
+		{"target", Pattern{Exit: TargetExit},
+			0, ohlc([4]float64{100, 105, 95, 104}, [4]float64{104, 111, 103, 108}), 110, LimitFill, 1},
+		{"climb", Pattern{},
+			0, ohlc([4]float64{99, 99.5, 95, 99}, [4]float64{99, 112, 98, 111}, [4]float64{111, 115, 111.5, 114},
+				[4]float64{114, 114, 112, 113}), 114, StopFill, 3},
+		{"climb at break-even", Pattern{Exit: ClimbExit},
+			0, ohlc([4]float64{100, 101, 95, 96}, [4]float64{96, 97, 95, 96}), 100, StopFill, 1},
+		{"climb armed below the close", Pattern{Exit: ClimbExit},
+			0, ohlc([4]float64{100, 111, 99, 105}, [4]float64{110.5, 112, 110.5, 111}), 0, "", 1},
+		{"climb without a loss stop", Pattern{Exit: ClimbExit, Minutes: 1},
+			0, ohlc([4]float64{99, 99.5, 85, 88}, [4]float64{88, 99, 80, 90}, [4]float64{90, 100.5, 89, 99}), 0, "", 2},
+		{"guard", Pattern{Exit: GuardExit},
+			0, ohlc([4]float64{100, 105, 95, 104}, [4]float64{104, 112, 103, 111}, [4]float64{111, 115, 111.5, 114},
+				[4]float64{114, 114, 112, 113}), 114, StopFill, 3},
+		{"guard break-even", Pattern{Exit: GuardExit, Minutes: 1},
+			0, ohlc([4]float64{100, 101, 95, 96}, [4]float64{96, 97, 95, 96}, [4]float64{96, 100.5, 95, 96}), 100, LimitFill, 2},
+		{"guard at the loss", Pattern{Exit: GuardExit},
+			0, ohlc([4]float64{100, 101, 99, 100}, [4]float64{100, 100, 85, 88}), 90, StopFill, 1},
+		{"trailing", Pattern{Exit: TrailingExit, Trail: .05},
+			0, ohlc([4]float64{100, 120, 99, 118}, [4]float64{118, 119, 113, 115}), 114, StopFill, 1},
+		{"atr", Pattern{Exit: AtrExit},
+			5, ohlc([4]float64{100, 108, 95, 107}, [4]float64{107, 107, 96, 100}), 97, StopFill, 1},
+		{"time", Pattern{Exit: TimeExit, Minutes: 2},
+			0, ohlc([4]float64{100, 101, 99, 100}, [4]float64{100, 101, 99, 100}, [4]float64{100, 101, 99, 100},
+				[4]float64{100, 103, 99, 102}), 102, MarketFill, 3},
+		{"breakeven", Pattern{Exit: BreakEvenExit, Minutes: 1},
+			0, ohlc([4]float64{100, 101, 99, 100}, [4]float64{100, 103, 99, 102}, [4]float64{102, 104, 101, 103},
+				[4]float64{103, 103, 99, 99}), 100, StopFill, 3},
+		{"trailing at the loss", Pattern{Exit: TrailingExit},
+			0, ohlc([4]float64{100, 101, 99, 100}, [4]float64{100, 100, 85, 88}), 90.9, StopFill, 1},
+		{"loss", Pattern{Exit: TargetExit},
+			0, ohlc([4]float64{100, 101, 99, 100}, [4]float64{100, 100, 85, 88}), 90, StopFill, 1},
+	}
+
+	for _, tt := range tests {
+
+		tt.pattern.Gain, tt.pattern.Loss = .1, .1
+
+		exit, err := tt.pattern.NewExit(100, tt.atr, time.Unix(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var price float64
+		var kind string
+		var index int
+		for index = range tt.rates {
+			if price, kind = exit.Next(tt.rates[index]); kind != "" {
+				break
+			}
+		}
+
+		if price != tt.want || kind != tt.kind || index != tt.index {
+			t.Errorf("%s exit = %f %s at %d, want %f %s at %d", tt.name, price, kind, index, tt.want, tt.kind, tt.index)
+		}
+	}
+
+	climb := &Pattern{Gain: .1, Loss: .1}
+	exit, _ := climb.NewExit(100, 0, time.Unix(0, 0))
+	if exit.Restore(112); exit.Stop != 112 {
+		t.Errorf("restored stop = %f, want 112", exit.Stop)
+	}
+	if price, kind := exit.Next(ohlc([4]float64{111, 111.5, 111, 111.2})[0]); kind != StopFill || price != 112 {
+		t.Errorf("expected a restored climb to stop at its stop, got %f %s", price, kind)
+	}
+
+	if _, err := (&Pattern{Exit: "parachute"}).NewExit(100, 0, time.Unix(0, 0)); err == nil {
+		t.Error("expected an unknown exit error")
+	}
+}
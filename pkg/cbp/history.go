@@ -0,0 +1,113 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"sync"
+	"time"
+)
+
+// MaxCandles is the most rates Coinbase Pro returns for a single historic rates request.
+const MaxCandles = 300
+
+// historicInterval spaces historic rate requests under the Coinbase Pro public rate limit.
+var historicInterval = time.Second / 3
+
+var (
+	throttleMu sync.Mutex
+	throttled  time.Time
+)
+
+// throttle blocks until the next historic rates request is allowed.
+func throttle() {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	if wait := time.Until(throttled.Add(historicInterval)); wait > 0 {
+		time.Sleep(wait)
+	}
+	throttled = time.Now()
+}
+
+// RatePages splits the time from alpha up to and including omega into historic rate requests of the given granularity in seconds,
+// each under the Coinbase Pro limit of MaxCandles rates. Both ends of a request are inclusive, so requests don't
+// overlap.
+func RatePages(alpha, omega time.Time, granularity int) []cb.GetHistoricRatesParams {
+	var pages []cb.GetHistoricRatesParams
+	step := time.Duration(granularity) * time.Second
+	for start := alpha; !start.After(omega); start = start.Add(step * MaxCandles) {
+		end := start.Add(step * (MaxCandles - 1))
+		if end.After(omega) {
+			end = omega
+		}
+		pages = append(pages, cb.GetHistoricRatesParams{Start: start, End: end, Granularity: granularity})
+	}
+	return pages
+}
+
+// GetRatesBetween returns every historic rate of the given product and granularity in seconds between alpha and omega,
+// paging through requests under the Coinbase Pro limit of MaxCandles rates.
+func GetRatesBetween(productID string, alpha, omega time.Time, granularity int) ([]Rate, error) {
+	pages := RatePages(alpha, omega, granularity)
+	return GetRates(productID, &pages)
+}
+
+// RateTable returns the name of the table rates of the given granularity in seconds are stored in. Minute rates are
+// stored in the rates table, and the rates of every other granularity in a table of their own.
+func RateTable(granularity int) string {
+	if granularity == Minute {
+		return "rates"
+	}
+	return fmt.Sprintf("rates_%d", granularity)
+}
+
+// Gap is a span of missing rates, from the time of the first missing rate up to, but excluding, Omega.
+type Gap struct {
+	Alpha, Omega time.Time
+}
+
+// Gaps returns every span between alpha and omega without a rate of the given granularity in seconds, given rates
+// sorted oldest first.
+func Gaps(rates []Rate, alpha, omega time.Time, granularity int) []Gap {
+
+	step := time.Duration(granularity) * time.Second
+	next := alpha.Truncate(step)
+	if next.Before(alpha) {
+		next = next.Add(step)
+	}
+
+	var gaps []Gap
+	for _, rate := range rates {
+		t := rate.Time()
+		if t.Before(next) {
+			continue
+		}
+		if t.After(next) {
+			gaps = append(gaps, Gap{next, t})
+		}
+		next = t.Add(step)
+	}
+
+	if next.Before(omega) {
+		gaps = append(gaps, Gap{next, omega})
+	}
+
+	return gaps
+}
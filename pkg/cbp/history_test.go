@@ -0,0 +1,98 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestRatePages(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// a week of minutes is 10080 rates, or 34 requests of at most 300
+	pages := RatePages(alpha, alpha.Add(time.Hour*24*7-time.Minute), Minute)
+	if len(pages) != 34 {
+		t.Fatalf("expected 34 pages, got %d", len(pages))
+	}
+	for i, page := range pages {
+		if n := int(page.End.Sub(page.Start)/time.Minute) + 1; n > MaxCandles {
+			t.Errorf("page %d has %d rates", i, n)
+		}
+		if i > 0 && page.Start != pages[i-1].End.Add(time.Minute) {
+			t.Errorf("page %d doesn't follow the last", i)
+		}
+	}
+
+	if pages := RatePages(alpha, alpha, 300); len(pages) != 1 || pages[0].Granularity != 300 {
+		t.Errorf("expected a single rate page, got %v", pages)
+	}
+}
+
+func TestGetRatesBetween(t *testing.T) {
+
+	SetExchange(new(stubExchange))
+	defer SetExchange(nil)
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	rates, err := GetRatesBetween("ALGO-USD", alpha, alpha.Add(time.Minute*699), Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 700 {
+		t.Fatalf("expected 700 rates, got %d", len(rates))
+	}
+	for i := 1; i < len(rates); i++ {
+		if rates[i-1].Unix >= rates[i].Unix {
+			t.Fatalf("expected the oldest rate first, rate %d is out of order", i)
+		}
+	}
+}
+
+func TestGaps(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var rates []Rate
+	for _, minute := range []int{0, 1, 4, 5} {
+		rates = append(rates, *NewRate("BTC-USD", cb.HistoricRate{Time: alpha.Add(time.Minute * time.Duration(minute))}))
+	}
+
+	minute := func(m int) time.Time {
+		return alpha.Add(time.Minute * time.Duration(m))
+	}
+
+	gaps := Gaps(rates, alpha, minute(8), Minute)
+	if len(gaps) != 2 ||
+		!gaps[0].Alpha.Equal(minute(2)) || !gaps[0].Omega.Equal(minute(4)) ||
+		!gaps[1].Alpha.Equal(minute(6)) || !gaps[1].Omega.Equal(minute(8)) {
+		t.Errorf("unexpected gaps %v", gaps)
+	}
+
+	if gaps := Gaps(nil, alpha.Add(time.Second), alpha.Add(time.Minute*2), Minute); len(gaps) != 1 ||
+		!gaps[0].Alpha.Equal(alpha.Add(time.Minute)) {
+		t.Errorf("expected a gap from the first whole minute, got %v", gaps)
+	}
+
+	if RateTable(Minute) != "rates" || RateTable(300) != "rates_300" {
+		t.Errorf("unexpected rate tables")
+	}
+}
@@ -0,0 +1,406 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"errors"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// hubBackoff is the first delay before reconnecting a dropped feed, doubled for every failed attempt.
+	hubBackoff = time.Second
+
+	// hubMaxBackoff is the longest delay between reconnection attempts.
+	hubMaxBackoff = time.Minute
+)
+
+var (
+	// ErrHubStopped is returned when the market data hub is stopped while waiting on it.
+	ErrHubStopped = errors.New("market data hub stopped")
+
+	hubMu      sync.Mutex
+	defaultHub *hub
+)
+
+// hub keeps a single feed connection for every subscribed product, reconnecting with backoff when it drops, and fans
+// out ticker prices and rates built from matches to any number of subscribers.
+type hub struct {
+	mu       sync.Mutex
+	feed     Feed
+	done     chan bool
+	clock    time.Time // time of the latest message, which closes the rates of quiet products
+	products map[string]bool
+	prices   map[string]map[chan float64]bool
+	rates    map[candleKey]map[chan Rate]bool
+	candles  map[candleKey]*Candles
+	books    map[string]*Book
+	last     map[string]float64
+}
+
+// candleKey identifies the rates of a product at a granularity.
+type candleKey struct {
+	productID   string
+	granularity int
+}
+
+func newHub() *hub {
+	return &hub{
+		done:     make(chan bool),
+		products: map[string]bool{},
+		prices:   map[string]map[chan float64]bool{},
+		rates:    map[candleKey]map[chan Rate]bool{},
+		candles:  map[candleKey]*Candles{},
+		books:    map[string]*Book{},
+		last:     map[string]float64{},
+	}
+}
+
+// getHub returns the market data hub, connecting it to the given product if it is new.
+func getHub(productID string) *hub {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+	if defaultHub == nil {
+		defaultHub = newHub()
+		defaultHub.products[productID] = true
+		go defaultHub.run()
+	}
+	defaultHub.subscribe(productID)
+	return defaultHub
+}
+
+// StartHub connects the market data hub to the given products up front, rather than on first subscription.
+func StartHub(productIDs []string) {
+	for _, productID := range productIDs {
+		getHub(productID)
+	}
+}
+
+// StopHub closes the market data hub connection and every subscriber channel.
+func StopHub() {
+
+	hubMu.Lock()
+	h := defaultHub
+	defaultHub = nil
+	hubMu.Unlock()
+
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	close(h.done)
+	if h.feed != nil {
+		_ = h.feed.Close()
+	}
+	for _, subscribers := range h.prices {
+		for ch := range subscribers {
+			close(ch)
+		}
+	}
+	for _, subscribers := range h.rates {
+		for ch := range subscribers {
+			close(ch)
+		}
+	}
+	h.prices = map[string]map[chan float64]bool{}
+	h.rates = map[candleKey]map[chan Rate]bool{}
+}
+
+// SubscribePrices returns a channel of every ticker price of the given product and a function that unsubscribes it.
+// Prices are dropped rather than queued for subscribers that fall behind.
+func SubscribePrices(productID string) (<-chan float64, func()) {
+
+	h := getHub(productID)
+	ch := make(chan float64, 64)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopped() {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.prices[productID] == nil {
+		h.prices[productID] = map[chan float64]bool{}
+	}
+	h.prices[productID][ch] = true
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.prices[productID][ch] {
+			delete(h.prices[productID], ch)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeRates returns a channel of the one minute rates of the given product, each sent once its minute has
+// passed, and a function that unsubscribes it.
+func SubscribeRates(productID string) (<-chan Rate, func()) {
+	ch, cancel, _ := SubscribeCandles(productID, Minute)
+	return ch, cancel
+}
+
+// SubscribeCandles returns a channel of the rates of the given product and granularity in seconds, built from matches
+// and sent once their period has passed, and a function that unsubscribes it.
+func SubscribeCandles(productID string, granularity int) (<-chan Rate, func(), error) {
+
+	key := candleKey{productID, granularity}
+	candles, err := NewCandles(productID, granularity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := getHub(productID)
+	ch := make(chan Rate, 16)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopped() {
+		close(ch)
+		return ch, func() {}, nil
+	}
+	if h.rates[key] == nil {
+		h.rates[key] = map[chan Rate]bool{}
+	}
+	if h.candles[key] == nil {
+		h.candles[key] = candles
+	}
+	h.rates[key][ch] = true
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.rates[key][ch] {
+			delete(h.rates[key], ch)
+			close(ch)
+		}
+	}, nil
+}
+
+// LastPrice returns the most recent ticker price of the given product received by the market data hub, and false if
+// none has been received yet. The product is subscribed so later calls have a live price.
+func LastPrice(productID string) (float64, bool) {
+	h := getHub(productID)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	price, ok := h.last[productID]
+	return price, ok
+}
+
+// GetBook returns a copy of the level 2 order book of the given product, and false until the hub has received its
+// snapshot. The product is subscribed so later calls have a live book.
+func GetBook(productID string) (*Book, bool) {
+	h := getHub(productID)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	book, ok := h.books[productID]
+	if !ok {
+		return nil, false
+	}
+	return book.Clone(), true
+}
+
+// stopped returns true once StopHub has been called, the caller must hold the lock.
+func (h *hub) stopped() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// subscribe adds the given product to the live feed, if not already subscribed.
+func (h *hub) subscribe(productID string) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.products[productID] {
+		return
+	}
+	h.products[productID] = true
+
+	if h.feed == nil {
+		return // subscribed when connected
+	}
+	if err := h.feed.Subscribe([]string{productID}); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... hub", util.Shark, util.GetCurrency(productID))
+		_ = h.feed.Close() // reconnects with every product
+	}
+}
+
+func (h *hub) productIDs() []string {
+	var productIDs []string
+	for productID := range h.products {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Strings(productIDs)
+	return productIDs
+}
+
+// missing returns the subscribed products not in the given products the feed was dialed with, the caller must hold
+// the lock.
+func (h *hub) missing(productIDs []string) []string {
+	dialed := map[string]bool{}
+	for _, productID := range productIDs {
+		dialed[productID] = true
+	}
+	var missing []string
+	for _, productID := range h.productIDs() {
+		if !dialed[productID] {
+			missing = append(missing, productID)
+		}
+	}
+	return missing
+}
+
+// run connects the feed and dispatches its messages until the hub is stopped, reconnecting with exponential backoff.
+func (h *hub) run() {
+
+	backoff := hubBackoff
+
+	for {
+
+		h.mu.Lock()
+		if h.stopped() {
+			h.mu.Unlock()
+			return
+		}
+		productIDs := h.productIDs()
+		h.mu.Unlock()
+
+		feed, err := exchange.NewFeed(productIDs)
+		if err == nil {
+			h.mu.Lock()
+			if h.stopped() {
+				h.mu.Unlock()
+				_ = feed.Close()
+				return
+			}
+			h.feed = feed
+			if missing := h.missing(productIDs); len(missing) > 0 {
+				// subscribed while the feed was dialed
+				if err := feed.Subscribe(missing); err != nil {
+					log.Warn().Err(err).Msgf("%s ... hub", util.Shark)
+					_ = feed.Close() // reconnects with every product
+				}
+			}
+			h.mu.Unlock()
+
+			for {
+				var message cb.Message
+				if message, err = feed.Message(); err != nil {
+					break
+				}
+				backoff = hubBackoff
+				h.dispatch(message)
+			}
+
+			h.mu.Lock()
+			h.feed = nil
+			h.books = map[string]*Book{} // stale until the next snapshot
+			h.mu.Unlock()
+			_ = feed.Close()
+		}
+
+		log.Warn().Err(err).Msgf("%s ... hub ... reconnecting in %s", util.Shark, backoff)
+
+		select {
+		case <-h.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > hubMaxBackoff {
+			backoff = hubMaxBackoff
+		}
+	}
+}
+
+// dispatch fans out ticker prices, applies level2 messages to order books, and folds matches into rates, sending each rate once its period has passed by the
+// time of the latest message. Subscribers that fall behind miss messages rather than blocking the feed.
+func (h *hub) dispatch(message cb.Message) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t := message.Time.Time(); t.After(h.clock) {
+		h.clock = t
+	}
+
+	switch message.Type {
+
+	case "ticker":
+		price := util.Float64(message.Price)
+		h.last[message.ProductID] = price
+		for ch := range h.prices[message.ProductID] {
+			select {
+			case ch <- price:
+			default:
+			}
+		}
+
+	case "snapshot":
+		book := NewBook(message.ProductID)
+		book.Apply(message)
+		h.books[message.ProductID] = book
+
+	case "l2update":
+		if book, ok := h.books[message.ProductID]; ok {
+			book.Apply(message)
+		}
+
+	case "match":
+		for _, granularity := range Granularities {
+			key := candleKey{message.ProductID, granularity}
+			if candles := h.candles[key]; candles != nil {
+				h.send(key, candles.Add(message))
+			}
+		}
+	}
+
+	for key, candles := range h.candles {
+		h.send(key, candles.Flush(h.clock))
+	}
+}
+
+// send sends the given rate, if any, to every subscriber of the given key, the caller must hold the lock.
+func (h *hub) send(key candleKey, rate *Rate) {
+	if rate == nil {
+		return
+	}
+	for ch := range h.rates[key] {
+		select {
+		case ch <- *rate:
+		default:
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"errors"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+// feedExchange is a stubExchange whose feeds are handed to the test as they are dialed.
+type feedExchange struct {
+	stubExchange
+	feeds chan *stubFeed
+}
+
+func (e *feedExchange) NewFeed(productIDs []string) (Feed, error) {
+	feed := &stubFeed{productIDs: productIDs, messages: make(chan cb.Message, 16)}
+	e.feeds <- feed
+	return feed, nil
+}
+
+type stubFeed struct {
+	once       sync.Once
+	productIDs []string
+	messages   chan cb.Message
+}
+
+func (f *stubFeed) Message() (cb.Message, error) {
+	message, ok := <-f.messages
+	if !ok {
+		return message, errors.New("closed")
+	}
+	return message, nil
+}
+
+func (f *stubFeed) Subscribe(productIDs []string) error {
+	f.productIDs = append(f.productIDs, productIDs...)
+	return nil
+}
+
+func (f *stubFeed) Close() error {
+	f.once.Do(func() {
+		close(f.messages)
+	})
+	return nil
+}
+
+func match(minute int, price, size string) cb.Message {
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	return cb.Message{
+		Type:      "match",
+		ProductID: "BTC-USD",
+		Time:      cb.Time(alpha.Add(time.Minute*time.Duration(minute) + time.Second)),
+		Price:     price,
+		Size:      size,
+	}
+}
+
+func TestHub(t *testing.T) {
+
+	e := &feedExchange{feeds: make(chan *stubFeed, 4)}
+	SetExchange(e)
+	defer StopHub()
+
+	prices, cancelPrices := SubscribePrices("BTC-USD")
+	defer cancelPrices()
+	rates, cancelRates := SubscribeRates("BTC-USD")
+	defer cancelRates()
+
+	feed := <-e.feeds
+	if len(feed.productIDs) != 1 || feed.productIDs[0] != "BTC-USD" {
+		t.Fatalf("expected a single BTC-USD subscription, got %v", feed.productIDs)
+	}
+
+	feed.messages <- cb.Message{Type: "ticker", ProductID: "BTC-USD", Price: "1.5"}
+	if price := <-prices; price != 1.5 {
+		t.Errorf("expected a ticker price of 1.5, got %f", price)
+	}
+	if price, ok := LastPrice("BTC-USD"); !ok || price != 1.5 {
+		t.Errorf("expected a last price of 1.5, got %f", price)
+	}
+
+	for _, message := range []cb.Message{
+		match(0, "1", "1"),
+		match(0, "2", "1"),
+		match(0, ".5", "2"),
+		match(0, ".75", "1"),
+		match(1, "3", "1"),
+	} {
+		feed.messages <- message
+	}
+
+	rate := <-rates
+	if rate.Open != 1 || rate.High != 2 || rate.Low != .5 || rate.Close != .75 || rate.Volume != 5 {
+		t.Errorf("unexpected rate %+v", rate.HistoricRate)
+	}
+	if !rate.Time().Equal(time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the rate aligned to the minute, got %s", rate.Time())
+	}
+
+	feed.messages <- cb.Message{
+		Type:      "snapshot",
+		ProductID: "BTC-USD",
+		Bids:      []cb.SnapshotEntry{{Price: "2.9", Size: "1"}},
+		Asks:      []cb.SnapshotEntry{{Price: "3.1", Size: "1"}},
+	}
+	feed.messages <- cb.Message{Type: "ticker", ProductID: "BTC-USD", Price: "3"}
+	<-prices // the snapshot is applied before the ticker is sent
+
+	if book, ok := GetBook("BTC-USD"); !ok || book.Mid() != 3 {
+		t.Errorf("expected a book with a mid price of 3")
+	}
+
+	_ = feed.Close()
+
+	select {
+	case feed = <-e.feeds:
+	case <-time.After(hubBackoff * 3):
+		t.Fatal("expected the hub to reconnect")
+	}
+	if len(feed.productIDs) != 1 {
+		t.Errorf("expected the reconnected feed to resubscribe, got %v", feed.productIDs)
+	}
+	if _, ok := GetBook("BTC-USD"); ok {
+		t.Errorf("expected the book to be dropped with the connection")
+	}
+
+	feed.messages <- cb.Message{Type: "ticker", ProductID: "BTC-USD", Price: "2"}
+	if price := <-prices; price != 2 {
+		t.Errorf("expected a ticker price of 2 after reconnecting, got %f", price)
+	}
+
+	StopHub()
+
+	if _, ok := <-prices; ok {
+		t.Errorf("expected the price channel to close with the hub")
+	}
+}
+
+// dialExchange is a feedExchange which blocks every dial until it is released.
+type dialExchange struct {
+	feedExchange
+	dialing, release chan bool
+}
+
+func (e *dialExchange) NewFeed(productIDs []string) (Feed, error) {
+	e.dialing <- true
+	<-e.release
+	return e.feedExchange.NewFeed(productIDs)
+}
+
+func TestHubSubscribeWhileDialing(t *testing.T) {
+
+	e := &dialExchange{
+		feedExchange: feedExchange{feeds: make(chan *stubFeed, 4)},
+		dialing:      make(chan bool),
+		release:      make(chan bool),
+	}
+	SetExchange(e)
+	defer StopHub()
+
+	h := getHub("BTC-USD")
+	<-e.dialing
+	getHub("ETH-USD")
+	close(e.release)
+
+	// the feed is dialed with BTC-USD alone, and ETH-USD is subscribed once it connects
+	feed := <-e.feeds
+	deadline := time.Now().Add(time.Second)
+	for {
+		h.mu.Lock()
+		productIDs := append([]string{}, feed.productIDs...)
+		h.mu.Unlock()
+		if len(productIDs) == 2 && productIDs[0] == "BTC-USD" && productIDs[1] == "ETH-USD" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected ETH-USD subscribed once the feed connected, got %v", productIDs)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,331 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+const (
+	FIFO       = "fifo"
+	LIFO       = "lifo"
+	SpecificID = "specific"
+)
+
+// Lot is a buy fill, and the size of it not yet sold. The buy fee is spread over the lot size, so every sale of the
+// lot carries its share.
+type Lot struct {
+	Method    string `gorm:"primaryKey"`
+	ProductID string `gorm:"primaryKey"`
+	TradeID   int    `gorm:"primaryKey;autoIncrement:false"`
+	OrderID   string `gorm:"index"`
+	Opened    time.Time
+	Price     float64
+	Size      float64
+	Fee       float64
+	Remaining float64
+}
+
+// Cost returns the cost of the given size of the lot, including its share of the buy fee.
+func (l Lot) Cost(size float64) float64 {
+	if l.Size == 0 {
+		return 0
+	}
+	return size*l.Price + l.Fee*size/l.Size
+}
+
+// Disposal is the part of a lot sold by a sell fill, and the profit or loss it realized after both fees.
+type Disposal struct {
+	Method      string `gorm:"primaryKey"`
+	ProductID   string `gorm:"primaryKey"`
+	SellTradeID int    `gorm:"primaryKey;autoIncrement:false"`
+	LotTradeID  int    `gorm:"primaryKey;autoIncrement:false"`
+	Sold        time.Time
+	Size        float64
+	Price       float64
+	Cost        float64
+	Proceeds    float64
+	Fees        float64
+	Realized    float64
+}
+
+// Day is the profit or loss realized by the sales of a UTC day.
+type Day struct {
+	Date     string
+	Sales    int
+	Fees     float64
+	Realized float64
+}
+
+// Ledger matches buy and sell fills into lots by the FIFO, LIFO or specific ID method. Specific ID sells the lots
+// of the buy order identified for the sell order, and anything left over FIFO.
+type Ledger struct {
+	Method    string
+	Lots      []*Lot
+	Disposals []Disposal
+
+	// Unmatched is the size of every product sold beyond its lots, eg. bought before the fill history.
+	Unmatched map[string]float64
+
+	identified map[string]string
+	added      map[tradeKey]bool
+	last       map[string]int
+	changed    map[*Lot]bool
+	saved      int
+}
+
+// tradeKey identifies a fill, as trade ids are only unique within a product.
+type tradeKey struct {
+	productID string
+	tradeID   int
+}
+
+// NewLedger returns an empty ledger of the given lot method.
+func NewLedger(method string) (*Ledger, error) {
+	if method == "" {
+		method = FIFO
+	} else if method != FIFO && method != LIFO && method != SpecificID {
+		return nil, fmt.Errorf("unknown lot method [%s], expected %s, %s or %s", method, FIFO, LIFO, SpecificID)
+	}
+	return &Ledger{
+		Method:     method,
+		Unmatched:  map[string]float64{},
+		identified: map[string]string{},
+		added:      map[tradeKey]bool{},
+		last:       map[string]int{},
+		changed:    map[*Lot]bool{},
+	}, nil
+}
+
+// Identify sells the lots of the given buy order with the given sell order, when the method is specific ID.
+func (l *Ledger) Identify(sellOrderID, buyOrderID string) {
+	l.identified[sellOrderID] = buyOrderID
+}
+
+// Last returns the highest trade id of the given product added to the ledger, or zero if it has none, so that only
+// later fills need to be fetched.
+func (l *Ledger) Last(productID string) int {
+	return l.last[productID]
+}
+
+// Add matches the given fills of a product, in the order they were made, skipping fills already added.
+func (l *Ledger) Add(fills []cb.Fill) {
+
+	sorted := append([]cb.Fill{}, fills...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := sorted[i].CreatedAt.Time(), sorted[j].CreatedAt.Time(); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return sorted[i].TradeID < sorted[j].TradeID
+	})
+
+	for _, fill := range sorted {
+		if k := (tradeKey{fill.ProductID, fill.TradeID}); l.added[k] {
+			continue
+		} else {
+			l.added[k] = true
+		}
+		if fill.TradeID > l.last[fill.ProductID] {
+			l.last[fill.ProductID] = fill.TradeID
+		}
+		if fill.Side == "buy" {
+			l.buy(fill)
+		} else if fill.Side == "sell" {
+			l.sell(fill)
+		}
+	}
+}
+
+func (l *Ledger) buy(fill cb.Fill) {
+	size := util.Float64(fill.Size)
+	lot := &Lot{
+		Method:    l.Method,
+		ProductID: fill.ProductID,
+		TradeID:   fill.TradeID,
+		OrderID:   fill.FillID,
+		Opened:    fill.CreatedAt.Time(),
+		Price:     util.Float64(fill.Price),
+		Size:      size,
+		Fee:       util.Float64(fill.Fee),
+		Remaining: size,
+	}
+	l.Lots = append(l.Lots, lot)
+	l.changed[lot] = true
+}
+
+func (l *Ledger) sell(fill cb.Fill) {
+
+	size := util.Float64(fill.Size)
+	price := util.Float64(fill.Price)
+	fee := util.Float64(fill.Fee)
+
+	left := size
+	for _, lot := range l.order(fill) {
+		if left <= 0 {
+			break
+		}
+		sold := lot.Remaining
+		if sold > left {
+			sold = left
+		}
+		lot.Remaining -= sold
+		left -= sold
+		l.changed[lot] = true
+
+		d := Disposal{
+			Method:      l.Method,
+			ProductID:   fill.ProductID,
+			SellTradeID: fill.TradeID,
+			LotTradeID:  lot.TradeID,
+			Sold:        fill.CreatedAt.Time(),
+			Size:        sold,
+			Price:       price,
+			Cost:        lot.Cost(sold),
+			Proceeds:    sold*price - fee*sold/size,
+			Fees:        lot.Fee*sold/lot.Size + fee*sold/size,
+		}
+		d.Realized = d.Proceeds - d.Cost
+		l.Disposals = append(l.Disposals, d)
+	}
+
+	if left > 0 {
+		l.Unmatched[fill.ProductID] += left
+	}
+}
+
+// order returns the open lots of the fill product in the order the method sells them.
+func (l *Ledger) order(fill cb.Fill) []*Lot {
+
+	var identified, open []*Lot
+	buyOrderID := l.identified[fill.FillID]
+	for _, lot := range l.Lots {
+		if lot.ProductID != fill.ProductID || lot.Remaining <= 0 {
+			continue
+		}
+		if l.Method == SpecificID && buyOrderID != "" && lot.OrderID == buyOrderID {
+			identified = append(identified, lot)
+		} else {
+			open = append(open, lot)
+		}
+	}
+
+	if l.Method == LIFO {
+		for i, j := 0, len(open)-1; i < j; i, j = i+1, j-1 {
+			open[i], open[j] = open[j], open[i]
+		}
+	}
+
+	return append(identified, open...)
+}
+
+// Open returns the lots of the given product not yet sold, oldest first.
+func (l *Ledger) Open(productID string) []*Lot {
+	var lots []*Lot
+	for _, lot := range l.Lots {
+		if lot.ProductID == productID && lot.Remaining > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	return lots
+}
+
+// Realized returns the profit or loss realized by every sale of the given product, after fees.
+func (l *Ledger) Realized(productID string) float64 {
+	var realized float64
+	for _, d := range l.Disposals {
+		if d.ProductID == productID {
+			realized += d.Realized
+		}
+	}
+	return realized
+}
+
+// Unrealized returns the profit or loss of selling the open lots of the given product at the given price, after
+// the buy fees and the taker fee of the sale.
+func (l *Ledger) Unrealized(productID string, price float64) float64 {
+	var unrealized float64
+	for _, lot := range l.Open(productID) {
+		unrealized += lot.Remaining*price*(1-Taker()) - lot.Cost(lot.Remaining)
+	}
+	return unrealized
+}
+
+// Days returns the profit or loss realized by every UTC day with a sale, oldest first.
+func (l *Ledger) Days() []Day {
+
+	days := map[string]*Day{}
+	sold := map[tradeKey]bool{}
+	for _, d := range l.Disposals {
+		date := d.Sold.UTC().Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &Day{Date: date}
+			days[date] = day
+		}
+		if k := (tradeKey{d.ProductID, d.SellTradeID}); !sold[k] {
+			sold[k] = true
+			day.Sales++
+		}
+		day.Fees += d.Fees
+		day.Realized += d.Realized
+	}
+
+	var out []Day
+	for _, day := range days {
+		out = append(out, *day)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Date < out[j].Date
+	})
+
+	return out
+}
+
+// Save writes every lot and disposal added or changed since the last save, replacing those written by an earlier run
+// of the same method.
+func (l *Ledger) Save(pg *gorm.DB) error {
+
+	var lots []*Lot
+	for _, lot := range l.Lots {
+		if l.changed[lot] {
+			lots = append(lots, lot)
+		}
+	}
+
+	if len(lots) > 0 {
+		if err := pg.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(lots, 500).Error; err != nil {
+			return err
+		}
+	}
+	if disposals := l.Disposals[l.saved:]; len(disposals) > 0 {
+		if err := pg.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(disposals, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	l.changed = map[*Lot]bool{}
+	l.saved = len(l.Disposals)
+	return nil
+}
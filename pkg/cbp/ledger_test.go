@@ -0,0 +1,169 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"github.com/glebarez/sqlite"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"gorm.io/gorm"
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ledgerFills returns two buys and a sell across two days, newest first as Coinbase Pro lists them.
+func ledgerFills() []cb.Fill {
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	fill := func(id int, orderID, side string, price, size, fee float64, at time.Duration) cb.Fill {
+		return cb.Fill{
+			TradeID:   id,
+			ProductID: "ALGO-USD",
+			FillID:    orderID,
+			Side:      side,
+			Price:     strconv.FormatFloat(price, 'f', -1, 64),
+			Size:      strconv.FormatFloat(size, 'f', -1, 64),
+			Fee:       strconv.FormatFloat(fee, 'f', -1, 64),
+			CreatedAt: cb.Time(alpha.Add(at)),
+		}
+	}
+	return []cb.Fill{
+		fill(4, "sell-2", "sell", 1.4, 5, .07, time.Hour*24),
+		fill(3, "sell-1", "sell", 1.2, 10, .12, time.Hour),
+		fill(2, "buy-2", "buy", 1.1, 10, .11, time.Minute),
+		fill(1, "buy-1", "buy", 1, 10, .1, 0),
+	}
+}
+
+func TestLedgerFIFO(t *testing.T) {
+
+	l, err := NewLedger("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(ledgerFills())
+	l.Add(ledgerFills()) // added twice
+
+	if len(l.Disposals) != 2 {
+		t.Fatalf("expected 2 disposals, got %d", len(l.Disposals))
+	}
+
+	// 10 of buy-1 at 1 sold at 1.2, then 5 of buy-2 at 1.1 sold at 1.4, after every fee.
+	first := 12 - .12 - (10 + .1)
+	second := 7 - .07 - (5.5 + .055)
+	if realized := l.Realized("ALGO-USD"); math.Abs(realized-(first+second)) > 1e-9 {
+		t.Errorf("expected %f realized, got %f", first+second, realized)
+	}
+
+	open := l.Open("ALGO-USD")
+	if len(open) != 1 || open[0].OrderID != "buy-2" || open[0].Remaining != 5 {
+		t.Fatalf("expected 5 of buy-2 to be open, got %+v", open)
+	}
+	if unrealized := l.Unrealized("ALGO-USD", 1.5); math.Abs(unrealized-(7.5-5.5-.055)) > 1e-9 {
+		t.Errorf("expected %f unrealized, got %f", 7.5-5.5-.055, unrealized)
+	}
+
+	days := l.Days()
+	if len(days) != 2 || days[0].Date != "2021-06-02" || days[1].Date != "2021-06-03" {
+		t.Fatalf("expected two days, got %+v", days)
+	}
+	if days[0].Sales != 1 || math.Abs(days[0].Realized-first) > 1e-9 || math.Abs(days[0].Fees-.22) > 1e-9 {
+		t.Errorf("unexpected first day %+v", days[0])
+	}
+}
+
+func TestLedgerLIFO(t *testing.T) {
+
+	l, err := NewLedger(LIFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(ledgerFills())
+
+	open := l.Open("ALGO-USD")
+	if len(open) != 1 || open[0].OrderID != "buy-1" || open[0].Remaining != 5 {
+		t.Fatalf("expected 5 of buy-1 to be open, got %+v", open)
+	}
+	if d := l.Disposals[0]; d.LotTradeID != 2 || math.Abs(d.Realized-(12-.12-11.11)) > 1e-9 {
+		t.Errorf("expected the first sell to close buy-2, got %+v", d)
+	}
+}
+
+func TestLedgerSpecificID(t *testing.T) {
+
+	l, err := NewLedger(SpecificID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Identify("sell-1", "buy-2")
+	l.Add(ledgerFills())
+
+	if d := l.Disposals[0]; d.SellTradeID != 3 || d.LotTradeID != 2 || d.Size != 10 {
+		t.Errorf("expected sell-1 to close buy-2, got %+v", d)
+	}
+	if d := l.Disposals[1]; d.SellTradeID != 4 || d.LotTradeID != 1 || d.Size != 5 {
+		t.Errorf("expected sell-2 to fall back to buy-1, got %+v", d)
+	}
+
+	if _, err := NewLedger("average"); err == nil {
+		t.Error("expected an unknown lot method to fail")
+	}
+}
+
+func TestLedgerUnmatched(t *testing.T) {
+
+	l, _ := NewLedger(FIFO)
+	fills := ledgerFills()
+	l.Add(fills[:3]) // buy-1 is older than the fill history
+
+	if l.Unmatched["ALGO-USD"] != 5 {
+		t.Errorf("expected 5 sold beyond the lots, got %f", l.Unmatched["ALGO-USD"])
+	}
+	if len(l.Open("ALGO-USD")) != 0 {
+		t.Error("expected every lot to be sold")
+	}
+}
+
+func TestLedgerSave(t *testing.T) {
+
+	pg, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ledger.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.AutoMigrate(&Lot{}, &Disposal{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		l, _ := NewLedger(FIFO)
+		l.Add(ledgerFills())
+		if err := l.Save(pg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lots []Lot
+	var disposals []Disposal
+	pg.Order("trade_id asc").Find(&lots)
+	pg.Find(&disposals)
+	if len(lots) != 2 || len(disposals) != 2 || lots[0].Remaining != 0 || lots[1].Remaining != 5 {
+		t.Errorf("expected the lots and disposals once, got %+v and %+v", lots, disposals)
+	}
+}
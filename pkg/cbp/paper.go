@@ -0,0 +1,441 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paper is a simulated Coinbase Pro account. It holds balances, open orders and fills, and settles orders against
+// whatever prices it is given, charging maker fees for resting orders and taker fees for orders that execute at once.
+type Paper struct {
+
+	// Maker and Taker are the fees applied to fills.
+	Maker, Taker float64
+
+	// Run identifies the paper trading session fills are persisted with.
+	Run string
+
+	mu       sync.Mutex
+	sequence int
+	balances map[string]float64
+	holds    map[string]float64
+	orders   map[string]*cb.Order
+	fills    []cb.Fill
+	pg       *gorm.DB
+}
+
+// PaperFill is a persisted Paper fill, used to compare paper trading results with simulation predictions.
+type PaperFill struct {
+	gorm.Model
+	Run       string `gorm:"index"`
+	OrderID   string
+	ProductID string `gorm:"index"`
+	Side      string
+	Price     float64
+	Size      float64
+	Fee       float64
+	Liquidity string
+}
+
+// NewPaper returns a Paper account with the given USD balance. Fills are persisted when pg is not nil.
+func NewPaper(usd, maker, taker float64, pg *gorm.DB) *Paper {
+	p := new(Paper)
+	p.Maker = maker
+	p.Taker = taker
+	p.Run = time.Now().UTC().Format(time.RFC3339)
+	p.balances = map[string]float64{"USD": usd}
+	p.holds = map[string]float64{}
+	p.orders = map[string]*cb.Order{}
+	p.pg = pg
+	return p
+}
+
+// CreateOrder validates, holds and, when the order crosses the given price, fills the given order.
+func (p *Paper) CreateOrder(order *cb.Order, price float64) (cb.Order, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if order.Side != "buy" && order.Side != "sell" {
+		return cb.Order{}, errors.New("Invalid side")
+	} else if price <= 0 {
+		return cb.Order{}, errors.New("Invalid price")
+	}
+
+	p.sequence++
+	o := *order
+	o.ID = fmt.Sprintf("paper-%d", p.sequence)
+	o.CreatedAt = cb.Time(time.Now().UTC().Truncate(time.Microsecond))
+	if o.Type == "" {
+		o.Type = "limit"
+	}
+
+	base := currency(o.ProductID)
+	size := util.Float64(o.Size)
+
+	if o.Type == "market" {
+		if o.Side == "buy" && size == 0 {
+			size = util.Float64(o.Funds) / (1 + p.Taker) / price
+		}
+		if err := p.available(o.Side, base, price, size, p.Taker); err != nil {
+			return cb.Order{}, err
+		}
+		p.orders[o.ID] = &o
+		p.fill(&o, price, size, p.Taker, "T")
+		return o, nil
+	}
+
+	limit := util.Float64(o.Price)
+	if err := p.available(o.Side, base, limit, size, p.Maker); err != nil {
+		return cb.Order{}, err
+	}
+
+	p.orders[o.ID] = &o
+	o.Status = "open"
+
+	if o.Stop == "" && crosses(o.Side, price, limit) {
+		if o.PostOnly {
+			o.Status = "rejected"
+			o.DoneReason = "post only"
+			return o, nil
+		}
+		p.fill(&o, price, size, p.Taker, "T")
+		return o, nil
+	}
+
+	p.hold(&o, 1)
+	return o, nil
+}
+
+// Match fills every open order for the given product which is triggered by the given price.
+func (p *Paper) Match(productID string, price float64) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, order := range p.orders {
+
+		if order.Status != "open" || order.ProductID != productID {
+			continue
+		}
+
+		limit := util.Float64(order.Price)
+		stop := util.Float64(order.StopPrice)
+
+		var triggered bool
+		switch order.Stop {
+		case "loss":
+			triggered = price <= stop
+		case "entry":
+			triggered = price >= stop
+		default:
+			triggered = crosses(order.Side, price, limit)
+		}
+
+		if triggered {
+			p.hold(order, -1)
+			p.fill(order, limit, util.Float64(order.Size), p.Maker, "M")
+		}
+	}
+}
+
+// CancelOrder cancels the open order equal to the given id.
+func (p *Paper) CancelOrder(id string) error {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, ok := p.orders[id]
+	if !ok {
+		return cb.Error{Message: "NotFound"}
+	} else if order.Status != "open" {
+		return errors.New("Order already done")
+	}
+
+	p.hold(order, -1)
+	order.Status = "done"
+	order.DoneReason = "canceled"
+	return nil
+}
+
+// GetOrder returns the order equal to the given id, or to the given client order id when prefixed with "client:".
+func (p *Paper) GetOrder(id string) (cb.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if order, ok := p.orders[id]; ok {
+		return *order, nil
+	}
+	if oid := strings.TrimPrefix(id, "client:"); oid != id {
+		for _, order := range p.orders {
+			if order.ClientOID == oid {
+				return *order, nil
+			}
+		}
+	}
+	return cb.Order{}, cb.Error{Message: "NotFound"}
+}
+
+// GetOrders returns every open order for the given product, or every product when productID is empty.
+func (p *Paper) GetOrders(productID string) []cb.Order {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orders := make([]cb.Order, 0)
+	for _, order := range p.orders {
+		if order.Status != "open" || productID != "" && order.ProductID != productID {
+			continue
+		}
+		orders = append(orders, *order)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Time().Before(orders[j].CreatedAt.Time())
+	})
+	return orders
+}
+
+// GetFills returns fills for the given product and order, newest first. Empty arguments match everything.
+func (p *Paper) GetFills(productID, orderID string) []cb.Fill {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fills := make([]cb.Fill, 0)
+	for i := len(p.fills) - 1; i >= 0; i-- {
+		fill := p.fills[i]
+		if productID != "" && fill.ProductID != productID || orderID != "" && fill.FillID != orderID {
+			continue
+		}
+		fills = append(fills, fill)
+	}
+	return fills
+}
+
+// GetAccounts returns an account for every currency the paper account has held.
+func (p *Paper) GetAccounts() []cb.Account {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	accounts := make([]cb.Account, 0, len(p.balances))
+	for currency, balance := range p.balances {
+		accounts = append(accounts, cb.Account{
+			ID:        currency,
+			Currency:  currency,
+			Balance:   fmt.Sprintf("%f", balance),
+			Hold:      fmt.Sprintf("%f", p.holds[currency]),
+			Available: fmt.Sprintf("%f", balance-p.holds[currency]),
+		})
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].Currency < accounts[j].Currency
+	})
+	return accounts
+}
+
+// Fund sets the balance of the given currency, eg. to seed a paper account with USD.
+func (p *Paper) Fund(currency string, balance float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balances[currency] = balance
+}
+
+// crosses returns true if a limit order on the given side would execute at the given price.
+func crosses(side string, price, limit float64) bool {
+	if side == "buy" {
+		return price <= limit
+	}
+	return price >= limit
+}
+
+// currency returns the base currency of the given product.
+func currency(productID string) string {
+	return strings.Split(productID, "-")[0]
+}
+
+// available returns an insufficient funds error if the order cannot be paid for from available balances.
+func (p *Paper) available(side, base string, price, size, fee float64) error {
+	if side == "buy" && p.balances["USD"]-p.holds["USD"] < price*size*(1+fee) {
+		return errors.New("Insufficient funds")
+	}
+	if side == "sell" && p.balances[base]-p.holds[base] < size {
+		return errors.New("Insufficient funds")
+	}
+	return nil
+}
+
+// hold places, or when sign is negative releases, the balance hold required by the given open order.
+func (p *Paper) hold(order *cb.Order, sign float64) {
+	size := util.Float64(order.Size)
+	if order.Side == "buy" {
+		p.holds["USD"] += sign * util.Float64(order.Price) * size * (1 + p.Maker)
+	} else {
+		p.holds[currency(order.ProductID)] += sign * size
+	}
+}
+
+// fill settles the order at the given price and records a fill with the given fee rate and liquidity.
+func (p *Paper) fill(order *cb.Order, price, size, rate float64, liquidity string) {
+
+	base := currency(order.ProductID)
+	value := price * size
+	fee := value * rate
+
+	if order.Side == "buy" {
+		p.balances["USD"] -= value + fee
+		p.balances[base] += size
+	} else {
+		p.balances["USD"] += value - fee
+		p.balances[base] -= size
+	}
+
+	order.Size = fmt.Sprintf("%f", size)
+	order.Status = "done"
+	order.DoneReason = "filled"
+	order.Settled = true
+	order.FilledSize = order.Size
+	order.ExecutedValue = fmt.Sprintf("%f", value)
+	order.FillFees = fmt.Sprintf("%f", fee)
+
+	p.sequence++
+	p.fills = append(p.fills, cb.Fill{
+		TradeID:   p.sequence,
+		ProductID: order.ProductID,
+		Price:     fmt.Sprintf("%f", price),
+		Size:      order.Size,
+		FillID:    order.ID,
+		CreatedAt: cb.Time(time.Now().UTC().Truncate(time.Microsecond)),
+		Fee:       order.FillFees,
+		Settled:   true,
+		Side:      order.Side,
+		Liquidity: liquidity,
+	})
+
+	if p.pg != nil {
+		if err := p.pg.Create(&PaperFill{
+			Run:       p.Run,
+			OrderID:   order.ID,
+			ProductID: order.ProductID,
+			Side:      order.Side,
+			Price:     price,
+			Size:      size,
+			Fee:       fee,
+			Liquidity: liquidity,
+		}).Error; err != nil {
+			// the fill is settled regardless, only the comparison with simulations misses it
+			log.Error().Err(err).Str("order", order.ID).Msgf("%s ... %5s ... paper", util.Shark, util.GetCurrency(order.ProductID))
+		}
+	}
+}
+
+// paperExchange is an Exchange which reads market data from a live exchange and settles orders on a Paper account.
+type paperExchange struct {
+	Exchange
+	paper *Paper
+}
+
+// IsPaper returns true if orders are filled by a Paper account.
+func IsPaper() bool {
+	_, ok := exchange.(*paperExchange)
+	return ok
+}
+
+// NewPaperExchange returns an Exchange that delegates market data to the given live exchange and fills every order
+// against the given Paper account, using live ticker prices.
+func NewPaperExchange(live Exchange, paper *Paper) Exchange {
+	return &paperExchange{live, paper}
+}
+
+func (e *paperExchange) GetTicker(productID string) (cb.Ticker, error) {
+	ticker, err := e.Exchange.GetTicker(productID)
+	if err == nil {
+		e.paper.Match(productID, util.Float64(ticker.Price))
+	}
+	return ticker, err
+}
+
+func (e *paperExchange) GetFills(productID string) ([]cb.Fill, error) {
+	return e.paper.GetFills(productID, ""), nil
+}
+
+func (e *paperExchange) GetFillsAfter(productID string, tradeID int) ([]cb.Fill, error) {
+	return fillsAfter(e.paper.GetFills(productID, ""), tradeID), nil
+}
+
+func (e *paperExchange) GetOrders(productID string) ([]cb.Order, error) {
+	return e.paper.GetOrders(productID), nil
+}
+
+func (e *paperExchange) GetAccounts() ([]cb.Account, error) {
+	return e.paper.GetAccounts(), nil
+}
+
+// CreateOrder fills market buys at the best ask and market sells at the best bid, when the ticker provides them.
+func (e *paperExchange) CreateOrder(order *cb.Order) (cb.Order, error) {
+
+	ticker, err := e.Exchange.GetTicker(order.ProductID)
+	if err != nil {
+		return cb.Order{}, err
+	}
+
+	price := util.Float64(ticker.Price)
+	if order.Side == "buy" && ticker.Ask != "" {
+		price = util.Float64(ticker.Ask)
+	} else if order.Side == "sell" && ticker.Bid != "" {
+		price = util.Float64(ticker.Bid)
+	}
+
+	return e.paper.CreateOrder(order, price)
+}
+
+func (e *paperExchange) GetOrder(id string) (cb.Order, error) {
+	return e.paper.GetOrder(id)
+}
+
+func (e *paperExchange) CancelOrder(id string) error {
+	return e.paper.CancelOrder(id)
+}
+
+func (e *paperExchange) NewFeed(productIDs []string) (Feed, error) {
+	feed, err := e.Exchange.NewFeed(productIDs)
+	if err != nil {
+		return nil, err
+	}
+	return &paperFeed{feed, e.paper}, nil
+}
+
+// paperFeed matches open Paper orders against every ticker price it receives.
+type paperFeed struct {
+	Feed
+	paper *Paper
+}
+
+func (f *paperFeed) Message() (cb.Message, error) {
+	message, err := f.Feed.Message()
+	if err == nil && message.Type == "ticker" {
+		if price := util.Float64(message.Price); price > 0 {
+			f.paper.Match(message.ProductID, price)
+		}
+	}
+	return message, err
+}
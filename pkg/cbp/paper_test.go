@@ -0,0 +1,83 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+)
+
+func TestPaper(t *testing.T) {
+
+	paper := NewPaper(100, .004, .006, nil)
+
+	buy, err := paper.CreateOrder(&cb.Order{ProductID: "XLM-USD", Side: "buy", Type: "market", Size: "10"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if buy.Status != "done" || util.Float64(buy.FillFees) != .12 {
+		t.Errorf("expected a filled buy with a taker fee of .12, got %s %s", buy.Status, buy.FillFees)
+	}
+
+	stop, err := paper.CreateOrder(&cb.Order{
+		ProductID: "XLM-USD",
+		Side:      "sell",
+		Type:      "limit",
+		Size:      "10",
+		Price:     "1.90",
+		Stop:      "loss",
+		StopPrice: "1.90",
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if stop.Status != "open" {
+		t.Fatalf("expected an open stop order, got %s", stop.Status)
+	}
+
+	if _, err := paper.CreateOrder(&cb.Order{ProductID: "XLM-USD", Side: "sell", Type: "market", Size: "1"}, 2); err == nil {
+		t.Error("expected held balance to be unavailable")
+	}
+
+	paper.Match("XLM-USD", 1.95)
+	if order, _ := paper.GetOrder(stop.ID); order.Status != "open" {
+		t.Errorf("expected the stop order to remain open above the stop price")
+	}
+
+	paper.Match("XLM-USD", 1.89)
+	if order, _ := paper.GetOrder(stop.ID); order.Status != "done" {
+		t.Errorf("expected the stop order to fill below the stop price")
+	}
+
+	var usd float64
+	for _, account := range paper.GetAccounts() {
+		if account.Currency == "USD" {
+			usd = util.Float64(account.Balance)
+		}
+	}
+
+	// 100 - 20 - .12 + 19 - .076
+	if math.Abs(usd-98.804) > .000001 {
+		t.Errorf("expected a USD balance of 98.804, got %f", usd)
+	}
+
+	if fills := paper.GetFills("XLM-USD", ""); len(fills) != 2 || fills[0].Liquidity != "M" {
+		t.Errorf("expected 2 fills, newest first")
+	}
+}
@@ -22,7 +22,6 @@ import (
 	"fmt"
 	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"github.com/rs/zerolog/log"
-	"math"
 	"strconv"
 	"strings"
 )
@@ -42,8 +41,60 @@ type Pattern struct {
 	// Size is the amount of the transaction, using the products native quote increment.
 	Size float64 `yaml:"size" json:"size"`
 
-	// Delta is the size of an acceptable difference between tweezer bottom candlesticks.
+	// Delta is the size of an acceptable difference between candlestick prices expected to be equal.
 	Delta float64 `yaml:"delta" json:"delta"`
+
+	// Type is the name of the candlestick used to match rates, defaults to tweezer.
+	Type string `yaml:"type" json:"type"`
+
+	// Confirm are indicator conditions, eg. "rsi(14) < 30", that must all hold before a candlestick match is traded.
+	Confirm []string `yaml:"confirm,omitempty" json:"confirm,omitempty" gorm:"-"`
+
+	// Sizing is how entry orders are sized, one of base (default), usd, percent, atr or kelly.
+	Sizing string `yaml:"sizing,omitempty" json:"sizing,omitempty"`
+
+	// Usd is the entry notional of usd sizing, and the amount risked per average true range of atr sizing.
+	Usd float64 `yaml:"usd,omitempty" json:"usd,omitempty"`
+
+	// Percent is the fraction of the available USD balance entered with percent sizing.
+	Percent float64 `yaml:"percent,omitempty" json:"percent,omitempty"`
+
+	// WinRate is the fraction of winning trades, eg. from a simulation, used by kelly sizing.
+	WinRate float64 `yaml:"win_rate,omitempty" json:"win_rate,omitempty"`
+
+	// Kelly scales the kelly fraction, eg. .5 for half kelly, defaults to 1.
+	Kelly float64 `yaml:"kelly,omitempty" json:"kelly,omitempty"`
+
+	// Exit is how positions are sold, one of climb (default), guard, target, trailing, atr, time or breakeven.
+	Exit string `yaml:"exit,omitempty" json:"exit,omitempty"`
+
+	// Trail is the fraction below the high a trailing exit stops at, or the average true ranges of an atr exit.
+	Trail float64 `yaml:"trail,omitempty" json:"trail,omitempty"`
+
+	// Minutes is when a time exit sells at market, when guard and breakeven exits settle for break-even, and until when
+	// a climb exit starts at break-even.
+	Minutes int `yaml:"minutes,omitempty" json:"minutes,omitempty"`
+
+	// Granularity is the seconds of every rate traded live, one of 60 (default), 300, 900 or 3600.
+	Granularity int `yaml:"granularity,omitempty" json:"granularity,omitempty"`
+
+	// Spread is the widest bid-ask spread, as a fraction of the mid price, an entry is placed at. Zero is unlimited.
+	Spread float64 `yaml:"spread,omitempty" json:"spread,omitempty"`
+
+	// Impact is the largest estimated market impact of an entry, as a fraction of the mid price. Zero is unlimited.
+	Impact float64 `yaml:"impact,omitempty" json:"impact,omitempty"`
+
+	// Entry is how entries are placed, one of market (default) or limit, a post-only limit buy at the best bid.
+	Entry string `yaml:"entry,omitempty" json:"entry,omitempty"`
+
+	// Offset is the fraction below the best bid a limit entry is placed at.
+	Offset float64 `yaml:"offset,omitempty" json:"offset,omitempty"`
+
+	// Reprice is the seconds a limit entry follows the best bid before it is cancelled, defaults to 60.
+	Reprice int `yaml:"reprice,omitempty" json:"reprice,omitempty"`
+
+	// Fallback buys at market when a limit entry is cancelled without filling.
+	Fallback bool `yaml:"fallback,omitempty" json:"fallback,omitempty"`
 }
 
 func (p *Pattern) InitPattern(size, gain, loss, delta float64) {
@@ -59,6 +110,34 @@ func (p *Pattern) InitPattern(size, gain, loss, delta float64) {
 	if p.Delta == 0 {
 		p.Delta = delta
 	}
+	if p.Type == "" {
+		p.Type = TweezerBottom
+	}
+}
+
+// Candlestick returns the candlestick defined by the pattern type.
+func (p *Pattern) Candlestick() (Candlestick, bool) {
+	if p.Type == "" {
+		return GetCandlestick(TweezerBottom)
+	}
+	return GetCandlestick(p.Type)
+}
+
+// Window returns the amount of rates required to match the pattern candlestick.
+func (p *Pattern) Window() int {
+	if candlestick, ok := p.Candlestick(); ok {
+		return candlestick.Window
+	}
+	return 0
+}
+
+// Matches returns true if the most recent rates of the given series, oldest first, print the pattern candlestick.
+func (p *Pattern) Matches(rates []Rate) bool {
+	candlestick, ok := p.Candlestick()
+	if !ok || candlestick.Window < 1 || len(rates) < candlestick.Window {
+		return false
+	}
+	return candlestick.Matches(rates[len(rates)-candlestick.Window:], p.Delta)
 }
 
 func (p *Pattern) GoalPrice(price float64) float64 {
@@ -123,15 +202,6 @@ func (p *Pattern) NewLimitLossOrder(price float64, size string) *cb.Order {
 	return o
 }
 
-func (p *Pattern) MatchesTweezerBottomPattern(then, that, this Rate) bool {
-	return then.IsInit() &&
-		then.IsDown() &&
-		that.IsInit() &&
-		that.IsDown() &&
-		this.IsUp() &&
-		math.Abs(math.Min(that.Low, that.Close)-math.Min(this.Low, this.Open)) <= p.Delta
-}
-
 func (p *Pattern) PreciseSize(s string) string {
 	f, err := strconv.ParseFloat(s, 64)
 	if err != nil {
@@ -155,8 +225,11 @@ func (p *Pattern) PrecisePriceFromString(s string) string {
 }
 
 func preciseResult(c string, f float64) string {
+	if c == "" {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
 	if !strings.Contains(c, `.`) {
-		return c
+		return fmt.Sprintf("%.0f", f)
 	}
 	chunks := strings.Split(c, `.`)
 	format := fmt.Sprintf("%s.%df", "%", len(chunks[1]))
@@ -0,0 +1,125 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"strconv"
+)
+
+const (
+	BaseSizing    = "base"
+	UsdSizing     = "usd"
+	PercentSizing = "percent"
+	AtrSizing     = "atr"
+	KellySizing   = "kelly"
+)
+
+// EntrySize returns the base currency size of an entry at the given price, for the given available USD balance and
+// average true range. Simulations and trades share this function, so both size entries the same way.
+//
+//	base    is Size, or the product base min size if larger
+//	usd     is a fixed Usd notional
+//	percent is Percent of the balance
+//	atr     risks Usd per average true range, so volatile products trade smaller
+//	kelly   is the kelly fraction of the balance, from WinRate and the Gain to Loss ratio, scaled by Kelly, or base
+//	        until a WinRate is known
+func (p *Pattern) EntrySize(price, balance, atr float64) (float64, error) {
+
+	if price <= 0 {
+		return 0, fmt.Errorf("invalid price [%f]", price)
+	}
+
+	min := util.Float64(GetProduct(p.ID).BaseMinSize)
+
+	var size float64
+	switch p.sizing() {
+	case BaseSizing:
+		size = math.Max(min, p.Size)
+	case UsdSizing:
+		size = p.Usd / price
+	case PercentSizing:
+		size = balance * p.Percent / price
+	case AtrSizing:
+		if atr <= 0 {
+			return 0, fmt.Errorf("atr sizing requires an average true range")
+		}
+		size = p.Usd / atr
+	case KellySizing:
+		size = balance * p.KellyFraction() / price
+	default:
+		return 0, fmt.Errorf("unknown sizing [%s]", p.Sizing)
+	}
+
+	if size <= 0 || size < min {
+		return 0, fmt.Errorf("%s size [%f] is less than the base min size [%f]", p.ID, size, min)
+	}
+
+	return size, nil
+}
+
+// sizing returns the sizing mode entries are sized with. Kelly sizing without a win rate, eg. before optimize has
+// simulated one, falls back to base sizing rather than sizing every entry at zero.
+func (p *Pattern) sizing() string {
+	if p.Sizing == "" || (p.Sizing == KellySizing && p.WinRate <= 0) {
+		return BaseSizing
+	}
+	return p.Sizing
+}
+
+// KellyFraction returns the fraction of the balance to enter, from the win rate and the gain to loss ratio.
+func (p *Pattern) KellyFraction() float64 {
+	if p.WinRate <= 0 || p.Gain <= 0 || p.Loss <= 0 {
+		return 0
+	}
+	k := p.Kelly
+	if k == 0 {
+		k = 1
+	}
+	f := p.WinRate - (1-p.WinRate)/(p.Gain/p.Loss)
+	return math.Max(0, math.Min(1, f*k))
+}
+
+// NewSizedMarketBuyOrder returns a market buy order sized with EntrySize. Usd sizing creates a funds order, so the
+// notional is exact, while every other mode creates a size order.
+func (p *Pattern) NewSizedMarketBuyOrder(price, balance, atr float64) (*cb.Order, error) {
+
+	if p.sizing() == BaseSizing {
+		return p.NewMarketBuyOrder(), nil
+	}
+
+	size, err := p.EntrySize(price, balance, atr)
+	if err != nil {
+		return nil, err
+	}
+
+	o := new(cb.Order)
+	o.ProductID = p.ID
+	o.Side = "buy"
+	o.Type = "market"
+	if p.Sizing == UsdSizing {
+		o.Funds = preciseResult(GetProduct(p.ID).QuoteIncrement, p.Usd)
+	} else {
+		o.Size = p.PreciseSize(strconv.FormatFloat(size, 'f', -1, 64))
+	}
+	return o, nil
+}
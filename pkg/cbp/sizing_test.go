@@ -0,0 +1,116 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package cbp
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+)
+
+func sizingProduct() {
+	products["BTC-USD"] = NewProduct(cb.Product{
+		BaseCurrency:   "BTC",
+		QuoteCurrency:  "USD",
+		BaseMinSize:    "0.001",
+		QuoteIncrement: "0.01",
+	})
+}
+
+func TestPatternEntrySize(t *testing.T) {
+
+	sizingProduct()
+
+	tests := []struct {
+		name    string
+		pattern Pattern
+		atr     float64
+		want    float64
+		wantErr bool
+	}{
+		{"base", Pattern{ID: "BTC-USD", Size: .5}, 0, .5, false},
+		{"base below min", Pattern{ID: "BTC-USD", Size: .0001}, 0, .001, false},
+		{"usd", Pattern{ID: "BTC-USD", Sizing: UsdSizing, Usd: 50}, 0, .5, false},
+		{"usd below min", Pattern{ID: "BTC-USD", Sizing: UsdSizing, Usd: .05}, 0, 0, true},
+		{"percent", Pattern{ID: "BTC-USD", Sizing: PercentSizing, Percent: .1}, 0, 1, false},
+		{"atr", Pattern{ID: "BTC-USD", Sizing: AtrSizing, Usd: 10}, 4, 2.5, false},
+		{"atr without range", Pattern{ID: "BTC-USD", Sizing: AtrSizing, Usd: 10}, 0, 0, true},
+		{"kelly", Pattern{ID: "BTC-USD", Sizing: KellySizing, WinRate: .6, Gain: .02, Loss: .01, Kelly: .5}, 0, 2, false},
+		{"kelly without win rate", Pattern{ID: "BTC-USD", Sizing: KellySizing, Size: .5, Gain: .02, Loss: .01}, 0, .5, false},
+		{"kelly without edge", Pattern{ID: "BTC-USD", Sizing: KellySizing, WinRate: .2, Gain: .01, Loss: .01}, 0, 0, true},
+		{"unknown", Pattern{ID: "BTC-USD", Sizing: "martingale"}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.pattern.EntrySize(100, 1000, tt.atr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s size = %f, want %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatternKellyFraction(t *testing.T) {
+
+	tests := []struct {
+		pattern Pattern
+		want    float64
+	}{
+		{Pattern{WinRate: .6, Gain: .02, Loss: .01}, .4},
+		{Pattern{WinRate: .6, Gain: .02, Loss: .01, Kelly: .5}, .2},
+		{Pattern{WinRate: .3, Gain: .01, Loss: .01}, 0},
+		{Pattern{Gain: .02, Loss: .01}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.pattern.KellyFraction(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%+v kelly fraction = %f, want %f", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPatternNewSizedMarketBuyOrder(t *testing.T) {
+
+	sizingProduct()
+
+	usd := Pattern{ID: "BTC-USD", Sizing: UsdSizing, Usd: 25}
+	o, err := usd.NewSizedMarketBuyOrder(100, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Funds != "25.00" || o.Size != "" {
+		t.Errorf("usd order funds = %s, size = %s, want funds 25.00", o.Funds, o.Size)
+	}
+
+	percent := Pattern{ID: "BTC-USD", Sizing: PercentSizing, Percent: .05}
+	o, err = percent.NewSizedMarketBuyOrder(100, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Size != "0.500" || o.Funds != "" {
+		t.Errorf("percent order size = %s, funds = %s, want size 0.500", o.Size, o.Funds)
+	}
+
+	if _, err = percent.NewSizedMarketBuyOrder(100, 0, 0); err == nil {
+		t.Error("percent order without a balance, want an error")
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package data
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/db"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"time"
+)
+
+// NewBackfill fetches every rate of the selected products from alpha up to omega, at the given granularity in seconds,
+// that the database is missing, then reports the coverage of each product. Coinbase Pro has no rates for minutes
+// without trades, so quiet products keep gaps that can't be filled.
+func NewBackfill(session *config.Session, alpha, omega time.Time, granularity int) error {
+
+	log.Info().Msg(util.Octopus + " .")
+	log.Info().Msg(util.Octopus + " ..")
+	log.Info().Msg(util.Octopus + " ... backfill")
+	log.Info().Msg(util.Octopus + " ..")
+
+	if !cbp.IsGranularity(granularity) {
+		return fmt.Errorf("granularity %d is not one of %v", granularity, cbp.Granularities)
+	} else if !alpha.Before(omega) {
+		return fmt.Errorf("from %s is not before to %s", alpha.Format(time.RFC3339), omega.Format(time.RFC3339))
+	}
+
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+
+	for _, productID := range session.UsdSelectionProductIDs() {
+
+		have, err := store.FindCandles(productID, granularity, alpha, omega)
+		if err != nil {
+			return err
+		}
+
+		fetched, err := fill(productID, cbp.Gaps(have, alpha, omega, granularity), granularity)
+		if err != nil {
+			return err
+		}
+
+		if _, err := store.SaveCandles(granularity, fetched); err != nil {
+			return err
+		}
+
+		stored, err := store.FindCandles(productID, granularity, alpha, omega)
+		if err != nil {
+			return err
+		}
+
+		c := newCoverage(stored, alpha, omega, granularity)
+
+		log.Info().
+			Int("fetched", len(fetched)).
+			Int("rates", c.Rates).
+			Int("expected", c.Expected).
+			Str("coverage", fmt.Sprintf("%.2f%%", c.Percent())).
+			Int("gaps", len(c.Gaps)).
+			Msgf("%s ... %5s ... %s", util.Octopus, util.GetCurrency(productID), util.Check)
+	}
+
+	log.Info().Msg(util.Octopus + " .")
+
+	return nil
+}
+
+// newStore returns the store connected by the session, or db.ErrNotInitialized.
+func newStore() (db.Store, error) {
+	store := db.GetStore()
+	if store == nil {
+		return nil, db.ErrNotInitialized
+	}
+	return store, nil
+}
+
+// fill fetches the rates of every given gap, requesting each page of gapPages once, and returns those within the
+// gaps, oldest first.
+func fill(productID string, gaps []cbp.Gap, granularity int) ([]cbp.Rate, error) {
+
+	pages := gapPages(gaps, granularity)
+	if len(pages) < 1 {
+		return nil, nil
+	}
+
+	out, err := cbp.GetRates(productID, &pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []cbp.Rate
+	for _, rate := range out {
+		t := rate.Time()
+		i := sort.Search(len(gaps), func(i int) bool {
+			return gaps[i].Omega.After(t)
+		})
+		if i < len(gaps) && !t.Before(gaps[i].Alpha) {
+			rates = append(rates, rate)
+		}
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Unix < rates[j].Unix
+	})
+
+	return rates, nil
+}
+
+// gapPages returns the historic rate requests of the given gaps, oldest first, where gaps close enough to share a page
+// of cbp.MaxCandles rates are requested together, and gaps longer than a page are split over several.
+func gapPages(gaps []cbp.Gap, granularity int) []cb.GetHistoricRatesParams {
+
+	step := time.Duration(granularity) * time.Second
+	span := step * (cbp.MaxCandles - 1)
+
+	var pages []cb.GetHistoricRatesParams
+	for _, gap := range gaps {
+
+		last := gap.Omega.Add(-step)
+		for start := gap.Alpha; !start.After(last); {
+
+			if n := len(pages); n > 0 && !start.After(pages[n-1].Start.Add(span)) {
+				end := pages[n-1].Start.Add(span)
+				if end.After(last) {
+					end = last
+				}
+				pages[n-1].End = end
+				start = end.Add(step)
+				continue
+			}
+
+			end := start.Add(span)
+			if end.After(last) {
+				end = last
+			}
+			pages = append(pages, cb.GetHistoricRatesParams{Start: start, End: end, Granularity: granularity})
+			start = end.Add(step)
+		}
+	}
+
+	return pages
+}
+
+// coverage is how many of the rates expected from alpha up to omega are stored, and the gaps between them.
+type coverage struct {
+	Rates, Expected int
+	Gaps            []cbp.Gap
+}
+
+func newCoverage(rates []cbp.Rate, alpha, omega time.Time, granularity int) coverage {
+	step := time.Duration(granularity) * time.Second
+	return coverage{
+		Rates:    len(rates),
+		Expected: int(omega.Sub(alpha) / step),
+		Gaps:     cbp.Gaps(rates, alpha, omega, granularity),
+	}
+}
+
+// Percent returns the percentage of the expected rates that are stored.
+func (c coverage) Percent() float64 {
+	if c.Expected == 0 {
+		return 100
+	}
+	return float64(c.Rates) / float64(c.Expected) * 100
+}
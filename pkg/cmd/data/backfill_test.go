@@ -0,0 +1,112 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package data
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestFill(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	omega := alpha.Add(time.Minute * 1000)
+
+	var rates []cbp.Rate
+	for i := 0; i < 1000; i++ {
+		if i >= 500 && i < 510 {
+			continue // no trades
+		}
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    1,
+			High:   1,
+			Open:   1,
+			Close:  1,
+			Volume: 1,
+		}))
+	}
+
+	server := fake.NewServer(100, 0, rates)
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first and last 100 minutes are stored
+	have := append(append([]cbp.Rate{}, rates[:100]...), rates[len(rates)-100:]...)
+	gaps := cbp.Gaps(have, alpha, omega, cbp.Minute)
+	if len(gaps) != 1 {
+		t.Fatalf("expected a single gap, got %v", gaps)
+	}
+
+	fetched, err := fill("ALGO-USD", gaps, cbp.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(fetched) != 790 {
+		t.Fatalf("expected the 790 missing rates over several pages, got %d", len(fetched))
+	}
+
+	c := newCoverage(append(have, fetched...), alpha, omega, cbp.Minute)
+	if c.Rates != 990 || c.Expected != 1000 || c.Percent() != 99 {
+		t.Errorf("unexpected coverage %+v", c)
+	}
+
+	have = append(append(append([]cbp.Rate{}, have[:100]...), fetched...), have[100:]...)
+	if gaps := newCoverage(have, alpha, omega, cbp.Minute).Gaps; len(gaps) != 1 ||
+		!gaps[0].Alpha.Equal(alpha.Add(time.Minute*500)) || !gaps[0].Omega.Equal(alpha.Add(time.Minute*510)) {
+		t.Errorf("expected the minutes without trades to remain a gap, got %v", gaps)
+	}
+}
+
+func TestGapPages(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	minute := func(i int) time.Time {
+		return alpha.Add(time.Minute * time.Duration(i))
+	}
+
+	pages := gapPages([]cbp.Gap{
+		{Alpha: minute(0), Omega: minute(10)},
+		{Alpha: minute(20), Omega: minute(30)},
+		{Alpha: minute(290), Omega: minute(310)},
+		{Alpha: minute(1000), Omega: minute(1700)},
+	}, cbp.Minute)
+
+	want := [][2]int{{0, 299}, {300, 309}, {1000, 1299}, {1300, 1599}, {1600, 1699}}
+	if len(pages) != len(want) {
+		t.Fatalf("expected %d pages, got %v", len(want), pages)
+	}
+	for i, page := range pages {
+		if !page.Start.Equal(minute(want[i][0])) || !page.End.Equal(minute(want[i][1])) || page.Granularity != cbp.Minute {
+			t.Errorf("page %d = %s to %s, want minutes %d to %d", i, page.Start, page.End, want[i][0], want[i][1])
+		}
+	}
+
+	if pages := gapPages(nil, cbp.Minute); len(pages) != 0 {
+		t.Errorf("expected no pages without gaps, got %v", pages)
+	}
+}
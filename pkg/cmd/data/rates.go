@@ -0,0 +1,278 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CSV   = "csv"
+	JSONL = "jsonl"
+)
+
+// rateHeader is the header of a rates csv file, its columns may be in any order.
+var rateHeader = []string{"unix", "product_id", "open", "high", "low", "close", "volume"}
+
+// RateRecord is a rate as it is imported and exported. Unix is the rate time in seconds, while the rates table keys
+// rates by nanoseconds.
+type RateRecord struct {
+	Unix      int64   `json:"unix"`
+	ProductID string  `json:"product_id"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    float64 `json:"volume"`
+}
+
+func newRateRecord(rate cbp.Rate) RateRecord {
+	return RateRecord{
+		Unix:      rate.Time().Unix(),
+		ProductID: rate.ProductId,
+		Open:      rate.Open,
+		High:      rate.High,
+		Low:       rate.Low,
+		Close:     rate.Close,
+		Volume:    rate.Volume,
+	}
+}
+
+// rate returns the record as a rate.
+func (r RateRecord) rate() cbp.Rate {
+	return *cbp.NewRate(r.ProductID, cb.HistoricRate{
+		Time:   time.Unix(r.Unix, 0).UTC(),
+		Open:   r.Open,
+		High:   r.High,
+		Low:    r.Low,
+		Close:  r.Close,
+		Volume: r.Volume,
+	})
+}
+
+// validate returns an error if the record isn't a rate of the given granularity in seconds.
+func (r RateRecord) validate(granularity int) error {
+	if r.ProductID == "" {
+		return errors.New("missing product_id")
+	} else if r.Unix <= 0 {
+		return fmt.Errorf("invalid unix [%d]", r.Unix)
+	} else if r.Unix%int64(granularity) != 0 {
+		return fmt.Errorf("unix [%d] is not aligned to a granularity of %d seconds", r.Unix, granularity)
+	} else if r.Low <= 0 || r.Open <= 0 || r.Close <= 0 || r.High <= 0 {
+		return errors.New("prices must be greater than zero")
+	} else if r.Low > r.Open || r.Low > r.Close || r.High < r.Open || r.High < r.Close {
+		return fmt.Errorf("open [%f] and close [%f] are not between low [%f] and high [%f]", r.Open, r.Close, r.Low, r.High)
+	} else if r.Volume < 0 {
+		return fmt.Errorf("invalid volume [%f]", r.Volume)
+	}
+	return nil
+}
+
+func (r RateRecord) record() []string {
+	return []string{
+		strconv.FormatInt(r.Unix, 10),
+		r.ProductID,
+		formatFloat(r.Open),
+		formatFloat(r.High),
+		formatFloat(r.Low),
+		formatFloat(r.Close),
+		formatFloat(r.Volume),
+	}
+}
+
+// Format returns the given format, or the format of the given file extension when no format is given.
+func Format(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if format != CSV && format != JSONL {
+		return "", fmt.Errorf("unknown format [%s], expected %s or %s", format, CSV, JSONL)
+	}
+	return format, nil
+}
+
+// ReadRates reads and validates every rate of the given granularity in seconds from the given reader, in csv or jsonl
+// format, oldest first. Rates repeating the time and product of an earlier rate are dropped, and counted as duplicates.
+func ReadRates(r io.Reader, format string, granularity int) (rates []cbp.Rate, duplicates int, err error) {
+
+	var records []RateRecord
+	switch format {
+	case CSV:
+		records, err = readCsv(r)
+	case JSONL:
+		records, err = readJsonl(r)
+	default:
+		_, err = Format(format, "")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type key struct {
+		unix      int64
+		productID string
+	}
+	seen := map[key]bool{}
+
+	for i, record := range records {
+		if err := record.validate(granularity); err != nil {
+			return nil, 0, fmt.Errorf("record %d, %v", i+1, err)
+		}
+		if k := (key{record.Unix, record.ProductID}); seen[k] {
+			duplicates++
+			continue
+		} else {
+			seen[k] = true
+		}
+		rates = append(rates, record.rate())
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Unix < rates[j].Unix
+	})
+
+	return rates, duplicates, nil
+}
+
+func readCsv(r io.Reader) ([]RateRecord, error) {
+
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	column := map[string]int{}
+	for i, name := range header {
+		column[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, name := range rateHeader {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("missing column [%s]", name)
+		}
+	}
+
+	var records []RateRecord
+	for line := 2; ; line++ {
+
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var record RateRecord
+		var errs []string
+		float := func(name string) float64 {
+			f, err := strconv.ParseFloat(strings.TrimSpace(fields[column[name]]), 64)
+			if err != nil {
+				errs = append(errs, name)
+			}
+			return f
+		}
+
+		unix, err := strconv.ParseInt(strings.TrimSpace(fields[column["unix"]]), 10, 64)
+		if err != nil {
+			errs = append(errs, "unix")
+		}
+		record.Unix = unix
+		record.ProductID = strings.TrimSpace(fields[column["product_id"]])
+		record.Open = float("open")
+		record.High = float("high")
+		record.Low = float("low")
+		record.Close = float("close")
+		record.Volume = float("volume")
+
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("line %d, invalid %s", line, strings.Join(errs, ", "))
+		}
+
+		records = append(records, record)
+	}
+}
+
+func readJsonl(r io.Reader) ([]RateRecord, error) {
+
+	var records []RateRecord
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record RateRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d, %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// WriteRates writes the given rates to the given writer in csv or jsonl format.
+func WriteRates(w io.Writer, format string, rates []cbp.Rate) error {
+
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(rateHeader); err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			if err := writer.Write(newRateRecord(rate).record()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case JSONL:
+		enc := json.NewEncoder(w)
+		for _, rate := range rates {
+			if err := enc.Encode(newRateRecord(rate)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := Format(format, "")
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,123 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package data
+
+import (
+	"bytes"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRatesRoundTrip(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i, productID := range []string{"ALGO-USD", "XLM-USD", "ALGO-USD"} {
+		rates = append(rates, *cbp.NewRate(productID, cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    .9,
+			High:   1.1,
+			Open:   1,
+			Close:  1.05,
+			Volume: 1234.5,
+		}))
+	}
+
+	for _, format := range []string{CSV, JSONL} {
+
+		var buf bytes.Buffer
+		if err := WriteRates(&buf, format, rates); err != nil {
+			t.Fatal(err)
+		}
+
+		out, duplicates, err := ReadRates(&buf, format, cbp.Minute)
+		if err != nil {
+			t.Fatalf("%s, %v", format, err)
+		}
+		if duplicates != 0 || len(out) != len(rates) {
+			t.Fatalf("%s, expected %d rates, got %d and %d duplicates", format, len(rates), len(out), duplicates)
+		}
+		for i := range rates {
+			if out[i] != rates[i] {
+				t.Errorf("%s, expected %+v, got %+v", format, rates[i], out[i])
+			}
+		}
+	}
+}
+
+func TestReadRates(t *testing.T) {
+
+	const header = "product_id,unix,open,high,low,close,volume\n"
+
+	out, duplicates, err := ReadRates(strings.NewReader(header+
+		"ALGO-USD,1622505660,1,1,1,1,1\n"+
+		"ALGO-USD,1622505600,1,1,1,1,1\n"+
+		"ALGO-USD,1622505660,2,2,2,2,2\n"+
+		"XLM-USD,1622505660,1,1,1,1,0\n"), CSV, cbp.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicates != 1 || len(out) != 3 {
+		t.Fatalf("expected 3 rates and a duplicate, got %d and %d", len(out), duplicates)
+	}
+	if out[0].Unix != time.Unix(1622505600, 0).UnixNano() {
+		t.Errorf("expected the oldest rate first, got %d", out[0].Unix)
+	}
+	if out[1].ProductId != "ALGO-USD" || out[1].Open != 1 {
+		t.Errorf("expected the first of the duplicates to be kept, got %+v", out[1])
+	}
+
+	for name, in := range map[string]string{
+		"missing column": "unix,product_id,open,high,low,close\n1622505600,ALGO-USD,1,1,1,1\n",
+		"invalid float":  header + "ALGO-USD,1622505600,one,1,1,1,1\n",
+		"missing id":     header + ",1622505600,1,1,1,1,1\n",
+		"unaligned":      header + "ALGO-USD,1622505601,1,1,1,1,1\n",
+		"open too high":  header + "ALGO-USD,1622505600,2,1.5,1,1,1\n",
+		"close too low":  header + "ALGO-USD,1622505600,1,1.5,1,.5,1\n",
+		"no price":       header + "ALGO-USD,1622505600,0,0,0,0,1\n",
+		"bad volume":     header + "ALGO-USD,1622505600,1,1,1,1,-1\n",
+	} {
+		if _, _, err := ReadRates(strings.NewReader(in), CSV, cbp.Minute); err == nil {
+			t.Errorf("%s, expected an error", name)
+		}
+	}
+
+	if _, _, err := ReadRates(strings.NewReader(`{"unix":1622505600,"product_id":"ALGO-USD"`), JSONL, cbp.Minute); err == nil {
+		t.Error("expected invalid json to fail")
+	}
+	if _, _, err := ReadRates(strings.NewReader(`{"unix":1622505660,"product_id":"ALGO-USD","open":1,"high":1,"low":1,"close":1,"volume":1}`), JSONL, 300); err == nil {
+		t.Error("expected a minute rate not to be a 5 minute rate")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if format, err := Format("", "/tmp/rates.CSV"); err != nil || format != CSV {
+		t.Errorf("expected csv, got %s, %v", format, err)
+	}
+	if format, err := Format(JSONL, "/tmp/rates.txt"); err != nil || format != JSONL {
+		t.Errorf("expected jsonl, got %s, %v", format, err)
+	}
+	if _, err := Format("", "/tmp/rates.json"); err == nil {
+		t.Error("expected json to be unknown")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package data
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"os"
+	"time"
+)
+
+// NewImport reads every rate of the given granularity in seconds from the given csv or jsonl file, and stores those
+// the database is missing. Rates already stored under the same time and product are left as they are.
+func NewImport(path, format string, granularity int) error {
+
+	log.Info().Msg(util.Octopus + " .")
+	log.Info().Msg(util.Octopus + " ..")
+	log.Info().Msg(util.Octopus + " ... import")
+	log.Info().Msg(util.Octopus + " ..")
+
+	if !cbp.IsGranularity(granularity) {
+		return fmt.Errorf("granularity %d is not one of %v", granularity, cbp.Granularities)
+	}
+
+	format, err := Format(format, path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rates, duplicates, err := ReadRates(f, format, granularity)
+	if err != nil {
+		return fmt.Errorf("%s, %v", path, err)
+	}
+
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+
+	imported, err := store.SaveCandles(granularity, rates)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("read", len(rates)+duplicates).
+		Int64("imported", imported).
+		Int("duplicates", duplicates).
+		Int64("stored", int64(len(rates))-imported).
+		Str(util.Link, path).
+		Msgf("%s ... %s", util.Octopus, util.Check)
+	log.Info().Msg(util.Octopus + " .")
+
+	return nil
+}
+
+// NewExport writes every stored rate of the selected products from alpha up to omega, at the given granularity in
+// seconds, to the given csv or jsonl file.
+func NewExport(session *config.Session, path, format string, alpha, omega time.Time, granularity int) error {
+
+	log.Info().Msg(util.Octopus + " .")
+	log.Info().Msg(util.Octopus + " ..")
+	log.Info().Msg(util.Octopus + " ... export")
+	log.Info().Msg(util.Octopus + " ..")
+
+	if !cbp.IsGranularity(granularity) {
+		return fmt.Errorf("granularity %d is not one of %v", granularity, cbp.Granularities)
+	} else if !alpha.Before(omega) {
+		return fmt.Errorf("from %s is not before to %s", alpha.Format(time.RFC3339), omega.Format(time.RFC3339))
+	}
+
+	format, err := Format(format, path)
+	if err != nil {
+		return err
+	}
+
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+
+	var rates []cbp.Rate
+	for _, productID := range session.UsdSelectionProductIDs() {
+		out, err := store.FindCandles(productID, granularity, alpha, omega)
+		if err != nil {
+			return err
+		}
+		log.Info().
+			Int("rates", len(out)).
+			Msgf("%s ... %5s ... %s", util.Octopus, util.GetCurrency(productID), util.Check)
+		rates = append(rates, out...)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteRates(f, format, rates); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.Info().Int("rates", len(rates)).Str(util.Link, path).Msg(util.Octopus + " ... export")
+	log.Info().Msg(util.Octopus + " .")
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+package report
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/db"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"gorm.io/gorm"
+)
+
+// ledger is the lot ledger of a report, built from the fill history once, then updated with the fills made since.
+type ledger struct {
+	*cbp.Ledger
+	pg *gorm.DB
+}
+
+// newLedger returns an empty ledger matching fills into lots by the given method, written to the database.
+func newLedger(method string) (*ledger, error) {
+
+	l, err := cbp.NewLedger(method)
+	if err != nil {
+		return nil, err
+	}
+
+	pg, err := db.NewDB(&cbp.Lot{}, &cbp.Disposal{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ledger{l, pg}, nil
+}
+
+// update matches the fills of the given products made since the last update into lots, and writes the lots that
+// changed. The specific ID method sells the lots of the journaled entry with every journaled sell order.
+func (l *ledger) update(productIDs []string) error {
+
+	if l.Method == cbp.SpecificID {
+		journals, err := journal.GetJournals()
+		if err != nil {
+			return err
+		}
+		for _, j := range journals {
+			if j.EntryOrderID == "" {
+				continue
+			}
+			for _, orderID := range j.SellOrders() {
+				l.Identify(orderID, j.EntryOrderID)
+			}
+		}
+	}
+
+	for _, productID := range productIDs {
+		fills, err := cbp.GetFillsAfter(productID, l.Last(productID))
+		if err != nil {
+			return err
+		}
+		l.Add(*fills)
+	}
+
+	if l.pg == nil {
+		return nil
+	}
+	return l.Save(l.pg)
+}
@@ -0,0 +1,99 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package report
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/test"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestNewLedger(t *testing.T) {
+	test.Session(t) // the ledger is written to the session database
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	var rates []cbp.Rate
+	for i, price := range []float64{1, 1, 1.2, 1.2} {
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    price,
+			High:   price,
+			Open:   price,
+			Close:  price,
+			Volume: 1,
+		}))
+	}
+
+	server := fake.NewServer(100, 0, rates)
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10}
+	if _, err := cbp.CreateOrder(pattern.NewMarketBuyOrder()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		server.Advance()
+	}
+	if _, err := cbp.CreateOrder(pattern.NewMarketSellOrder("4")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newLedger("average"); err == nil {
+		t.Error("expected an unknown lot method to fail")
+	}
+
+	ledger, err := newLedger(cbp.FIFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.update([]string{"ALGO-USD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ledger.Disposals) != 1 || ledger.Disposals[0].Size != 4 || ledger.Disposals[0].Price != 1.2 {
+		t.Fatalf("expected 4 sold at 1.2, got %+v", ledger.Disposals)
+	}
+	if realized := ledger.Realized("ALGO-USD"); realized <= 0 || realized >= .8 {
+		t.Errorf("expected a gain of less than .8 after fees, got %f", realized)
+	}
+	if open := ledger.Open("ALGO-USD"); len(open) != 1 || open[0].Remaining != 6 {
+		t.Errorf("expected 6 open, got %+v", open)
+	}
+
+	// only the fills made since are added
+	if _, err := cbp.CreateOrder(pattern.NewMarketSellOrder("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.update([]string{"ALGO-USD"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ledger.Disposals) != 2 || len(ledger.Lots) != 1 || ledger.Open("ALGO-USD")[0].Remaining != 4 {
+		t.Errorf("expected a second sale of the same lot, got %+v", ledger.Disposals)
+	}
+}
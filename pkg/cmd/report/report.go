@@ -19,16 +19,29 @@
 package report
 
 import (
+	"context"
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/journal"
 	"github.com/nelsw/nuchal/pkg/util"
 	"github.com/rs/zerolog/log"
 	"sort"
+	"strconv"
 	"time"
 )
 
-// New creates a new report.
-func New(session *config.Session) error {
+// New creates a new report, matching fills into lots by the given method to compute profit and loss.
+func New(session *config.Session, method string) error {
+	return report(context.Background(), session, method)
+}
+
+// report logs the report every 30 seconds until the given context is done.
+func report(ctx context.Context, session *config.Session, method string) error {
+
+	ledger, err := newLedger(method)
+	if err != nil {
+		return err
+	}
 
 	for {
 
@@ -52,12 +65,16 @@ func New(session *config.Session) error {
 				cash += position.Balance()
 				continue
 			}
-			coin += position.Value()
+			coin += current(productID, position) * position.Balance()
 			productIDs = append(productIDs, productID)
 		}
 
 		sort.Strings(productIDs)
 
+		if err := ledger.update(ledgerProductIDs(session, productIDs)); err != nil {
+			return err
+		}
+
 		dollar := util.Money(cash)
 		currency := util.Money(coin)
 		sigma := util.Usd(cash + coin)
@@ -74,10 +91,13 @@ func New(session *config.Session) error {
 		for _, productID := range productIDs {
 
 			position := positions[productID]
+			price := current(productID, position)
 
 			log.Info().
-				Str(util.Sigma, util.Usd(position.Value())).
+				Str(util.Sigma, util.Usd(price*position.Balance())).
 				Float64(util.Quantity, position.Balance()).
+				Str("realized", util.Usd(ledger.Realized(productID))).
+				Str("unrealized", util.Usd(ledger.Unrealized(productID, price))).
 				Str(util.Link, util.CbUrl(productID)).
 				Msg(util.Puffer + util.Break + util.GetCurrency(productID))
 
@@ -133,7 +153,7 @@ func New(session *config.Session) error {
 
 					log.Info().
 						Str(util.Entry, pattern.PrecisePrice(entryPrice)).
-						Str(util.Current, pattern.PrecisePrice(position.Price())).
+						Str(util.Current, pattern.PrecisePrice(price)).
 						Str(util.Goal, pattern.PrecisePriceFromString(order.Price)).
 						Str(util.Quantity, pattern.PreciseSize(order.Size)).
 						Time(util.Time, order.CreatedAt.Time()).
@@ -141,22 +161,131 @@ func New(session *config.Session) error {
 				}
 			}
 
-			trades := position.GetActiveTrades()
-			if len(trades) > 0 {
-				for _, trade := range trades {
-					log.Info().
-						Str(util.Entry, pattern.PrecisePrice(trade.Price())).
-						Str(util.Current, pattern.PrecisePrice(position.Price())).
-						Str(util.Goal, pattern.PrecisePrice(pattern.GoalPrice(trade.Price()))).
-						Str(util.Quantity, pattern.PreciseSize(trade.Fill.Size)).
-						Time(util.Time, trade.CreatedAt.Time()).
-						Msg(util.Puffer + util.Break + "   " + util.Trading)
-				}
+			for _, lot := range ledger.Open(productID) {
+				log.Info().
+					Str(util.Entry, pattern.PrecisePrice(lot.Price)).
+					Str(util.Current, pattern.PrecisePrice(price)).
+					Str(util.Goal, pattern.PrecisePrice(pattern.GoalPrice(lot.Price))).
+					Str(util.Quantity, pattern.PreciseSize(strconv.FormatFloat(lot.Remaining, 'f', -1, 64))).
+					Time(util.Time, lot.Opened).
+					Msg(util.Puffer + util.Break + "   " + util.Trading)
 			}
 			log.Info().Msg(util.Puffer + " ..")
 		}
 
+		journals, err := journal.GetOpenJournals()
+		if err != nil {
+			return err
+		}
+
 		log.Info().Msg(util.Puffer + " .")
-		time.Sleep(time.Second * 30)
+		log.Info().Msg(util.Puffer + " ..")
+		log.Info().Msg(util.Puffer + " ... trades")
+		log.Info().Msg(util.Puffer + " ..")
+
+		for _, j := range journals {
+			pattern := session.GetPattern(j.ProductID)
+			price, _ := cbp.LastPrice(j.ProductID)
+			log.Info().
+				Str("state", string(j.State)).
+				Str(util.Entry, pattern.PrecisePrice(j.Entry)).
+				Str(util.Current, pattern.PrecisePrice(price)).
+				Str("stop", pattern.PrecisePrice(j.Stop)).
+				Str(util.Goal, pattern.PrecisePrice(j.Goal)).
+				Str(util.Quantity, pattern.PreciseSize(j.Size)).
+				Time(util.Time, j.Opened).
+				Msg(util.Puffer + util.Break + util.GetCurrency(j.ProductID))
+		}
+
+		logLedger(ledger.Ledger)
+
+		log.Info().Msg(util.Puffer + " .")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second * 30):
+		}
+	}
+}
+
+// ledgerProductIDs returns the selected products and the products of every active position, whose fills make up the
+// ledger.
+func ledgerProductIDs(session *config.Session, positionProductIDs []string) []string {
+	seen := map[string]bool{}
+	var productIDs []string
+	for _, productID := range append(session.UsdSelectionProductIDs(), positionProductIDs...) {
+		if !seen[productID] {
+			seen[productID] = true
+			productIDs = append(productIDs, productID)
+		}
+	}
+	sort.Strings(productIDs)
+	return productIDs
+}
+
+// logLedger logs the profit or loss of every product with a lot, and of every day with a sale.
+func logLedger(ledger *cbp.Ledger) {
+
+	log.Info().Msg(util.Puffer + " .")
+	log.Info().Msg(util.Puffer + " ..")
+	log.Info().Msg(util.Puffer + " ... pnl " + ledger.Method)
+	log.Info().Msg(util.Puffer + " ..")
+
+	var productIDs []string
+	seen := map[string]bool{}
+	for _, lot := range ledger.Lots {
+		if !seen[lot.ProductID] {
+			seen[lot.ProductID] = true
+			productIDs = append(productIDs, lot.ProductID)
+		}
+	}
+	sort.Strings(productIDs)
+
+	var realized, unrealized float64
+	for _, productID := range productIDs {
+		price, _ := cbp.LastPrice(productID)
+		if price == 0 {
+			if ticker, err := cbp.GetTickerPrice(productID); err == nil {
+				price = *ticker
+			}
+		}
+		r, u := ledger.Realized(productID), ledger.Unrealized(productID, price)
+		realized += r
+		unrealized += u
+		e := log.Info().
+			Str("realized", util.Usd(r)).
+			Str("unrealized", util.Usd(u)).
+			Int("open", len(ledger.Open(productID)))
+		if unmatched := ledger.Unmatched[productID]; unmatched > 0 {
+			e = e.Float64("unmatched", unmatched)
+		}
+		e.Msg(util.Puffer + util.Break + util.GetCurrency(productID))
+	}
+
+	log.Info().Msg(util.Puffer + " ..")
+
+	for _, day := range ledger.Days() {
+		log.Info().
+			Str("realized", util.Usd(day.Realized)).
+			Str("fees", util.Usd(day.Fees)).
+			Int("sales", day.Sales).
+			Msg(util.Puffer + util.Break + day.Date)
+	}
+
+	log.Info().Msg(util.Puffer + " ..")
+	log.Info().
+		Str("realized", util.Usd(realized)).
+		Str("unrealized", util.Usd(unrealized)).
+		Str(util.Sigma, util.Usd(realized+unrealized)).
+		Msg(util.Puffer + " ...")
+}
+
+// current returns the live price of the given position from the market data hub, or its ticker price until the hub
+// has received one.
+func current(productID string, position cbp.Position) float64 {
+	if price, ok := cbp.LastPrice(productID); ok {
+		return price
 	}
+	return position.Price()
 }
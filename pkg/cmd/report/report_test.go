@@ -15,16 +15,21 @@
  * limitations under the License.
  * /
  */
-
 package report
 
 import (
+	"context"
+	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/test"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
-	if err := New(test.Session()); err != nil {
+	test.Dir(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := report(ctx, test.Session(t), cbp.FIFO); err != nil {
 		t.Error(err)
 	}
 }
@@ -32,12 +32,24 @@ import (
 // A Chart represents the data used to represent chart activity and trade results.
 type Chart struct {
 
-	// Rates are used to build a chart. The first 3 rates are the tweezer pattern prefix and the last rate is the exit.
+	// Rates are used to build a chart. The first rates are the pattern window and the last rate is the exit.
 	Rates []cbp.Rate
 
+	// Opened is when the trade was entered.
+	Opened time.Time
+
+	// Closed is when the trade was exited, or zero if it is still trading.
+	Closed time.Time
+
 	// Duration is the amount of time the chart spans.
 	Duration time.Duration
 
+	// Size is the base currency size of the entry, from the pattern sizing.
+	Size float64
+
+	// ATR is the average true range of the rates before the entry, used by atr sizing.
+	ATR float64
+
 	// Entry is the actual price which the trade was entered.
 	Entry float64
 
@@ -56,6 +68,9 @@ type Chart struct {
 	// TakerFee is a fee for placing a market order.
 	TakerFee float64
 
+	// EntryFee is the fee paid on the entry, the taker fee of a market entry or the maker fee of a limit entry.
+	EntryFee float64
+
 	Last float64
 
 	SellIndex float64
@@ -82,7 +97,7 @@ func (c *Chart) result() float64 {
 }
 
 func (c *Chart) entryPlusFee() float64 {
-	return c.Entry + (c.Entry * c.TakerFee)
+	return c.Entry + (c.Entry * c.EntryFee)
 }
 
 func (c *Chart) exitPlusFee() float64 {
@@ -93,70 +108,86 @@ func (c *Chart) exitPlusFee() float64 {
 	return exit + (exit * c.MakerFee)
 }
 
-func newChart(session *config.Session, rates []cbp.Rate, productID string) *Chart {
+// newChart enters the given pattern at the rate after its window, plus the fill latency, and exits it with the
+// pattern exit, returning nil when the rates don't allow an entry. A limit entry enters at the rate it fills in, or at
+// market after the pattern reprice time when it doesn't fill and the pattern falls back.
+func newChart(pattern *cbp.Pattern, fills *config.FillModel, rates []cbp.Rate, balance, atr float64) *Chart {
 
-	iterableRates := rates[3:]
-	if len(iterableRates) < 1 {
+	offset := pattern.Window()
+	if fills != nil {
+		offset += fills.Latency
+	}
+	if offset < 1 || len(rates) <= offset {
+		return nil
+	}
+
+	size, err := pattern.EntrySize(rates[offset].Open, balance, atr)
+	if err != nil {
 		return nil
 	}
 
 	c := new(Chart)
+	c.Size = size
+	c.ATR = atr
 	c.MakerFee = cbp.Maker()
 	c.TakerFee = cbp.Taker()
-	c.Entry = iterableRates[0].Open
-	c.Goal = session.GetPattern(productID).GoalPrice(c.Entry)
-	c.Loss = session.GetPattern(productID).LossPrice(c.Entry)
+	c.EntryFee = c.TakerFee
 
-	var j int
-	var rate cbp.Rate
-
-	for j, rate = range iterableRates {
-
-		// if the low meets or exceeds our loss limit ...
-		if rate.Low <= c.Loss {
-
-			// ok, not the worst thing in the world, maybe a stop order already sold this for us
-			if c.Exit == 0 {
-				// nope, we never established a stop order for this chart, we took a bath
-				c.Exit = c.Loss
+	limit, err := pattern.IsLimitEntry()
+	if err != nil {
+		return nil
+	}
+	if limit {
+		price, i := makerEntry(pattern, fills, rates[offset-1:])
+		if i > 0 {
+			c.Entry = price
+			c.EntryFee = c.MakerFee
+			offset += i - 1
+		} else {
+			offset += repriceRates(pattern)
+			if !pattern.Fallback || len(rates) <= offset {
+				return nil
 			}
-			c.SellIndex = math.Min(float64(j+4), float64(len(iterableRates)))
-			break
 		}
+	}
+	if c.Entry == 0 {
+		c.Entry = entry(fills, size, rates[offset-1:])
+	}
+	if c.Entry == 0 {
+		return nil
+	}
 
-		// else if the high meets or exceeds our gain limit ...
-		if rate.High >= c.Goal {
-
-			// is this the first time this has happened?
-			if c.Exit == 0 {
-				// great, we have a stop (limit) entry order placed, continue on.
-				c.Exit = c.Goal
-			}
+	iterableRates := rates[offset:]
+	c.Opened = iterableRates[0].Time()
+	exit, err := pattern.NewExit(c.Entry, atr, c.Opened)
+	if err != nil {
+		return nil
+	}
+	c.Goal = exit.Goal
+	c.Loss = exit.Loss
+	c.SellIndex = float64(len(rates))
 
-			// now if the rate closes less than our exit, the entry order would have been triggered.
-			if rate.Close < c.Exit {
-				c.SellIndex = math.Min(float64(j+3), float64(len(iterableRates)))
-				break
-			}
+	var rate cbp.Rate
+	for j := range iterableRates {
 
-			// otherwise we're trending up, ride the wave.
-			if rate.Close >= c.Exit {
-				c.Exit = rate.Close
-			}
-		}
+		rate = iterableRates[j]
 
-		// else the low and highs of this rate do not exceed either respective limit
-		// we must now navigate each rate and attempt to sell at profit
-		// and avoid the ether
-		if j == 0 {
+		price, kind := exit.Next(rate)
+		if kind == "" {
 			continue
 		}
 
-		if c.Exit == 0 && rate.Time().Sub(iterableRates[0].Time()) > time.Minute*75 && rate.High >= c.entryPlusFee() {
-			c.Exit = c.entryPlusFee()
-			c.SellIndex = math.Min(float64(j+4), float64(len(iterableRates)))
-			break
+		switch kind {
+		case cbp.StopFill:
+			c.Exit = fills.Stop(price, rates[offset+j-1], rate)
+		case cbp.MarketFill:
+			c.Exit = fills.Sell(price, rates[offset+j-1], rate)
+		default:
+			c.Exit = price
 		}
+		c.Closed = rate.Time()
+		c.SellIndex = math.Min(float64(offset+j+1), float64(len(rates)))
+		break
 	}
 
 	c.Last = rate.Close
@@ -165,6 +196,38 @@ func newChart(session *config.Session, rates []cbp.Rate, productID string) *Char
 	return c
 }
 
+// makerEntry returns the price of a post-only limit entry, re-priced to the bid at the open of every rate after the
+// first within the pattern reprice time, and the index of the rate it fills in, or -1 if it doesn't fill.
+func makerEntry(pattern *cbp.Pattern, fills *config.FillModel, rates []cbp.Rate) (float64, int) {
+	for i := 1; i < len(rates) && i <= repriceRates(pattern); i++ {
+		price := pattern.LimitPrice(fills.Bid(rates[i].Open, rates[i-1], rates[i]))
+		if fills.Limit(price, rates[i]) {
+			return price, i
+		}
+	}
+	return 0, -1
+}
+
+// repriceRates returns the amount of one minute rates a limit entry rests for.
+func repriceRates(pattern *cbp.Pattern) int {
+	return int(math.Ceil(pattern.RepriceFor().Minutes()))
+}
+
+// entry returns the average price of a market buy order of the given size, filled at the open of every rate after
+// the first until the entire size is filled, or zero if nothing fills.
+func entry(fills *config.FillModel, size float64, rates []cbp.Rate) float64 {
+	remaining, cost := size, 0.0
+	for i := 1; i < len(rates) && remaining > 0; i++ {
+		filled := fills.Fills(remaining, rates[i])
+		cost += filled * fills.Buy(rates[i].Open, rates[i-1], rates[i])
+		remaining -= filled
+	}
+	if filled := size - remaining; filled > 0 {
+		return cost / filled
+	}
+	return 0
+}
+
 func (c *Chart) kline() *charts.Kline {
 
 	kline := charts.NewKLine()
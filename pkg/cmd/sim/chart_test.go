@@ -0,0 +1,155 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestNewChartFills(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i, ohlc := range [][4]float64{
+		{1.1, 1.1, 1, 1}, // tweezer bottom
+		{1, 1, .9, .9},
+		{.9, 1, .9, 1},
+		{1, 1.01, .99, 1},   // entry
+		{1.02, 1.03, 1, 1},  // latent entry
+		{1, 1, .7, .8},      // stop loss
+		{.8, .85, .75, .85}, // the rest
+	} {
+		rates = append(rates, *cbp.NewRate("BTC-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Open:   ohlc[0],
+			High:   ohlc[1],
+			Low:    ohlc[2],
+			Close:  ohlc[3],
+			Volume: 1,
+		}))
+	}
+
+	pattern := &cbp.Pattern{ID: "BTC-USD", Gain: .1, Loss: .1, Size: 1, Type: cbp.TweezerBottom, Exit: cbp.GuardExit}
+
+	if c := newChart(pattern, nil, rates, 0, 0); c.Entry != 1 || c.Exit != .9 {
+		t.Errorf("expected entry at the open and exit at the stop, got %f and %f", c.Entry, c.Exit)
+	}
+
+	c := newChart(pattern, &config.FillModel{Latency: 1, StopAtLow: true}, rates, 0, 0)
+	if c.Entry != 1.02 || !c.Opened.Equal(rates[4].Time()) {
+		t.Errorf("expected a latent entry at the next open, got %f at %s", c.Entry, c.Opened)
+	}
+	if c.Exit != .7 {
+		t.Errorf("expected a stop fill at the low, got %f", c.Exit)
+	}
+
+	c = newChart(pattern, &config.FillModel{Participation: .5}, rates, 0, 0)
+	if c.Entry != 1.01 {
+		t.Errorf("expected a partial fill averaged over two opens, got %f", c.Entry)
+	}
+}
+
+func TestNewChartExits(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i, ohlc := range [][4]float64{
+		{1.1, 1.1, 1, 1}, // tweezer bottom
+		{1, 1, .9, .9},
+		{.9, 1, .9, 1},
+		{1, 1.05, .99, 1.04},     // entry
+		{1.04, 1.12, 1.03, 1.11}, // goal
+		{1.11, 1.2, 1.12, 1.19},
+		{1.19, 1.19, 1.15, 1.16}, // climb stop
+	} {
+		rates = append(rates, *cbp.NewRate("BTC-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Open:   ohlc[0],
+			High:   ohlc[1],
+			Low:    ohlc[2],
+			Close:  ohlc[3],
+			Volume: 1,
+		}))
+	}
+
+	pattern := &cbp.Pattern{ID: "BTC-USD", Gain: .1, Loss: .1, Size: 1, Type: cbp.TweezerBottom, Exit: cbp.GuardExit}
+
+	c := newChart(pattern, nil, rates, 0, 0)
+	if c.Exit != 1.19 || !c.Closed.Equal(rates[6].Time()) || len(c.Rates) != 7 {
+		t.Errorf("expected a guard exit at the last close, got %f at %s", c.Exit, c.Closed)
+	}
+
+	// climb starts at break-even on the entry rate, and is stopped on the next
+	pattern.Exit = cbp.ClimbExit
+	if c = newChart(pattern, nil, rates, 0, 0); c.Exit != 1.04 || !c.Closed.Equal(rates[4].Time()) {
+		t.Errorf("expected a climb exit at the entry close, got %f at %s", c.Exit, c.Closed)
+	}
+
+	pattern.Exit = cbp.TargetExit
+	if c = newChart(pattern, nil, rates, 0, 0); c.Exit != 1.1 || !c.Closed.Equal(rates[4].Time()) || len(c.Rates) != 5 {
+		t.Errorf("expected a target exit at the goal, got %f at %s", c.Exit, c.Closed)
+	}
+}
+
+func TestNewChartLimitEntry(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i, ohlc := range [][4]float64{
+		{1.1, 1.1, 1, 1}, // tweezer bottom
+		{1, 1, .9, .9},
+		{.9, 1, .9, 1},
+		{1, 1.01, .99, 1},  // maker entry
+		{1.02, 1.03, 1, 1}, // market fallback
+		{1, 1.01, .99, 1},
+	} {
+		rates = append(rates, *cbp.NewRate("BTC-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Open:   ohlc[0],
+			High:   ohlc[1],
+			Low:    ohlc[2],
+			Close:  ohlc[3],
+			Volume: 1,
+		}))
+	}
+
+	pattern := &cbp.Pattern{ID: "BTC-USD", Gain: .1, Loss: .1, Size: 1, Type: cbp.TweezerBottom, Entry: cbp.LimitEntry}
+
+	pattern.Offset = .005
+	if c := newChart(pattern, nil, rates, 0, 0); c == nil || c.Entry != .995 || !c.Opened.Equal(rates[3].Time()) {
+		t.Errorf("expected a maker entry below the open, got %+v", c)
+	}
+
+	pattern.Offset = .02
+	if c := newChart(pattern, nil, rates, 0, 0); c != nil {
+		t.Errorf("expected a limit entry that isn't traded through not to enter, got %f", c.Entry)
+	}
+
+	pattern.Fallback = true
+	if c := newChart(pattern, nil, rates, 0, 0); c == nil || c.Entry != 1.02 || !c.Opened.Equal(rates[4].Time()) {
+		t.Errorf("expected a market entry after the reprice time, got %+v", c)
+	}
+}
@@ -47,25 +47,24 @@ func NewResult(session *config.Session, simulations []simulation, start time.Tim
 		}
 
 		productID := simulation.productID
-		size := session.GetPattern(productID).Size
 
 		log.Info().
 			Float64(util.Delta, session.GetPattern(productID).Delta).
 			Float64(util.Goal, session.GetPattern(productID).Gain).
-			Float64(util.Quantity, size).
+			Float64(util.Quantity, simulation.TotalSize()).
 			Str(util.Link, util.CbUrl(productID)).
 			Msg(util.Tuna + util.Break + util.GetCurrency(productID))
 
 		log.Info().
-			Str(util.Sigma, util.Usd(simulation.TotalAfterFees()*size)).
-			Str(util.Quantity, util.Usd(simulation.TotalEntries()*size)).
-			Str("%", util.Money(simulation.Net()*size)).
+			Str(util.Sigma, util.Usd(simulation.SizedAfterFees())).
+			Str(util.Quantity, util.Usd(simulation.SizedEntries())).
+			Str("%", util.Money(simulation.Net())).
 			Msg(util.Tuna + util.Break + fmt.Sprintf("%4s", simulation.symbol()))
 
 		if simulation.WonLen() > 0 {
 			log.Info().
 				Int(util.Quantity, simulation.WonLen()).
-				Str(util.Sigma, util.Usd(simulation.TotalWonAfterFees())).
+				Str(util.Sigma, util.Usd(sizedAfterFees(simulation.Won))).
 				Str(util.Link, resultUrl(simulation.productID, "won", port())).
 				Msg(util.Tuna + " ... " + fmt.Sprintf("%4s", util.Ice))
 		}
@@ -73,7 +72,7 @@ func NewResult(session *config.Session, simulations []simulation, start time.Tim
 		if simulation.LostLen() > 0 {
 			log.Info().
 				Int(util.Quantity, simulation.LostLen()).
-				Str(util.Sigma, util.Usd(simulation.TotalLostAfterFees())).
+				Str(util.Sigma, util.Usd(sizedAfterFees(simulation.Lost))).
 				Str(util.Link, resultUrl(productID, "lst", port())).
 				Msg(util.Tuna + " ... " + fmt.Sprintf("%5s", util.Poo))
 		}
@@ -87,14 +86,14 @@ func NewResult(session *config.Session, simulations []simulation, start time.Tim
 		}
 
 		if simulation.TradingLen() > 0 {
-			sum += simulation.TotalTradingAfterFees()
+			sum += sizedAfterFees(simulation.Trading)
 			symbol := util.TradingUp
 			if simulation.TotalTradingAfterFees() < 0 {
 				symbol = util.TradingDown
 			}
 			log.Info().
 				Int(util.Quantity, simulation.TradingLen()).
-				Str(util.Sigma, util.Usd(simulation.TotalTradingAfterFees())).
+				Str(util.Sigma, util.Usd(sizedAfterFees(simulation.Trading))).
 				Str(util.Link, resultUrl(productID, "dnf", port())).
 				Msg(util.Tuna + " ... " + fmt.Sprintf("%4s", symbol))
 		}
@@ -102,10 +101,10 @@ func NewResult(session *config.Session, simulations []simulation, start time.Tim
 		winners += simulation.WonLen()
 		losers += simulation.LostLen()
 		trading += simulation.TradingLen()
-		won += simulation.TotalWonAfterFees()
-		lost += simulation.TotalLostAfterFees()
-		net += simulation.TotalAfterFees() * session.GetPattern(simulation.productID).Size
-		volume += simulation.TotalEntries() * session.GetPattern(simulation.productID).Size
+		won += sizedAfterFees(simulation.Won)
+		lost += sizedAfterFees(simulation.Lost)
+		net += simulation.SizedAfterFees()
+		volume += simulation.SizedEntries()
 		even += simulation.EvenLen()
 
 		log.Info().Msg(util.Tuna + " ..")
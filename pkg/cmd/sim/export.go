@@ -0,0 +1,376 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	JSON  = "json"
+	JSONL = "jsonl"
+	CSV   = "csv"
+
+	// SchemaVersion is incremented whenever an exported field is renamed, removed or changes meaning.
+	SchemaVersion = 1
+)
+
+// Export is the machine readable result of a simulation run.
+type Export struct {
+	SchemaVersion int                `json:"schema_version"`
+	Generated     time.Time          `json:"generated"`
+	Alpha         time.Time          `json:"alpha"`
+	Omega         time.Time          `json:"omega"`
+	Simulations   []SimulationExport `json:"simulations"`
+}
+
+// SimulationExport is the summary of a product simulation, and every chart it produced.
+type SimulationExport struct {
+	ProductID     string        `json:"product_id"`
+	Type          string        `json:"type"`
+	Gain          float64       `json:"gain"`
+	Loss          float64       `json:"loss"`
+	Size          float64       `json:"size"`
+	Delta         float64       `json:"delta"`
+	Won           int           `json:"won"`
+	Lost          int           `json:"lost"`
+	Even          int           `json:"even"`
+	Trading       int           `json:"trading"`
+	WonResult     float64       `json:"won_result"`
+	LostResult    float64       `json:"lost_result"`
+	TradingResult float64       `json:"trading_result"`
+	Entries       float64       `json:"entries"`
+	Result        float64       `json:"result"`
+	Net           float64       `json:"net"`
+	SizedEntries  float64       `json:"sized_entries"`
+	SizedResult   float64       `json:"sized_result"`
+	Charts        []ChartExport `json:"charts,omitempty"`
+}
+
+// ChartExport is a single simulated trade. Prices are per unit of size, Result is after fees, Size is the size the
+// chart was entered with.
+type ChartExport struct {
+	ProductID string       `json:"product_id"`
+	Status    string       `json:"status"`
+	Opened    time.Time    `json:"opened"`
+	Closed    *time.Time   `json:"closed"`
+	Duration  float64      `json:"duration"`
+	Entry     float64      `json:"entry"`
+	Goal      float64      `json:"goal"`
+	Loss      float64      `json:"loss"`
+	Exit      float64      `json:"exit"`
+	Last      float64      `json:"last"`
+	MakerFee  float64      `json:"maker_fee"`
+	TakerFee  float64      `json:"taker_fee"`
+	EntryFee  float64      `json:"entry_fee"`
+	Size      float64      `json:"size"`
+	Result    float64      `json:"result"`
+	Rates     []RateExport `json:"rates,omitempty"`
+}
+
+// RateExport is a rate of the chart window, from the first rate of the pattern to the exit.
+type RateExport struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+var (
+	simulationHeader = []string{
+		"product_id", "type", "gain", "loss", "size", "delta", "won", "lost", "even", "trading",
+		"won_result", "lost_result", "trading_result", "entries", "result", "net", "sized_entries", "sized_result",
+	}
+	chartHeader = []string{
+		"product_id", "status", "opened", "closed", "duration", "entry", "goal", "loss", "exit", "last",
+		"maker_fee", "taker_fee", "entry_fee", "size", "result", "rates", "rates_start", "rates_end",
+	}
+)
+
+// NewExport returns the machine readable result of the given simulations.
+func NewExport(session *config.Session, simulations []simulation) *Export {
+
+	e := &Export{
+		SchemaVersion: SchemaVersion,
+		Generated:     time.Now().UTC(),
+		Alpha:         *session.Alpha,
+		Omega:         *session.Omega,
+	}
+
+	for _, s := range simulations {
+		e.Simulations = append(e.Simulations, newSimulationExport(session.GetPattern(s.productID), s))
+	}
+
+	return e
+}
+
+func newSimulationExport(pattern *cbp.Pattern, s simulation) SimulationExport {
+
+	e := SimulationExport{
+		ProductID:     s.productID,
+		Type:          pattern.Type,
+		Gain:          pattern.Gain,
+		Loss:          pattern.Loss,
+		Size:          pattern.Size,
+		Delta:         pattern.Delta,
+		Won:           s.WonLen(),
+		Lost:          s.LostLen(),
+		Even:          s.EvenLen(),
+		Trading:       s.TradingLen(),
+		WonResult:     s.TotalWonAfterFees(),
+		LostResult:    s.TotalLostAfterFees(),
+		TradingResult: s.TotalTradingAfterFees(),
+		Entries:       s.TotalEntries(),
+		Result:        s.TotalAfterFees(),
+		SizedEntries:  s.SizedEntries(),
+		SizedResult:   s.SizedAfterFees(),
+	}
+
+	if e.Entries > 0 {
+		e.Net = s.Net()
+	}
+
+	add := func(status string, charts []Chart) {
+		for _, c := range charts {
+			e.Charts = append(e.Charts, newChartExport(s.productID, status, c))
+		}
+	}
+	add("won", s.Won)
+	add("lost", s.Lost)
+	add("even", s.Even)
+	add("trading", s.Trading)
+
+	sort.SliceStable(e.Charts, func(i, j int) bool {
+		return e.Charts[i].Opened.Before(e.Charts[j].Opened)
+	})
+
+	return e
+}
+
+func newChartExport(productID, status string, c Chart) ChartExport {
+
+	e := ChartExport{
+		ProductID: productID,
+		Status:    status,
+		Opened:    c.Opened.UTC(),
+		Entry:     c.Entry,
+		Goal:      c.Goal,
+		Loss:      c.Loss,
+		Exit:      c.Exit,
+		Last:      c.Last,
+		MakerFee:  c.MakerFee,
+		TakerFee:  c.TakerFee,
+		EntryFee:  c.EntryFee,
+		Size:      c.Size,
+		Result:    c.result(),
+	}
+
+	if !c.Closed.IsZero() {
+		closed := c.Closed.UTC()
+		e.Closed = &closed
+		e.Duration = closed.Sub(e.Opened).Seconds()
+	}
+
+	for _, rate := range c.Rates {
+		e.Rates = append(e.Rates, RateExport{
+			Time:   rate.Time().UTC(),
+			Open:   rate.Open,
+			High:   rate.High,
+			Low:    rate.Low,
+			Close:  rate.Close,
+			Volume: rate.Volume,
+		})
+	}
+
+	return e
+}
+
+// Write writes the export to the given directory in the given format, json as a single document, jsonl and csv as
+// a simulations file and a charts file with a record per line. It returns the paths of the files written.
+func (e *Export) Write(dir, format string) ([]string, error) {
+
+	if err := util.MakePath(dir); err != nil {
+		return nil, err
+	}
+
+	name := filepath.Join(dir, "sim-"+e.Generated.Format("20060102T150405Z"))
+
+	switch format {
+	case JSON:
+		path := name + ".json"
+		return []string{path}, write(path, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(e)
+		})
+	case JSONL:
+		simulations, charts := name+"-simulations.jsonl", name+"-charts.jsonl"
+		return []string{simulations, charts}, writeAll(
+			simulations, func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				for _, s := range e.Simulations {
+					s.Charts = nil
+					if err := enc.Encode(s); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			charts, func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				for _, s := range e.Simulations {
+					for _, c := range s.Charts {
+						if err := enc.Encode(c); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+	case CSV:
+		simulations, charts := name+"-simulations.csv", name+"-charts.csv"
+		return []string{simulations, charts}, writeAll(
+			simulations, func(w io.Writer) error {
+				records := [][]string{simulationHeader}
+				for _, s := range e.Simulations {
+					records = append(records, s.record())
+				}
+				return csv.NewWriter(w).WriteAll(records)
+			},
+			charts, func(w io.Writer) error {
+				records := [][]string{chartHeader}
+				for _, s := range e.Simulations {
+					for _, c := range s.Charts {
+						records = append(records, c.record())
+					}
+				}
+				return csv.NewWriter(w).WriteAll(records)
+			})
+	}
+
+	return nil, ValidateFormat(format)
+}
+
+// ValidateFormat returns an error if the given output format is not one Write supports.
+func ValidateFormat(format string) error {
+	switch format {
+	case JSON, JSONL, CSV:
+		return nil
+	}
+	return fmt.Errorf("unknown output format [%s], expected %s, %s or %s", format, JSON, JSONL, CSV)
+}
+
+func (s SimulationExport) record() []string {
+	return []string{
+		s.ProductID,
+		s.Type,
+		formatFloat(s.Gain),
+		formatFloat(s.Loss),
+		formatFloat(s.Size),
+		formatFloat(s.Delta),
+		strconv.Itoa(s.Won),
+		strconv.Itoa(s.Lost),
+		strconv.Itoa(s.Even),
+		strconv.Itoa(s.Trading),
+		formatFloat(s.WonResult),
+		formatFloat(s.LostResult),
+		formatFloat(s.TradingResult),
+		formatFloat(s.Entries),
+		formatFloat(s.Result),
+		formatFloat(s.Net),
+		formatFloat(s.SizedEntries),
+		formatFloat(s.SizedResult),
+	}
+}
+
+func (c ChartExport) record() []string {
+
+	var closed, start, end string
+	if c.Closed != nil {
+		closed = c.Closed.Format(time.RFC3339)
+	}
+	if len(c.Rates) > 0 {
+		start = c.Rates[0].Time.Format(time.RFC3339)
+		end = c.Rates[len(c.Rates)-1].Time.Format(time.RFC3339)
+	}
+
+	return []string{
+		c.ProductID,
+		c.Status,
+		c.Opened.Format(time.RFC3339),
+		closed,
+		formatFloat(c.Duration),
+		formatFloat(c.Entry),
+		formatFloat(c.Goal),
+		formatFloat(c.Loss),
+		formatFloat(c.Exit),
+		formatFloat(c.Last),
+		formatFloat(c.MakerFee),
+		formatFloat(c.TakerFee),
+		formatFloat(c.EntryFee),
+		formatFloat(c.Size),
+		formatFloat(c.Result),
+		strconv.Itoa(len(c.Rates)),
+		start,
+		end,
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func write(path string, fn func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeAll(path string, fn func(w io.Writer) error, otherPath string, otherFn func(w io.Writer) error) error {
+	if err := write(path, fn); err != nil {
+		return err
+	}
+	return write(otherPath, otherFn)
+}
+
+func logExport(paths []string) {
+	for _, path := range paths {
+		log.Info().Str(util.Link, path).Msg(util.Tuna + " ... export")
+	}
+}
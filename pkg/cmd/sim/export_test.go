@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExportWrite(t *testing.T) {
+
+	opened := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	closed := opened.Add(time.Minute * 5)
+
+	s := simulation{
+		productID: "ALGO-USD",
+		Won:       []Chart{{Opened: opened, Closed: closed, Entry: 1, Exit: 1.1}},
+		Trading:   []Chart{{Opened: opened.Add(time.Minute), Entry: 1, Last: .9}},
+	}
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Gain: .1, Loss: .1, Size: 1, Delta: .001, Type: cbp.TweezerBottom}
+
+	e := &Export{SchemaVersion: SchemaVersion, Generated: opened, Alpha: opened, Omega: closed}
+	e.Simulations = append(e.Simulations, newSimulationExport(pattern, s))
+
+	if c := e.Simulations[0].Charts[0]; c.Status != "won" || c.Duration != 300 {
+		t.Errorf("unexpected chart export %+v", c)
+	}
+	if c := e.Simulations[0].Charts[1]; c.Status != "trading" || c.Closed != nil {
+		t.Errorf("unexpected chart export %+v", c)
+	}
+
+	dir := t.TempDir()
+
+	paths, err := e.Write(dir, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Export
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SchemaVersion != SchemaVersion || len(decoded.Simulations[0].Charts) != 2 {
+		t.Errorf("unexpected json export %+v", decoded)
+	}
+
+	paths, err = e.Write(dir, JSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := lines(t, paths[1]); n != 2 {
+		t.Errorf("jsonl charts = %d, want 2", n)
+	}
+
+	paths, err = e.Write(dir, CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[0]) != len(chartHeader) || records[0][0] != "product_id" {
+		t.Errorf("unexpected csv charts %v", records)
+	}
+
+	if _, err := e.Write(dir, "parquet"); err == nil {
+		t.Error("expected an unknown format error")
+	}
+}
+
+func lines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var n int
+	for scanner := bufio.NewScanner(f); scanner.Scan(); n++ {
+	}
+	return n
+}
@@ -0,0 +1,342 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/db"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SimRun is a persisted simulation run, the session parameters it ran with and the simulation of every product.
+type SimRun struct {
+	gorm.Model
+	Alpha       time.Time
+	Omega       time.Time
+	Products    string
+	WinnersOnly bool
+	NoLosers    bool
+	Slippage    float64
+	Spread      float64
+	Latency     int
+	StopAtLow   bool
+	Simulations []SimRunSimulation
+}
+
+// SimRunSimulation is the persisted pattern criteria and totals of a product simulation.
+type SimRunSimulation struct {
+	gorm.Model
+	SimRunID     uint   `gorm:"index"`
+	ProductID    string `gorm:"index"`
+	Type         string
+	Gain         float64
+	Loss         float64
+	Size         float64
+	Delta        float64
+	Won          int
+	Lost         int
+	Even         int
+	Trading      int
+	Entries      float64
+	Result       float64
+	SizedEntries float64
+	SizedResult  float64
+	Charts       []SimRunChart
+}
+
+// SimRunChart is the persisted outcome of a simulated trade.
+type SimRunChart struct {
+	gorm.Model
+	SimRunSimulationID uint `gorm:"index"`
+	Status             string
+	Opened             time.Time
+	Closed             *time.Time
+	Entry              float64
+	Goal               float64
+	Loss               float64
+	Exit               float64
+	Last               float64
+	MakerFee           float64
+	TakerFee           float64
+	EntryFee           float64
+	Size               float64
+	Result             float64
+}
+
+// Net is the result of the simulation in USD, after fees and at the size of every chart. Runs persisted before chart
+// sizes were kept fall back to the pattern size.
+func (s *SimRunSimulation) Net() float64 {
+	if s.sized() {
+		return s.SizedResult
+	}
+	return s.Result * s.Size
+}
+
+// Volume is the USD amount of every simulation entry at the size of every chart. Runs persisted before chart sizes
+// were kept fall back to the pattern size.
+func (s *SimRunSimulation) Volume() float64 {
+	if s.sized() {
+		return s.SizedEntries
+	}
+	return s.Entries * s.Size
+}
+
+func (s *SimRunSimulation) sized() bool {
+	return s.SizedEntries != 0 || s.SizedResult != 0
+}
+
+func (r *SimRun) totals() (net, volume float64, won int) {
+	for _, s := range r.Simulations {
+		net += s.Net()
+		volume += s.Volume()
+		won += s.Won
+	}
+	return
+}
+
+func newDB() (*gorm.DB, error) {
+	return db.NewDB(&SimRun{}, &SimRunSimulation{}, &SimRunChart{})
+}
+
+// saveRun persists the given simulations as a new run and returns its id.
+func saveRun(session *config.Session, winnersOnly, noLosers bool, simulations []simulation) (uint, error) {
+
+	run := &SimRun{
+		Alpha:       *session.Alpha,
+		Omega:       *session.Omega,
+		Products:    strings.Join(session.UsdSelectionProductIDs(), ","),
+		WinnersOnly: winnersOnly,
+		NoLosers:    noLosers,
+	}
+
+	if session.FillModel != nil {
+		run.Slippage = session.Slippage
+		run.Spread = session.Spread
+		run.Latency = session.Latency
+		run.StopAtLow = session.StopAtLow
+	}
+
+	for _, s := range simulations {
+		e := newSimulationExport(session.GetPattern(s.productID), s)
+		rs := SimRunSimulation{
+			ProductID:    e.ProductID,
+			Type:         e.Type,
+			Gain:         e.Gain,
+			Loss:         e.Loss,
+			Size:         e.Size,
+			Delta:        e.Delta,
+			Won:          e.Won,
+			Lost:         e.Lost,
+			Even:         e.Even,
+			Trading:      e.Trading,
+			Entries:      e.Entries,
+			Result:       e.Result,
+			SizedEntries: e.SizedEntries,
+			SizedResult:  e.SizedResult,
+		}
+		for _, c := range e.Charts {
+			rs.Charts = append(rs.Charts, SimRunChart{
+				Status:   c.Status,
+				Opened:   c.Opened,
+				Closed:   c.Closed,
+				Entry:    c.Entry,
+				Goal:     c.Goal,
+				Loss:     c.Loss,
+				Exit:     c.Exit,
+				Last:     c.Last,
+				MakerFee: c.MakerFee,
+				TakerFee: c.TakerFee,
+				EntryFee: c.EntryFee,
+				Size:     c.Size,
+				Result:   c.Result,
+			})
+		}
+		run.Simulations = append(run.Simulations, rs)
+	}
+
+	pg, err := newDB()
+	if err != nil {
+		return 0, err
+	}
+	if err := pg.Create(run).Error; err != nil {
+		return 0, err
+	}
+
+	return run.ID, nil
+}
+
+// NewHistory logs every persisted simulation run, newest first.
+func NewHistory() error {
+
+	log.Info().Msg(util.Tuna + " .")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " ... history")
+	log.Info().Msg(util.Tuna + " ..")
+
+	pg, err := newDB()
+	if err != nil {
+		return err
+	}
+
+	var runs []SimRun
+	if err := pg.Preload("Simulations").Order("id desc").Find(&runs).Error; err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		net, volume, won := run.totals()
+		log.Info().
+			Uint("run", run.ID).
+			Time("created", run.CreatedAt).
+			Time(util.Alpha, run.Alpha).
+			Time(util.Omega, run.Omega).
+			Int(util.Quantity, len(run.Simulations)).
+			Int(util.Won, won).
+			Str(util.Net, util.Usd(net)).
+			Str(util.Volume, util.Usd(volume)).
+			Msg(util.Tuna + " ...")
+	}
+
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " .")
+
+	return nil
+}
+
+// NewDiff logs how the pattern criteria, net, win count and volume of every product changed from run a to run b.
+func NewDiff(a, b string) error {
+
+	log.Info().Msg(util.Tuna + " .")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msgf("%s ... diff %s %s", util.Tuna, a, b)
+	log.Info().Msg(util.Tuna + " ..")
+
+	runA, err := getRun(a)
+	if err != nil {
+		return err
+	}
+
+	runB, err := getRun(b)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range diff(runA, runB) {
+		log.Info().
+			Str("criteria", d.criteria).
+			Str(util.Net, fmt.Sprintf("%s > %s", util.Usd(d.a.Net()), util.Usd(d.b.Net()))).
+			Str(util.Won, fmt.Sprintf("%d > %d", d.a.Won, d.b.Won)).
+			Str(util.Volume, fmt.Sprintf("%s > %s", util.Usd(d.a.Volume()), util.Usd(d.b.Volume()))).
+			Msg(util.Tuna + util.Break + util.GetCurrency(d.productID))
+	}
+
+	netA, volumeA, wonA := runA.totals()
+	netB, volumeB, wonB := runB.totals()
+
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Str("     "+util.Net, util.Usd(netB-netA)).Msg(util.Tuna + " ...")
+	log.Info().Int("     "+util.Won, wonB-wonA).Msg(util.Tuna + " ...")
+	log.Info().Str("     "+util.Volume, util.Usd(volumeB-volumeA)).Msg(util.Tuna + " ...")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " .")
+
+	return nil
+}
+
+func getRun(id string) (*SimRun, error) {
+	i, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run [%s]", id)
+	}
+	pg, err := newDB()
+	if err != nil {
+		return nil, err
+	}
+	run := new(SimRun)
+	if err := pg.Preload("Simulations").First(run, uint(i)).Error; err != nil {
+		return nil, fmt.Errorf("run [%s], %v", id, err)
+	}
+	return run, nil
+}
+
+// runDiff is a product simulation of two runs, where a product missing from a run has an empty simulation.
+type runDiff struct {
+	productID string
+	criteria  string
+	a, b      SimRunSimulation
+}
+
+func diff(a, b *SimRun) []runDiff {
+
+	diffs := map[string]*runDiff{}
+	for _, s := range a.Simulations {
+		diffs[s.ProductID] = &runDiff{productID: s.ProductID, a: s}
+	}
+	for _, s := range b.Simulations {
+		if d, ok := diffs[s.ProductID]; ok {
+			d.b = s
+		} else {
+			diffs[s.ProductID] = &runDiff{productID: s.ProductID, b: s}
+		}
+	}
+
+	var results []runDiff
+	for _, d := range diffs {
+		d.criteria = criteria(d.a, d.b)
+		results = append(results, *d)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].productID < results[j].productID
+	})
+
+	return results
+}
+
+// criteria describes the pattern criteria that changed between the given simulations.
+func criteria(a, b SimRunSimulation) string {
+	var changes []string
+	if a.Type != b.Type {
+		changes = append(changes, fmt.Sprintf("type %s > %s", a.Type, b.Type))
+	}
+	for _, c := range []struct {
+		name string
+		a, b float64
+	}{
+		{"gain", a.Gain, b.Gain},
+		{"loss", a.Loss, b.Loss},
+		{"size", a.Size, b.Size},
+		{"delta", a.Delta, b.Delta},
+	} {
+		if c.a != c.b {
+			changes = append(changes, fmt.Sprintf("%s %g > %g", c.name, c.a, c.b))
+		}
+	}
+	if len(changes) == 0 {
+		return "same"
+	}
+	return strings.Join(changes, ", ")
+}
@@ -0,0 +1,56 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+
+	a := &SimRun{Simulations: []SimRunSimulation{
+		{ProductID: "XLM-USD", Type: "tweezer", Gain: .02, Size: 1, Won: 2, Entries: 3, Result: .1},
+		{ProductID: "ALGO-USD", Type: "tweezer", Gain: .02, Size: 1, Won: 1, Entries: 1, Result: .05},
+	}}
+	b := &SimRun{Simulations: []SimRunSimulation{
+		{ProductID: "XLM-USD", Type: "hammer", Gain: .03, Size: 2, Won: 3, Entries: 4, Result: .2},
+		{ProductID: "TRB-USD", Type: "tweezer", Gain: .02, Size: 1, Won: 1, Entries: 1, Result: .01},
+	}}
+
+	diffs := diff(a, b)
+	if len(diffs) != 3 || diffs[0].productID != "ALGO-USD" || diffs[2].productID != "XLM-USD" {
+		t.Fatalf("unexpected diffs %+v", diffs)
+	}
+
+	if diffs[0].b.ProductID != "" {
+		t.Error("expected a product missing from run b to have an empty simulation")
+	}
+
+	if c := diffs[2].criteria; c != "type tweezer > hammer, gain 0.02 > 0.03, size 1 > 2" {
+		t.Errorf("criteria = %s", c)
+	}
+
+	if net := diffs[2].b.Net(); net != .4 {
+		t.Errorf("net = %f, want .4", net)
+	}
+
+	netA, volumeA, wonA := a.totals()
+	netB, volumeB, wonB := b.totals()
+	if wonB-wonA != 1 || volumeB-volumeA != 5 || netB-netA <= 0 {
+		t.Errorf("unexpected totals, net %f > %f, volume %f > %f, won %d > %d", netA, netB, volumeA, volumeB, wonA, wonB)
+	}
+}
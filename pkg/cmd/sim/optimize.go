@@ -0,0 +1,304 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	Grid   = "grid"
+	Random = "random"
+
+	NetProfit = "net"
+	WinRate   = "winrate"
+	Drawdown  = "drawdown"
+)
+
+// Search defines the pattern values an optimization evaluates, and how the results are ranked.
+type Search struct {
+
+	// Method is either grid, every combination of the given values, or random, samples drawn between their bounds.
+	Method string
+
+	// Objective ranks results by net profit, win rate or max drawdown.
+	Objective string
+
+	// Gains, Losses, Deltas and Sizes are the pattern values to search, the configured value is used when empty.
+	Gains, Losses, Deltas, Sizes []float64
+
+	// Samples is the amount of random combinations to evaluate per product.
+	Samples int
+
+	// Seed is the random source seed, making a random search repeatable.
+	Seed int64
+
+	// Workers is the amount of simulations evaluated in parallel.
+	Workers int
+
+	// Balance is the USD balance percent and kelly sized patterns enter with.
+	Balance float64
+}
+
+// optimization is the result of simulating a single pattern candidate.
+type optimization struct {
+	pattern  cbp.Pattern
+	net      float64
+	winRate  float64
+	drawdown float64
+	entries  int
+	won      int
+	closed   int
+}
+
+// NewOptimization searches pattern values for every selected product over the session period rates, and prints the
+// best configuration of each as a patterns block for the nuchal.yml configuration file.
+func NewOptimization(session *config.Session, search Search, out string) error {
+
+	log.Info().Msg(util.Tuna + " .")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " ... optimize")
+	log.Info().Msg(util.Tuna + " ..")
+
+	if err := search.validate(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	random := rand.New(rand.NewSource(search.Seed))
+
+	var best []cbp.Pattern
+	for _, productID := range session.UsdSelectionProductIDs() {
+
+		rates := getRates(session, productID)
+		if len(rates) == 0 {
+			continue
+		}
+
+		candidates, err := search.candidates(session.GetPattern(productID), random)
+		if err != nil {
+			return err
+		}
+
+		results := optimize(session, session.FillModel, candidates, rates, search.Workers, search.Balance)
+		rank(results, search.Objective)
+		if len(results) == 0 || results[0].entries == 0 {
+			log.Info().Msg(util.Tuna + util.Break + util.GetCurrency(productID) + util.Break + util.Ex)
+			continue
+		}
+
+		result := results[0]
+		if result.pattern.Sizing == cbp.KellySizing {
+			result.pattern.WinRate = math.Round(result.winRate*1e4) / 1e4
+		}
+		best = append(best, result.pattern)
+
+		log.Info().
+			Int(util.Quantity, len(candidates)).
+			Float64(util.Goal, result.pattern.Gain).
+			Float64("loss", result.pattern.Loss).
+			Float64(util.Delta, result.pattern.Delta).
+			Float64("size", result.pattern.Size).
+			Msg(util.Tuna + util.Break + util.GetCurrency(productID))
+		log.Info().
+			Str(util.Sigma, util.Usd(result.net)).
+			Str("%", util.Money(result.winRate*100)).
+			Str("drawdown", util.Usd(result.drawdown)).
+			Int("entries", result.entries).
+			Msg(util.Tuna + util.Break + util.Flag)
+		log.Info().Msg(util.Tuna + " ..")
+	}
+
+	log.Info().Msgf("%s ... optimization generated in %f seconds", util.Tuna, time.Now().Sub(start).Seconds())
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " .")
+
+	b, err := yaml.Marshal(config.ParagonConfig{Patterns: best})
+	if err != nil {
+		return err
+	}
+
+	if out != "" {
+		return os.WriteFile(out, b, 0644)
+	}
+
+	fmt.Println(string(b))
+	return nil
+}
+
+func (s *Search) validate() error {
+	switch s.Objective {
+	case NetProfit, WinRate, Drawdown:
+	default:
+		return fmt.Errorf("unknown objective [%s], expected %s, %s or %s", s.Objective, NetProfit, WinRate, Drawdown)
+	}
+	if s.Workers < 1 {
+		s.Workers = runtime.NumCPU()
+	}
+	return nil
+}
+
+// candidates returns the patterns to evaluate, each a copy of the given pattern with searched values.
+func (s *Search) candidates(pattern *cbp.Pattern, random *rand.Rand) ([]cbp.Pattern, error) {
+
+	gains := values(s.Gains, pattern.Gain)
+	losses := values(s.Losses, pattern.Loss)
+	deltas := values(s.Deltas, pattern.Delta)
+	sizes := values(s.Sizes, pattern.Size)
+
+	var candidates []cbp.Pattern
+
+	switch s.Method {
+	case Grid:
+		for _, gain := range gains {
+			for _, loss := range losses {
+				for _, delta := range deltas {
+					for _, size := range sizes {
+						candidates = append(candidates, candidate(pattern, gain, loss, delta, size))
+					}
+				}
+			}
+		}
+	case Random:
+		for i := 0; i < s.Samples; i++ {
+			candidates = append(candidates, candidate(pattern,
+				sample(random, gains),
+				sample(random, losses),
+				sample(random, deltas),
+				sample(random, sizes)))
+		}
+	default:
+		return nil, fmt.Errorf("unknown search method [%s], expected %s or %s", s.Method, Grid, Random)
+	}
+
+	return candidates, nil
+}
+
+func candidate(pattern *cbp.Pattern, gain, loss, delta, size float64) cbp.Pattern {
+	p := *pattern
+	p.Gain = gain
+	p.Loss = loss
+	p.Delta = delta
+	p.Size = size
+	return p
+}
+
+func values(fs []float64, f float64) []float64 {
+	if len(fs) == 0 {
+		return []float64{f}
+	}
+	return fs
+}
+
+// sample returns a value drawn uniformly between the lowest and highest of the given values.
+func sample(random *rand.Rand, fs []float64) float64 {
+	lo, hi := fs[0], fs[0]
+	for _, f := range fs {
+		lo = math.Min(lo, f)
+		hi = math.Max(hi, f)
+	}
+	return math.Round((lo+random.Float64()*(hi-lo))*1e6) / 1e6
+}
+
+// optimize simulates every candidate over the given rates and period with the given fill model, amount of workers and
+// USD balance.
+func optimize(period period, fills *config.FillModel, candidates []cbp.Pattern, rates []cbp.Rate, workers int, balance float64) []optimization {
+
+	results := make([]optimization, len(candidates))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				s := simulation{quiet: true, fills: fills, balance: balance}
+				newSimulation(period, &candidates[i], rates, &s)
+				results[i] = newOptimization(candidates[i], s)
+			}
+		}()
+	}
+
+	for i := range candidates {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func newOptimization(pattern cbp.Pattern, s simulation) optimization {
+
+	o := optimization{pattern: pattern}
+	o.entries = s.WonLen() + s.LostLen() + s.TradingLen() + s.EvenLen()
+
+	o.won = s.WonLen()
+	o.closed = s.WonLen() + s.LostLen() + s.EvenLen()
+	if o.closed > 0 {
+		o.winRate = float64(o.won) / float64(o.closed)
+	}
+
+	var peak float64
+	for _, chart := range s.charts() {
+		o.net += chart.result() * chart.Size
+		peak = math.Max(peak, o.net)
+		o.drawdown = math.Max(o.drawdown, peak-o.net)
+	}
+
+	return o
+}
+
+// rank sorts the given results from best to worst by the given objective, breaking ties with net profit. Results
+// without entries are always last, and profitable results rank ahead of others when minimizing drawdown.
+func rank(results []optimization, objective string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.entries == 0) != (b.entries == 0) {
+			return a.entries > 0
+		}
+		switch objective {
+		case WinRate:
+			if a.winRate != b.winRate {
+				return a.winRate > b.winRate
+			}
+		case Drawdown:
+			if (a.net > 0) != (b.net > 0) {
+				return a.net > 0
+			}
+			if a.drawdown != b.drawdown {
+				return a.drawdown < b.drawdown
+			}
+		}
+		return a.net > b.net
+	})
+}
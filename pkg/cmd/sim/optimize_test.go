@@ -0,0 +1,95 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSearchCandidates(t *testing.T) {
+
+	pattern := &cbp.Pattern{ID: "BTC-USD", Gain: .02, Loss: .1, Delta: .001, Size: 1, Type: cbp.Hammer}
+
+	grid := Search{Method: Grid, Gains: []float64{.01, .02}, Losses: []float64{.05, .1, .2}}
+	candidates, err := grid.candidates(pattern, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 6 {
+		t.Fatalf("grid candidates = %d, want 6", len(candidates))
+	}
+	for _, c := range candidates {
+		if c.Delta != .001 || c.Size != 1 || c.Type != cbp.Hammer {
+			t.Errorf("expected unsearched values to be kept, got %+v", c)
+		}
+	}
+
+	random := Search{Method: Random, Samples: 25, Gains: []float64{.01, .05}}
+	candidates, err = random.candidates(pattern, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 25 {
+		t.Fatalf("random candidates = %d, want 25", len(candidates))
+	}
+	for _, c := range candidates {
+		if c.Gain < .01 || c.Gain > .05 || c.Loss != .1 {
+			t.Errorf("expected a gain between bounds, got %+v", c)
+		}
+	}
+
+	if _, err := (&Search{Method: "annealing"}).candidates(pattern, nil); err == nil {
+		t.Error("expected an unknown method error")
+	}
+}
+
+func TestRank(t *testing.T) {
+
+	chart := func(minute int, entry, exit float64) Chart {
+		return Chart{Opened: time.Unix(int64(minute*60), 0), Entry: entry, Exit: exit, Size: 1}
+	}
+
+	steady := newOptimization(cbp.Pattern{ID: "steady", Size: 1}, simulation{
+		Won:  []Chart{chart(1, 1, 1.5), chart(3, 1, 1.5)},
+		Lost: []Chart{chart(2, 1, .5)},
+	})
+	if steady.net != .5 || steady.drawdown != .5 || steady.winRate != 2.0/3 {
+		t.Errorf("unexpected steady result %+v", steady)
+	}
+
+	greedy := newOptimization(cbp.Pattern{ID: "greedy", Size: 1}, simulation{
+		Won:  []Chart{chart(1, 1, 3)},
+		Lost: []Chart{chart(2, 1, .5), chart(3, 1, .5)},
+	})
+	idle := newOptimization(cbp.Pattern{ID: "idle", Size: 1}, simulation{})
+
+	for objective, want := range map[string]string{NetProfit: "greedy", WinRate: "steady", Drawdown: "steady"} {
+		results := []optimization{idle, greedy, steady}
+		rank(results, objective)
+		if results[0].pattern.ID != want {
+			t.Errorf("%s ranked %s first, want %s", objective, results[0].pattern.ID, want)
+		}
+		if results[2].pattern.ID != "idle" {
+			t.Errorf("%s ranked %s last, want idle", objective, results[2].pattern.ID)
+		}
+	}
+}
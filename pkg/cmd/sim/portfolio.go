@@ -0,0 +1,329 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/go-echarts/go-echarts/v2/render"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Portfolio defines the shared capital and limits of a portfolio backtest.
+type Portfolio struct {
+
+	// USD is the starting balance shared by every product.
+	USD float64
+
+	// MaxPositions is the largest amount of positions open at once, zero is unlimited.
+	MaxPositions int
+
+	// MaxExposure is the largest USD cost of the open positions of a single product, zero is unlimited.
+	MaxExposure float64
+}
+
+// Equity is a point on the portfolio equity curve.
+type Equity struct {
+
+	// Time of the rates valuing the portfolio.
+	Time time.Time
+
+	// Value is the USD balance plus the value of every open position at the last close of its product.
+	Value float64
+
+	// Drawdown is the fraction the value is below the highest value before it.
+	Drawdown float64
+}
+
+type position struct {
+	productID string
+	pattern   *cbp.Pattern
+	chart     Chart
+	size      float64
+}
+
+// backtest is the result of walking every product chart on a single timeline with shared capital.
+type backtest struct {
+	Portfolio
+	usd       float64
+	open      []position
+	exposure  map[string]float64
+	last      map[string]float64
+	curve     []Equity
+	peak      float64
+	entries   int
+	exits     int
+	funds     int
+	limits    int
+	drawdown  float64
+	positions int
+}
+
+// NewPortfolio simulates every selected product, then backtests the resulting trades as a single portfolio, logging
+// a summary and rendering the equity curve and drawdown series before serving the simulation site.
+func NewPortfolio(session *config.Session, portfolio Portfolio) error {
+
+	log.Info().Msg(util.Tuna + " .")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " ... portfolio")
+	log.Info().Msg(util.Tuna + " ..")
+
+	rates := map[string][]cbp.Rate{}
+	patterns := map[string]*cbp.Pattern{}
+	trades := map[string][]Chart{}
+
+	var simulations []simulation
+	for _, productID := range session.UsdSelectionProductIDs() {
+
+		rates[productID] = getRates(session, productID)
+
+		pattern := session.GetPattern(productID)
+		patterns[productID] = pattern
+
+		s := simulation{quiet: true, fills: session.FillModel, balance: portfolio.USD}
+		newSimulation(session, pattern, rates[productID], &s)
+		if s.TotalEntries() == 0 {
+			continue
+		}
+
+		simulations = append(simulations, s)
+		trades[productID] = s.charts()
+	}
+
+	b := portfolio.backtest(patterns, rates, trades)
+
+	last := Equity{Value: portfolio.USD}
+	if len(b.curve) > 0 {
+		last = b.curve[len(b.curve)-1]
+	}
+
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Str("     "+util.Dollar, util.Usd(portfolio.USD)).Msg(util.Tuna + " ... start")
+	log.Info().Str("     "+util.Dollar, util.Usd(last.Value)).Msg(util.Tuna + " ... equity")
+	log.Info().Str("      %", util.Money((last.Value/portfolio.USD-1)*100)).Msg(util.Tuna + " ... return")
+	log.Info().Str("      %", util.Money(b.drawdown*100)).Msg(util.Tuna + " ... max drawdown")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Int("     "+util.Quantity, b.entries).Msg(util.Tuna + " ... entries")
+	log.Info().Int("     "+util.Quantity, b.exits).Msg(util.Tuna + " ... exits")
+	log.Info().Int("     "+util.Quantity, b.positions).Msg(util.Tuna + " ... most positions")
+	log.Info().Int("     "+util.Quantity, b.funds).Msg(util.Tuna + " ... skipped, insufficient funds")
+	log.Info().Int("     "+util.Quantity, b.limits).Msg(util.Tuna + " ... skipped, position limits")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msgf("%s ... portfolio chart http://localhost:%d/portfolio.html", util.Tuna, port())
+	log.Info().Msg(util.Tuna + " ..")
+
+	if err := newPortfolioPage(b.curve); err != nil {
+		return err
+	}
+
+	return newSite(context.Background(), simulations)
+}
+
+// backtest walks the rates of every product on a single timeline, entering and exiting the given trades with the
+// portfolio balance, where entries exceeding the balance or the portfolio limits are skipped. Every entry is sized
+// by its pattern with the balance available when it opens.
+func (p Portfolio) backtest(patterns map[string]*cbp.Pattern, rates map[string][]cbp.Rate, trades map[string][]Chart) *backtest {
+
+	b := &backtest{Portfolio: p, usd: p.USD, peak: p.USD}
+	b.exposure = map[string]float64{}
+	b.last = map[string]float64{}
+
+	type tick struct {
+		productID string
+		rate      cbp.Rate
+	}
+
+	var ticks []tick
+	for productID, rr := range rates {
+		for _, rate := range rr {
+			ticks = append(ticks, tick{productID, rate})
+		}
+	}
+	sort.SliceStable(ticks, func(i, j int) bool {
+		if ti, tj := ticks[i].rate.Time(), ticks[j].rate.Time(); !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return ticks[i].productID < ticks[j].productID
+	})
+
+	var entries []position
+	for productID, charts := range trades {
+		for _, chart := range charts {
+			entries = append(entries, position{productID: productID, pattern: patterns[productID], chart: chart})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if ti, tj := entries[i].chart.Opened, entries[j].chart.Opened; !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return entries[i].productID < entries[j].productID
+	})
+
+	for i := 0; i < len(ticks); {
+
+		t := ticks[i].rate.Time()
+		for ; i < len(ticks) && ticks[i].rate.Time().Equal(t); i++ {
+			b.last[ticks[i].productID] = ticks[i].rate.Close
+		}
+
+		// entries fill at the open, before any exit during the same rate
+		for len(entries) > 0 && !entries[0].chart.Opened.After(t) {
+			b.enter(entries[0])
+			entries = entries[1:]
+		}
+
+		b.exit(t)
+		b.mark(t)
+	}
+
+	return b
+}
+
+func (b *backtest) enter(p position) {
+
+	if b.MaxPositions > 0 && len(b.open) >= b.MaxPositions {
+		b.limits++
+		return
+	}
+
+	size, err := p.pattern.EntrySize(p.chart.Entry, b.usd, p.chart.ATR)
+	if err != nil {
+		b.funds++
+		return
+	}
+	p.size = size
+
+	cost := p.size * p.chart.entryPlusFee()
+	if b.MaxExposure > 0 && b.exposure[p.productID]+cost > b.MaxExposure {
+		b.limits++
+		return
+	}
+
+	// mirrors the insufficient funds error of a live market buy order
+	if cost > b.usd {
+		b.funds++
+		return
+	}
+
+	b.usd -= cost
+	b.exposure[p.productID] += cost
+	b.open = append(b.open, p)
+	b.entries++
+	b.positions = int(math.Max(float64(b.positions), float64(len(b.open))))
+}
+
+func (b *backtest) exit(t time.Time) {
+	var open []position
+	for _, p := range b.open {
+		if p.chart.Closed.IsZero() || p.chart.Closed.After(t) {
+			open = append(open, p)
+			continue
+		}
+		b.usd += p.size * p.chart.Exit * (1 - p.chart.MakerFee)
+		b.exposure[p.productID] -= p.size * p.chart.entryPlusFee()
+		b.exits++
+	}
+	b.open = open
+}
+
+func (b *backtest) mark(t time.Time) {
+
+	value := b.usd
+	for _, p := range b.open {
+		value += p.size * b.last[p.productID]
+	}
+
+	b.peak = math.Max(b.peak, value)
+
+	var drawdown float64
+	if b.peak > 0 {
+		drawdown = (b.peak - value) / b.peak
+	}
+	b.drawdown = math.Max(b.drawdown, drawdown)
+
+	b.curve = append(b.curve, Equity{t, value, drawdown})
+}
+
+func (s *simulation) charts() []Chart {
+	var charts []Chart
+	charts = append(charts, s.Won...)
+	charts = append(charts, s.Lost...)
+	charts = append(charts, s.Even...)
+	charts = append(charts, s.Trading...)
+	sort.SliceStable(charts, func(i, j int) bool {
+		return charts[i].Opened.Before(charts[j].Opened)
+	})
+	return charts
+}
+
+func newPortfolioPage(curve []Equity) error {
+
+	x := make([]string, 0)
+	equity := make([]opts.LineData, 0)
+	drawdown := make([]opts.LineData, 0)
+	for _, e := range curve {
+		x = append(x, e.Time.Format(time.Kitchen))
+		equity = append(equity, opts.LineData{Value: fmt.Sprintf("%.2f", e.Value)})
+		drawdown = append(drawdown, opts.LineData{Value: fmt.Sprintf("%.2f", -e.Drawdown*100)})
+	}
+
+	newLine := func(title, name string, data []opts.LineData) *charts.Line {
+		line := charts.NewLine()
+		line.SetGlobalOptions(
+			charts.WithTitleOpts(opts.Title{Title: title}),
+			charts.WithYAxisOpts(opts.YAxis{Scale: true}),
+			charts.WithDataZoomOpts(opts.DataZoom{Start: 0, End: 100, XAxisIndex: []int{0}}),
+		)
+		line.SetXAxis(x).AddSeries(name, data)
+		return line
+	}
+
+	page := &components.Page{}
+	page.Assets.InitAssets()
+	page.Renderer = render.NewPageRender(page, page.Validate)
+	page.Layout = components.PageFlexLayout
+	page.PageTitle = "nuchal | portfolio"
+	page.AddCharts(
+		newLine("equity", "usd", equity),
+		newLine("drawdown", "%", drawdown),
+	)
+
+	if err := util.MakePath("html"); err != nil {
+		return err
+	}
+
+	f, err := os.Create("./html/portfolio.html")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return page.Render(io.MultiWriter(f))
+}
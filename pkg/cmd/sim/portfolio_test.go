@@ -0,0 +1,85 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPortfolioBacktest(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	minute := func(i int) time.Time {
+		return alpha.Add(time.Minute * time.Duration(i))
+	}
+
+	series := func(productID string, closes ...float64) []cbp.Rate {
+		var rates []cbp.Rate
+		for i, c := range closes {
+			rates = append(rates, *cbp.NewRate(productID, cb.HistoricRate{Time: minute(i), Open: c, Close: c}))
+		}
+		return rates
+	}
+
+	rates := map[string][]cbp.Rate{
+		"ALGO-USD": series("ALGO-USD", 1, 1, .5, .5, 2),
+		"XLM-USD":  series("XLM-USD", 1, 1, 1, 1, 1),
+	}
+
+	trades := map[string][]Chart{
+		"ALGO-USD": {
+			{Opened: minute(0), Closed: minute(3), Entry: 1, Exit: .5},
+			{Opened: minute(4), Entry: 1.5},
+		},
+		"XLM-USD": {
+			{Opened: minute(1), Closed: minute(2), Entry: 1, Exit: 1.2},
+			{Opened: minute(1), Entry: 1},
+		},
+	}
+
+	patterns := map[string]*cbp.Pattern{
+		"ALGO-USD": {ID: "ALGO-USD", Sizing: cbp.PercentSizing, Percent: .6},
+		"XLM-USD":  {ID: "XLM-USD", Sizing: cbp.UsdSizing, Usd: 50},
+	}
+
+	b := Portfolio{USD: 100, MaxPositions: 2}.backtest(patterns, rates, trades)
+
+	// algo spends 60% of 100, leaving too little for either xlm entry of 50, then loses 30 and reenters with 60% of 70
+	// at 1.5, worth 2 at the last close
+	if b.entries != 2 || b.funds != 2 || b.limits != 0 {
+		t.Errorf("entries %d, funds %d, limits %d", b.entries, b.funds, b.limits)
+	}
+	if last := b.curve[len(b.curve)-1]; math.Abs(last.Value-84) > 1e-9 {
+		t.Errorf("equity = %f, want 84", last.Value)
+	}
+	if math.Abs(b.drawdown-.3) > 1e-9 {
+		t.Errorf("drawdown = %f, want .3", b.drawdown)
+	}
+
+	// the second xlm entry exceeds the positions limit, while usd sizing keeps the algo reentry within exposure
+	patterns["ALGO-USD"] = &cbp.Pattern{ID: "ALGO-USD", Sizing: cbp.UsdSizing, Usd: 60}
+	b = Portfolio{USD: 1000, MaxPositions: 2, MaxExposure: 60}.backtest(patterns, rates, trades)
+	if b.entries != 3 || b.limits != 1 || b.positions != 2 {
+		t.Errorf("entries %d, limits %d, positions %d", b.entries, b.limits, b.positions)
+	}
+}
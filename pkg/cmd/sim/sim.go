@@ -19,6 +19,7 @@
 package sim
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-echarts/go-echarts/v2/components"
 	"github.com/go-echarts/go-echarts/v2/render"
@@ -36,11 +37,22 @@ import (
 	"time"
 )
 
-var rates []cbp.Rate
-
 // New creates a new simulation, and boy is that an understatement.
 // Per usual, we start by getting program configurations.
-func New(session *config.Session, winnersOnly, noLosers bool) error {
+// Entries are sized with the given USD balance. When given an output format, every simulation and chart is also
+// written to the results directory.
+func New(session *config.Session, winnersOnly, noLosers bool, balance float64, output string) error {
+	return simulate(context.Background(), session, winnersOnly, noLosers, balance, output)
+}
+
+// simulate runs New, serving the simulation site until the given context is done.
+func simulate(ctx context.Context, session *config.Session, winnersOnly, noLosers bool, balance float64, output string) error {
+
+	if output != "" {
+		if err := ValidateFormat(output); err != nil {
+			return err
+		}
+	}
 
 	log.Info().Msg(util.Tuna + " .")
 	log.Info().Msg(util.Tuna + " ..")
@@ -51,15 +63,16 @@ func New(session *config.Session, winnersOnly, noLosers bool) error {
 
 	start := time.Now()
 
+	rates := map[string][]cbp.Rate{}
 	for _, productID := range session.UsdSelectionProductIDs() {
-		initRates(session, productID)
+		rates[productID] = getRates(session, productID)
 	}
 	log.Info().Msg(util.Tuna + " ..")
 
 	for _, productID := range session.UsdSelectionProductIDs() {
 
-		var s simulation
-		newSimulation(session, productID, rates, &s)
+		s := simulation{fills: session.FillModel, balance: balance}
+		newSimulation(session, session.GetPattern(productID), rates[productID], &s)
 		if s.TotalEntries() == 0 ||
 			((noLosers || winnersOnly) && s.LostLen() > 0) ||
 			winnersOnly && s.TradingLen() > 0 {
@@ -72,46 +85,64 @@ func New(session *config.Session, winnersOnly, noLosers bool) error {
 		log.Info().Msg(util.Tuna + " ..")
 	}
 
+	if id, err := saveRun(session, winnersOnly, noLosers, simulations); err != nil {
+		log.Warn().Err(err).Msg(util.Tuna + " ... run not saved")
+	} else {
+		log.Info().Uint("run", id).Msg(util.Tuna + " ... run saved")
+	}
+
+	if output != "" {
+		paths, err := NewExport(session, simulations).Write("results", output)
+		if err != nil {
+			return err
+		}
+		logExport(paths)
+	}
+
 	go NewResult(session, simulations, start)
 
-	return newSite(simulations)
+	return newSite(ctx, simulations)
 }
 
-func initRates(session *config.Session, productID string) {
+// getRates returns the session period rates of the given product, oldest first, from the database when it has them,
+// and from coinbase otherwise.
+func getRates(session *config.Session, productID string) []cbp.Rate {
 
 	alpha := *session.Alpha
 	omega := *session.Omega
-	pg := db.NewDB(&cbp.Rate{})
+	store := db.GetStore()
 
-	pg.Where("product_id = ?", productID).
-		Where("unix BETWEEN ? AND ?", alpha.UnixNano(), omega.UnixNano()).
-		Order("unix asc").
-		Find(&rates)
+	rates, err := store.FindRates(productID, alpha, omega)
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s ... %s", util.Tuna, util.GetCurrency(productID))
+	}
 
 	if len(rates) == 0 ||
 		rates[0].Time().Sub(alpha).Minutes() > 3 ||
 		rates[len(rates)-1].Time().Sub(omega).Minutes() > 3 {
 		if out, err := cbp.GetRates(productID, session.RateParams()); err != nil {
 			log.Debug().Err(err).Msgf("%s ... %s", util.Tuna, util.GetCurrency(productID))
-			return
+			return rates
 		} else {
 			log.Info().
 				Int("coinbase", len(out)).
 				Msgf("%s ... %s ... %s", util.Tuna, util.GetCurrency(productID), util.Check)
-			for _, rate := range out {
-				rates = append(rates, rate)
-				pg.Create(&rate)
+			if err := store.SaveRates(out); err != nil {
+				log.Debug().Err(err).Msgf("%s ... %s", util.Tuna, util.GetCurrency(productID))
 			}
+			return out
 		}
-	} else {
-		log.Info().
-			Int("database", len(rates)).
-			Msgf("%s ... %s ... %s", util.Tuna, util.GetCurrency(productID), util.Check)
 	}
 
+	log.Info().
+		Int("database", len(rates)).
+		Msgf("%s ... %s ... %s", util.Tuna, util.GetCurrency(productID), util.Check)
+
+	return rates
 }
 
-func newSite(simulations []simulation) error {
+// newSite writes a page of charts for every simulation outcome, and serves them until the given context is done.
+func newSite(ctx context.Context, simulations []simulation) error {
 
 	if err := util.MakePath("html"); err != nil {
 		return err
@@ -130,8 +161,16 @@ func newSite(simulations []simulation) error {
 	}
 
 	fs := http.FileServer(http.Dir("html"))
+	server := &http.Server{Addr: fmt.Sprintf("localhost:%d", port()), Handler: logRequest(fs)}
 
-	log.Print(http.ListenAndServe(fmt.Sprintf("localhost:%d", port()), logRequest(fs)))
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Print(err)
+	}
 
 	return nil
 }
@@ -15,16 +15,45 @@
  * limitations under the License.
  * /
  */
-
 package sim
 
 import (
+	"context"
 	"github.com/nelsw/nuchal/test"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
-	if err := New(test.Session(), false, false); err != nil {
+	test.Dir(t)
+
+	// serve on any free port, for as long as the context allows
+	port, ok := os.LookupEnv("PORT")
+	_ = os.Setenv("PORT", "0")
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv("PORT", port)
+		} else {
+			_ = os.Unsetenv("PORT")
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := simulate(ctx, test.Session(t), false, false, 1000, ""); err != nil {
 		t.Error(err)
 	}
 }
+
+func TestNewUnknownOutput(t *testing.T) {
+	test.Dir(t)
+
+	// an unknown format fails before any rates are fetched or any simulation is run
+	if err := simulate(context.Background(), test.Session(t), false, false, 1000, "xml"); err == nil {
+		t.Error("expected an unknown format error")
+	}
+	if _, err := os.Stat("results"); !os.IsNotExist(err) {
+		t.Error("expected no results")
+	}
+}
@@ -21,8 +21,10 @@ package sim
 import (
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/indicator"
 	"github.com/nelsw/nuchal/pkg/util"
 	"github.com/rs/zerolog/log"
+	"time"
 )
 
 type simulation struct {
@@ -40,6 +42,15 @@ type simulation struct {
 	Even []Chart
 
 	productID string
+
+	// quiet simulations do not log each chart result.
+	quiet bool
+
+	// fills defines how simulated orders are filled.
+	fills *config.FillModel
+
+	// balance is the USD balance entries are sized with.
+	balance float64
 }
 
 func (s *simulation) symbol() string {
@@ -67,45 +78,69 @@ func (s *simulation) directory() string {
 	}
 }
 
-func newSimulation(session *config.Session, productID string, rates []cbp.Rate, simulation *simulation) {
+// period is the range of time in which a simulation enters trades.
+type period interface {
+	InPeriod(t time.Time) bool
+}
+
+func newSimulation(period period, pattern *cbp.Pattern, rates []cbp.Rate, simulation *simulation) {
+
+	simulation.productID = pattern.ID
+	msg := util.Tuna + util.Break + util.GetCurrency(pattern.ID) + util.Break
+
+	window := pattern.Window()
+
+	confirmation, err := indicator.NewConfirmation(pattern.Confirm)
+	if err != nil {
+		log.Error().Err(err).Msg(msg + util.Ex)
+		return
+	}
 
-	simulation.productID = productID
-	msg := util.Tuna + util.Break + util.GetCurrency(productID) + util.Break
+	atr := indicator.NewATR(14)
 
-	var then, that cbp.Rate
 	for i, this := range rates {
 
-		if !session.InPeriod(this.Time()) {
+		confirmation.Add(this)
+		atr.Add(this)
+
+		if !period.InPeriod(this.Time()) || i+1 < window {
 			continue
 		}
 
-		if session.GetPattern(productID).MatchesTweezerBottomPattern(then, that, this) {
+		if pattern.Matches(rates[i+1-window:i+1]) && confirmation.Confirms() {
+
+			var volatility float64
+			if atr.Ready() {
+				volatility = atr.Value()
+			}
 
-			chart := newChart(session, rates[i-2:], productID)
+			chart := newChart(pattern, simulation.fills, rates[i+1-window:], simulation.balance, volatility)
 			if chart == nil {
 				continue
 			}
 
+			var symbol string
 			if chart.isWinner() {
-				log.Info().Msg(msg + util.Won)
+				symbol = util.Won
 				simulation.Won = append(simulation.Won, *chart)
 			} else if chart.isLoser() {
-				log.Info().Msg(msg + util.Lost)
+				symbol = util.Lost
 				simulation.Lost = append(simulation.Lost, *chart)
 			} else if chart.isTrading() {
-				s := util.TradingUp
+				symbol = util.TradingUp
 				if chart.result() < 0 {
-					s = util.TradingDown
+					symbol = util.TradingDown
 				}
-				log.Info().Msg(msg + s)
 				simulation.Trading = append(simulation.Trading, *chart)
 			} else if chart.isEven() {
-				log.Info().Msg(msg + util.Evn)
+				symbol = util.Evn
 				simulation.Even = append(simulation.Even, *chart)
 			}
+
+			if !simulation.quiet && symbol != "" {
+				log.Info().Msg(msg + symbol)
+			}
 		}
-		then = that
-		that = this
 	}
 }
 
@@ -170,3 +205,35 @@ func (s *simulation) TotalAfterFees() float64 {
 func (s *simulation) Net() float64 {
 	return s.TotalAfterFees() / s.TotalEntries() * 100
 }
+
+// SizedAfterFees returns the USD result of every chart after fees, at the entry size of each chart.
+func (s *simulation) SizedAfterFees() float64 {
+	return sizedAfterFees(s.charts())
+}
+
+// sizedAfterFees returns the USD result of the given charts after fees, at the entry size of each chart.
+func sizedAfterFees(charts []Chart) float64 {
+	sum := 0.0
+	for _, c := range charts {
+		sum += c.result() * c.Size
+	}
+	return sum
+}
+
+// SizedEntries returns the USD amount of every entry, even ones that broke even, at the entry size of each chart.
+func (s *simulation) SizedEntries() float64 {
+	sum := 0.0
+	for _, c := range s.charts() {
+		sum += c.Entry * c.Size
+	}
+	return sum
+}
+
+// TotalSize returns the base currency size of every entry.
+func (s *simulation) TotalSize() float64 {
+	sum := 0.0
+	for _, c := range s.charts() {
+		sum += c.Size
+	}
+	return sum
+}
@@ -0,0 +1,180 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// walk is the aggregate out-of-sample result of every fold of a product.
+type walk struct {
+	folds             int
+	inNet, outNet     float64
+	entries           int
+	won, closed       int
+	drawdown          float64
+	inHours, outHours float64
+}
+
+// NewWalkForward splits the session period into rolling in-sample and out-of-sample folds. Pattern values are tuned
+// on each in-sample period and scored on the out-of-sample period that follows, reporting every fold and the
+// aggregate out-of-sample result of each product. Rates are loaded once per product for the entire period.
+func NewWalkForward(session *config.Session, search Search, in, out time.Duration) error {
+
+	log.Info().Msg(util.Tuna + " .")
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " ... walk forward")
+	log.Info().Msg(util.Tuna + " ..")
+
+	if err := search.validate(); err != nil {
+		return err
+	}
+
+	folds := session.WalkForward(in, out)
+	if len(folds) == 0 {
+		return fmt.Errorf("period [%s] is shorter than a fold, in [%s] + out [%s]", session.Duration, in, out)
+	}
+
+	start := time.Now()
+	random := rand.New(rand.NewSource(search.Seed))
+
+	for _, productID := range session.UsdSelectionProductIDs() {
+
+		rates := getRates(session, productID)
+		if len(rates) == 0 {
+			continue
+		}
+
+		msg := util.Tuna + util.Break + util.GetCurrency(productID) + util.Break
+
+		var w walk
+		for i, fold := range folds {
+
+			candidates, err := search.candidates(session.GetPattern(productID), random)
+			if err != nil {
+				return err
+			}
+
+			results := optimize(fold.In, session.FillModel, candidates, until(rates, *fold.In.Omega), search.Workers, search.Balance)
+			rank(results, search.Objective)
+			if len(results) == 0 || results[0].entries == 0 {
+				log.Info().Int("fold", i+1).Time(util.Alpha, *fold.In.Alpha).Msg(msg + util.Ex)
+				continue
+			}
+
+			tuned := results[0]
+			scored := optimize(fold.Out, session.FillModel, []cbp.Pattern{tuned.pattern}, until(rates, *fold.Out.Omega), 1, search.Balance)[0]
+
+			log.Info().
+				Int("fold", i+1).
+				Time(util.Alpha, *fold.Out.Alpha).
+				Time(util.Omega, *fold.Out.Omega).
+				Float64(util.Goal, tuned.pattern.Gain).
+				Float64("loss", tuned.pattern.Loss).
+				Float64(util.Delta, tuned.pattern.Delta).
+				Float64("size", tuned.pattern.Size).
+				Msg(msg + util.Flag)
+			log.Info().
+				Str("in", util.Usd(tuned.net)).
+				Str("out", util.Usd(scored.net)).
+				Str("%", util.Money(scored.winRate*100)).
+				Str("drawdown", util.Usd(scored.drawdown)).
+				Int("entries", scored.entries).
+				Msg(msg + symbol(scored.net))
+
+			w.add(tuned, scored, in, out)
+		}
+
+		if w.folds == 0 {
+			log.Info().Msg(msg + util.Ex)
+			log.Info().Msg(util.Tuna + " ..")
+			continue
+		}
+
+		log.Info().
+			Int("folds", w.folds).
+			Str("in", util.Usd(w.inNet)).
+			Str("out", util.Usd(w.outNet)).
+			Str("%", util.Money(w.winRate()*100)).
+			Str("drawdown", util.Usd(w.drawdown)).
+			Int("entries", w.entries).
+			Str("efficiency", util.Money(w.efficiency()*100)).
+			Msg(msg + util.Sigma)
+		log.Info().Msg(util.Tuna + " ..")
+	}
+
+	log.Info().Msgf("%s ... walk forward generated in %f seconds", util.Tuna, time.Now().Sub(start).Seconds())
+	log.Info().Msg(util.Tuna + " ..")
+	log.Info().Msg(util.Tuna + " .")
+
+	return nil
+}
+
+// until returns the rates, oldest first, up to and including the given time.
+func until(rates []cbp.Rate, t time.Time) []cbp.Rate {
+	i := sort.Search(len(rates), func(i int) bool {
+		return rates[i].Time().After(t)
+	})
+	return rates[:i]
+}
+
+func symbol(net float64) string {
+	if net > 0 {
+		return util.Won
+	} else if net < 0 {
+		return util.Lost
+	}
+	return util.Evn
+}
+
+func (w *walk) add(tuned, scored optimization, in, out time.Duration) {
+	w.folds++
+	w.inNet += tuned.net
+	w.outNet += scored.net
+	w.entries += scored.entries
+	w.won += scored.won
+	w.closed += scored.closed
+	w.drawdown = math.Max(w.drawdown, scored.drawdown)
+	w.inHours += in.Hours()
+	w.outHours += out.Hours()
+}
+
+func (w *walk) winRate() float64 {
+	if w.closed == 0 {
+		return 0
+	}
+	return float64(w.won) / float64(w.closed)
+}
+
+// efficiency is the out-of-sample net per hour as a ratio of the in-sample net per hour, where values near one
+// suggest the tuned values generalize, and values near zero or below suggest they were overfit.
+func (w *walk) efficiency() float64 {
+	if w.inNet <= 0 || w.inHours == 0 || w.outHours == 0 {
+		return 0
+	}
+	return (w.outNet / w.outHours) / (w.inNet / w.inHours)
+}
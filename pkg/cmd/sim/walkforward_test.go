@@ -0,0 +1,57 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package sim
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestUntil(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i := 0; i < 10; i++ {
+		rates = append(rates, *cbp.NewRate("BTC-USD", cb.HistoricRate{Time: alpha.Add(time.Minute * time.Duration(i))}))
+	}
+
+	if n := len(until(rates, alpha.Add(time.Minute*4))); n != 5 {
+		t.Errorf("until = %d, want 5", n)
+	}
+	if n := len(until(rates, alpha.Add(-time.Minute))); n != 0 {
+		t.Errorf("until = %d, want 0", n)
+	}
+}
+
+func TestWalkEfficiency(t *testing.T) {
+
+	var w walk
+	w.add(optimization{net: 4}, optimization{net: 1, won: 1, closed: 2}, time.Hour*4, time.Hour)
+	w.add(optimization{net: 4}, optimization{net: -.5, closed: 1}, time.Hour*4, time.Hour)
+
+	if w.efficiency() != .25 {
+		t.Errorf("efficiency = %f, want .25", w.efficiency())
+	}
+	if w.winRate() != 1.0/3 {
+		t.Errorf("win rate = %f, want 1/3", w.winRate())
+	}
+}
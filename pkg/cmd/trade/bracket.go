@@ -0,0 +1,203 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	BracketOpen      = "open"
+	BracketProfit    = "profit"
+	BracketStopped   = "stopped"
+	BracketCancelled = "cancelled"
+)
+
+// bracketPoll is the least time between take-profit order lookups, while the price is at or above the goal.
+var bracketPoll = time.Second * 15
+
+// Bracket is a one-cancels-other pair of sell orders protecting a held trade. Coinbase holds the balance of a single
+// sell order, so the take-profit limit order rests on the exchange, while the stop loss is watched on the price feed,
+// cancelling the take-profit and selling at market when the loss price is reached. Brackets are persisted, so that
+// they are resumed after a restart.
+type Bracket struct {
+	gorm.Model
+
+	// ProductID and TradeID identify the entry fill the bracket protects.
+	ProductID string `gorm:"index"`
+	TradeID   int    `gorm:"uniqueIndex"`
+
+	// Size is the base currency size of the trade.
+	Size string
+
+	// Entry is the trade price, and Goal and Loss are the take-profit and stop loss prices derived from it.
+	Entry, Goal, Loss float64
+
+	// OrderID is the id of the take-profit order.
+	OrderID string `gorm:"index"`
+
+	// Status is open until one side fills, then profit or stopped, or cancelled when the take-profit is dropped.
+	Status string `gorm:"index"`
+
+	// Exit is the price the trade was sold at.
+	Exit float64
+}
+
+// newBracket places the take-profit order of the given trade, and persists the bracket. The order is cancelled when
+// the bracket cannot be persisted, as nothing would watch its stop loss.
+func newBracket(pg *gorm.DB, pattern *cbp.Pattern, trade cbp.Trade) (*Bracket, error) {
+
+	b := new(Bracket)
+	b.ProductID = pattern.ID
+	b.TradeID = trade.TradeID
+	b.Size = trade.Fill.Size
+	b.Entry = trade.Price()
+	b.Goal = pattern.GoalPrice(b.Entry)
+	b.Loss = pattern.LossPrice(b.Entry)
+	b.Status = BracketOpen
+
+	order, err := cbp.CreateOrder(pattern.NewLimitSellEntryOrder(b.Goal, b.Size))
+	if err != nil {
+		return nil, err
+	}
+	b.OrderID = order.ID
+
+	if err := pg.Create(b).Error; err != nil {
+		if err := cbp.CancelOrder(b.OrderID); err != nil {
+			log.Error().Err(err).Str("order", b.OrderID).Msgf("%s ... %5s ... hold", util.Shark, util.GetCurrency(b.ProductID))
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// watch follows the price feed until a side of the bracket fills, or its take-profit order is cancelled elsewhere.
+// The take-profit order is looked up at most once every bracketPoll while the price is at or above the goal.
+func (b *Bracket) watch(pg *gorm.DB, pattern *cbp.Pattern) error {
+
+	if status, err := b.status(); err != nil {
+		return err
+	} else if status != BracketOpen {
+		return b.close(pg, status, b.Goal)
+	}
+	polled := time.Now()
+
+	stream, err := cbp.NewPriceStream(b.ProductID)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			log.Error().Err(err).Str("action", "close").Msgf("%s ... %5s ...", util.Shark, util.GetCurrency(b.ProductID))
+		}
+	}()
+
+	for {
+
+		price, err := stream.Price()
+		if err != nil {
+			return err
+		}
+
+		switch b.side(*price) {
+		case BracketProfit:
+			if time.Since(polled) < bracketPoll {
+				continue
+			}
+			polled = time.Now()
+			if status, err := b.status(); err != nil {
+				return err
+			} else if status != BracketOpen {
+				return b.close(pg, status, b.Goal)
+			}
+		case BracketStopped:
+			return b.stop(pg, pattern)
+		}
+	}
+}
+
+// side returns the side of the bracket the given price reaches, or open if it reaches neither.
+func (b *Bracket) side(price float64) string {
+	if price >= b.Goal {
+		return BracketProfit
+	} else if price <= b.Loss {
+		return BracketStopped
+	}
+	return BracketOpen
+}
+
+// status returns the bracket status from its take-profit order.
+func (b *Bracket) status() (string, error) {
+	order, err := cbp.GetOrder(b.OrderID)
+	if err != nil {
+		return "", err
+	}
+	return orderStatus(*order), nil
+}
+
+func orderStatus(order cb.Order) string {
+	if order.Status != "done" {
+		return BracketOpen
+	} else if order.DoneReason == "filled" {
+		return BracketProfit
+	}
+	return BracketCancelled
+}
+
+// stop cancels the take-profit order and sells the trade at market.
+func (b *Bracket) stop(pg *gorm.DB, pattern *cbp.Pattern) error {
+
+	if err := cbp.CancelOrder(b.OrderID); err != nil {
+		// the take-profit may have filled while the price fell through it
+		if status, _ := b.status(); status == BracketProfit {
+			return b.close(pg, BracketProfit, b.Goal)
+		}
+		return err
+	}
+
+	order, err := cbp.CreateOrder(pattern.NewMarketSellOrder(b.Size))
+	if err != nil {
+		return err
+	}
+
+	return b.close(pg, BracketStopped, util.Float64(order.ExecutedValue)/util.Float64(order.FilledSize))
+}
+
+func (b *Bracket) close(pg *gorm.DB, status string, exit float64) error {
+
+	b.Status = status
+	if status != BracketCancelled {
+		b.Exit = exit
+	}
+
+	log.Info().
+		Int("trade", b.TradeID).
+		Float64(util.Entry, b.Entry).
+		Float64("exit", b.Exit).
+		Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(b.ProductID), status)
+
+	return pg.Save(b).Error
+}
@@ -0,0 +1,49 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+)
+
+func TestBracket(t *testing.T) {
+
+	b := Bracket{Entry: 100, Goal: 110, Loss: 90}
+
+	for price, want := range map[float64]string{111: BracketProfit, 110: BracketProfit, 100: BracketOpen, 90: BracketStopped, 80: BracketStopped} {
+		if got := b.side(price); got != want {
+			t.Errorf("side of %f = %s, want %s", price, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		order cb.Order
+		want  string
+	}{
+		{cb.Order{Status: "open"}, BracketOpen},
+		{cb.Order{Status: "pending"}, BracketOpen},
+		{cb.Order{Status: "done", DoneReason: "filled"}, BracketProfit},
+		{cb.Order{Status: "done", DoneReason: "canceled"}, BracketCancelled},
+	} {
+		if got := orderStatus(tt.order); got != tt.want {
+			t.Errorf("status of %s %s = %s, want %s", tt.order.Status, tt.order.DoneReason, got, tt.want)
+		}
+	}
+}
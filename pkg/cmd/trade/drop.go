@@ -21,11 +21,12 @@ package trade
 import (
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/db"
 	"github.com/nelsw/nuchal/pkg/util"
 	"github.com/rs/zerolog/log"
 )
 
-// NewDrops cancels active orders.
+// NewDrops cancels active orders, and the brackets of cancelled take-profit orders.
 func NewDrops(session *config.Session) error {
 
 	log.Info().Msg(util.Shark + " .")
@@ -33,6 +34,11 @@ func NewDrops(session *config.Session) error {
 	log.Info().Msg(util.Shark + " ... trade --drop")
 	log.Info().Msg(util.Shark + " ..")
 
+	pg, err := db.NewDB(&Bracket{})
+	if err != nil {
+		return err
+	}
+
 	for _, productID := range session.UsdSelectionProductIDs() {
 
 		log.Info().Msg(util.Shark + " ... " + productID)
@@ -46,6 +52,11 @@ func NewDrops(session *config.Session) error {
 			if err := cbp.CancelOrder(order.ID); err != nil {
 				return err
 			}
+			if err := pg.Model(&Bracket{}).
+				Where("order_id = ? AND status = ?", order.ID, BracketOpen).
+				Update("status", BracketCancelled).Error; err != nil {
+				return err
+			}
 			log.Info().Msg(util.Shark + " ... dropped")
 		}
 		log.Info().Msg(util.Shark + " ..")
@@ -24,7 +24,8 @@ import (
 )
 
 func TestNewCancels(t *testing.T) {
-	if err := NewDrops(test.Session()); err != nil {
+	test.Dir(t)
+	if err := NewDrops(test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
@@ -24,7 +24,8 @@ import (
 )
 
 func TestNewEject(t *testing.T) {
-	if err := NewEject(test.Session()); err != nil {
+	test.Dir(t)
+	if err := NewEject(test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
@@ -0,0 +1,128 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"errors"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// errUnfilled is returned when a limit entry is cancelled without filling and the pattern has no fallback.
+var errUnfilled = errors.New("limit entry unfilled")
+
+// enter places the given sized market buy order, or when the pattern enters with limits, a post-only limit buy that
+// follows the best bid until it fills or the pattern reprice time is up. Every limit order gets a new client order id,
+// saved to the journal before it's placed, so an interrupted entry is recovered from its latest order.
+func enter(pattern *cbp.Pattern, order *cb.Order, j *journal.Journal) (*cb.Order, error) {
+
+	limit, err := pattern.IsLimitEntry()
+	if err != nil {
+		return nil, err
+	} else if !limit {
+		return cbp.CreateOrder(order)
+	}
+
+	deadline := time.Now().Add(pattern.RepriceFor())
+
+	for attempt := 0; time.Now().Before(deadline); attempt++ {
+
+		if attempt > 0 {
+			renew(j)
+		}
+
+		bid, err := cbp.GetBestBid(pattern.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		post := pattern.NewPostOnlyBuyOrder(bid, order)
+		post.ClientOID = j.ClientOID
+
+		placed, err := cbp.CreateOrder(post)
+		if err == cbp.ErrRejected { // the bid moved through the price before it rested
+			time.Sleep(time.Second)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if filled, err := follow(pattern, placed, deadline); err != nil || filled != nil {
+			return filled, err
+		}
+	}
+
+	if !pattern.Fallback {
+		return nil, errUnfilled
+	}
+
+	log.Warn().Msgf("%s ... %5s ... limit entry unfilled, buying at market", util.Shark, util.GetCurrency(pattern.ID))
+
+	renew(j)
+	order.ClientOID = j.ClientOID
+	return cbp.CreateOrder(order)
+}
+
+// follow watches the given resting limit entry, and returns it once it fills. The order is cancelled when the best
+// bid moves away from it or the deadline passes, returning nil unless it filled in part before it was cancelled. It is
+// followed until the exchange confirms it is done, so that a replacement never rests beside it.
+func follow(pattern *cbp.Pattern, placed *cb.Order, deadline time.Time) (*cb.Order, error) {
+
+	for {
+
+		time.Sleep(time.Second)
+
+		order, err := cbp.FindOrder(placed.ID)
+		if util.IsNotFound(err) {
+			return nil, nil // cancelled without filling
+		} else if err != nil {
+			log.Debug().Err(err).Msgf("%s ... %5s ... follow", util.Shark, util.GetCurrency(pattern.ID))
+			continue // the order may still rest
+		}
+
+		if order.Status == "done" {
+			if util.Float64(order.FilledSize) > 0 {
+				return order, nil
+			}
+			return nil, nil // cancelled
+		}
+
+		bid, err := cbp.GetBestBid(pattern.ID)
+		if err == nil && time.Now().Before(deadline) &&
+			util.Float64(pattern.PrecisePrice(pattern.LimitPrice(bid))) == util.Float64(order.Price) {
+			continue
+		}
+
+		// a single attempt, as an order that filled meanwhile is already done, and checked again on the next pass
+		if err := cbp.GetExchange().CancelOrder(order.ID); err != nil {
+			log.Debug().Err(err).Msgf("%s ... %5s ... cancel", util.Shark, util.GetCurrency(pattern.ID))
+		}
+	}
+}
+
+// renew gives the journal a new client order id for its next entry order.
+func renew(j *journal.Journal) {
+	if err := j.Renew(); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... journal", util.Shark, util.GetCurrency(j.ProductID))
+	}
+}
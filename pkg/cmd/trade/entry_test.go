@@ -0,0 +1,139 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"errors"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func TestEnter(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	var rates []cbp.Rate
+	for i, price := range []float64{1, .98} {
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    price,
+			High:   price,
+			Open:   price,
+			Close:  price,
+			Volume: 1,
+		}))
+	}
+
+	server := fake.NewServer(100, 0, rates)
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10, Entry: cbp.LimitEntry, Offset: .01, Reprice: 10}
+
+	go func() {
+		time.Sleep(time.Millisecond * 1500)
+		for i := 0; i < 4; i++ {
+			server.Advance()
+		}
+	}()
+
+	j := journal.New(nil, "ALGO-USD", 10, 0)
+	order, err := enter(pattern, pattern.NewMarketBuyOrder(), j)
+	if err != nil {
+		t.Fatal(err)
+	} else if order.Price != "0.9900" || order.FilledSize != "10.000000" || !order.PostOnly {
+		t.Errorf("expected a post-only entry filled at .99, got %+v", order)
+	} else if order.ClientOID != j.ClientOID {
+		t.Errorf("expected the entry to carry the journal client oid")
+	}
+
+	pattern.Reprice = 1
+	if _, err := enter(pattern, pattern.NewMarketBuyOrder(), j); err != errUnfilled {
+		t.Errorf("expected an unfilled limit entry, got %v", err)
+	}
+
+	pattern.Fallback = true
+	clientOID := j.ClientOID
+	if order, err := enter(pattern, pattern.NewMarketBuyOrder(), j); err != nil {
+		t.Fatal(err)
+	} else if order.Type != "market" || order.ExecutedValue != "9.800000" {
+		t.Errorf("expected a market entry at .98, got %+v", order)
+	} else if order.ClientOID == clientOID || order.ClientOID != j.ClientOID {
+		t.Errorf("expected the market entry to get a new client oid")
+	}
+}
+
+// cancelExchange is an exchange whose first cancel fails, eg. during an exchange outage.
+type cancelExchange struct {
+	cbp.Exchange
+	cancels int
+}
+
+func (e *cancelExchange) CancelOrder(id string) error {
+	if e.cancels++; e.cancels == 1 {
+		return errors.New("service unavailable")
+	}
+	return e.Exchange.CancelOrder(id)
+}
+
+func TestFollow(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	server := fake.NewServer(100, 0, []cbp.Rate{*cbp.NewRate("ALGO-USD", cb.HistoricRate{
+		Time:   alpha,
+		Low:    1,
+		High:   1,
+		Open:   1,
+		Close:  1,
+		Volume: 1,
+	})})
+	defer server.Close()
+
+	exchange := &cancelExchange{Exchange: cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0")}
+	cbp.SetExchange(exchange)
+	defer cbp.SetExchange(nil)
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10, Entry: cbp.LimitEntry}
+	placed, err := cbp.CreateOrder(pattern.NewPostOnlyBuyOrder(.5, pattern.NewMarketBuyOrder()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deadline has passed, and the entry is followed until a cancel succeeds
+	if order, err := follow(pattern, placed, time.Now()); err != nil || order != nil {
+		t.Errorf("expected the entry to be cancelled, got %+v, %v", order, err)
+	} else if exchange.cancels != 2 {
+		t.Errorf("expected a second cancel, got %d", exchange.cancels)
+	} else if orders, err := cbp.GetOrders("ALGO-USD"); err != nil || len(*orders) != 0 {
+		t.Errorf("expected no resting order, got %v, %v", orders, err)
+	}
+}
@@ -24,7 +24,8 @@ import (
 )
 
 func TestNewExits(t *testing.T) {
-	if err := NewExits(test.Session()); err != nil {
+	test.Dir(t)
+	if err := NewExits(test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
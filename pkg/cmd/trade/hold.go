@@ -21,12 +21,15 @@ package trade
 import (
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/db"
 	"github.com/nelsw/nuchal/pkg/util"
-	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"github.com/rs/zerolog/log"
 )
 
-// NewHolds will create a limit sell entry order for every trade that does not already meet or exceed the goal price.
+// NewHolds brackets every trading position with a take-profit order at the goal price and a stop loss at the loss
+// price, or sells it at market when it already meets the goal price. Then it watches every open bracket, including
+// those left open by a previous run, until one of its sides fills. A position that cannot be sold or held is logged, and
+// the remaining positions are held regardless.
 func NewHolds(session *config.Session) error {
 
 	log.Info().Msg(util.Shark + " .")
@@ -35,47 +38,77 @@ func NewHolds(session *config.Session) error {
 	log.Info().Msg(util.Shark + " ..")
 	log.Info().Msg(util.Shark + " .")
 
-	positions, err := cbp.GetTradingPositions()
+	pg, err := db.NewDB(&Bracket{})
 	if err != nil {
 		return err
 	}
 
-	if len(positions) < 1 {
-		log.Info().Msg(util.Shark + " ..")
-		log.Info().Msg(util.Shark + " ...")
-		log.Info().Msg(util.Shark + " ... no available balance found to hold")
-		log.Info().Msg(util.Shark + " ...")
-		log.Info().Msg(util.Shark + " ..")
-		log.Info().Msg(util.Shark + " .")
-		return nil
+	positions, err := cbp.GetTradingPositions()
+	if err != nil {
+		return err
 	}
 
 	for productID, position := range positions {
 
+		pattern := session.GetPattern(productID)
+
 		log.Info().Msg(util.Shark + " ... " + productID)
 		for _, trade := range position.GetActiveTrades() {
 
 			tickerPrice, err := cbp.GetTickerPrice(productID)
 			if err != nil {
-				return err
+				log.Error().Err(err).Int("trade", trade.TradeID).Msg(util.Shark + " ... " + util.Ex)
+				continue
 			}
 
-			var order *cb.Order
-			goalPrice := session.GetPattern(productID).GoalPrice(trade.Price())
-			if *tickerPrice >= goalPrice {
-				order = session.GetPattern(productID).NewMarketSellOrder(trade.Fill.Size)
-			} else {
-				order = session.GetPattern(productID).NewLimitSellEntryOrder(goalPrice, trade.Fill.Size)
+			if *tickerPrice >= pattern.GoalPrice(trade.Price()) {
+				if _, err := cbp.CreateOrder(pattern.NewMarketSellOrder(trade.Fill.Size)); err != nil {
+					log.Error().Err(err).Int("trade", trade.TradeID).Msg(util.Shark + " ... " + util.Ex)
+					continue
+				}
+				log.Info().Msg(util.Shark + " ... sold")
+				continue
 			}
 
-			if _, err := cbp.CreateOrder(order); err != nil {
-				return err
+			if _, err := newBracket(pg, pattern, trade); err != nil {
+				log.Error().Err(err).Int("trade", trade.TradeID).Msg(util.Shark + " ... " + util.Ex)
+				continue
 			}
 
 			log.Info().Msg(util.Shark + " ... held")
 		}
 		log.Info().Msg(util.Shark + " ..")
 	}
+
+	var brackets []Bracket
+	if err := pg.Where("status = ?", BracketOpen).Find(&brackets).Error; err != nil {
+		return err
+	}
+
+	if len(brackets) < 1 {
+		log.Info().Msg(util.Shark + " ..")
+		log.Info().Msg(util.Shark + " ...")
+		log.Info().Msg(util.Shark + " ... no available balance found to hold")
+		log.Info().Msg(util.Shark + " ...")
+		log.Info().Msg(util.Shark + " ..")
+		log.Info().Msg(util.Shark + " .")
+		return nil
+	}
+
+	log.Info().Int("brackets", len(brackets)).Msg(util.Shark + " ...")
+
+	done := make(chan error)
+	for i := range brackets {
+		go func(b *Bracket) {
+			done <- b.watch(pg, session.GetPattern(b.ProductID))
+		}(&brackets[i])
+	}
+
+	for range brackets {
+		if err := <-done; err != nil {
+			log.Error().Err(err).Msg(util.Shark + " ...")
+		}
+	}
 	log.Info().Msg(util.Shark + " .")
 
 	return nil
@@ -24,7 +24,8 @@ import (
 )
 
 func TestNewHolds(t *testing.T) {
-	if err := NewHolds(test.Session()); err != nil {
+	test.Dir(t)
+	if err := NewHolds(test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
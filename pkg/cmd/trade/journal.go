@@ -0,0 +1,109 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"time"
+)
+
+// recoverBackoff is the first wait between attempts to recover a journal, doubled after every failure up to
+// recoverMaxBackoff.
+var (
+	recoverBackoff    = time.Second * 5
+	recoverMaxBackoff = time.Minute
+)
+
+// restore rebuilds the risk limits of the day from the trades which exited today, eg. after a restart during a deploy.
+// Paper accounts are not persisted, so paper trades are not restored.
+func restore(session *config.Session, pg *gorm.DB, risk *risk) {
+
+	if cbp.IsPaper() {
+		return
+	}
+
+	now := time.Now()
+	journals, err := journal.FindExited(pg, false, now.UTC().Truncate(time.Hour*24))
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %s", util.Shark, util.Ex)
+		return
+	}
+
+	if risk.restore(journals, now) {
+		kill(session, risk)
+	}
+}
+
+// resume reattaches to every open trade in the journal, eg. after a restart during a deploy. Paper accounts are not
+// persisted, so paper trades are not resumed. Every open trade keeps its risk reservation while it is recovered.
+func resume(session *config.Session, pg *gorm.DB, risk *risk) {
+
+	if cbp.IsPaper() {
+		return
+	}
+
+	journals, err := journal.Find(pg, false)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %s", util.Shark, util.Ex)
+		return
+	}
+
+	for _, j := range journals {
+		risk.resume(j.ProductID, j.Usd)
+		go reattach(session, risk, j)
+	}
+}
+
+// reattach recovers the journal, retrying with backoff until the exchange answers, then sells the position if it is
+// still open. A trade which exited while the session was down is recorded with the risk limits.
+func reattach(session *config.Session, risk *risk, j *journal.Journal) {
+
+	wait := recoverBackoff
+	for {
+		err := j.Recover()
+		if err == nil {
+			break
+		}
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(j.ProductID), util.Ex)
+		time.Sleep(wait)
+		if wait *= 2; wait > recoverMaxBackoff {
+			wait = recoverMaxBackoff
+		}
+	}
+
+	switch {
+	case j.State == journal.Exited:
+		if risk.close(j.ProductID, j.Usd, j.Result(), time.Now()) {
+			kill(session, risk)
+		}
+		return
+	case !j.State.Open():
+		risk.cancel(j.ProductID, j.Usd)
+		return
+	}
+
+	log.Info().Str("state", string(j.State)).Msgf("%s ... %5s ... resumed", util.Shark, util.GetCurrency(j.ProductID))
+
+	sell(session, risk, j)
+}
@@ -0,0 +1,47 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/db"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
+)
+
+// Paper switches the exchange to a simulated account funded with the given USD balance, so that every trade mode that
+// follows places its orders on the account. Prices and patterns are live, but every order is filled by a cbp.Paper
+// account, and every fill is persisted.
+func Paper(usd float64) (*cbp.Paper, error) {
+
+	pg, err := db.NewDB(&cbp.PaperFill{})
+	if err != nil {
+		return nil, err
+	}
+
+	paper := cbp.NewPaper(usd, cbp.Maker(), cbp.Taker(), pg)
+	cbp.SetExchange(cbp.NewPaperExchange(cbp.GetExchange(), paper))
+
+	log.Info().Msg(util.Shark + " .")
+	log.Info().Msg(util.Shark + " ..")
+	log.Info().Msg(util.Shark + " ... trade --paper")
+	log.Info().Str(util.Dollar, util.Usd(usd)).Str("run", paper.Run).Msg(util.Shark + " ...")
+
+	return paper, nil
+}
@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+package trade
+
+import (
+	"context"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/test"
+	"testing"
+	"time"
+)
+
+func TestPaper(t *testing.T) {
+	test.Dir(t)
+	session := test.Session(t)
+
+	live := cbp.GetExchange()
+	defer cbp.SetExchange(live)
+
+	paper, err := Paper(1000)
+	if err != nil {
+		t.Fatal(err)
+	} else if !cbp.IsPaper() {
+		t.Fatal("expected the paper exchange")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := run(ctx, session); err != nil {
+		t.Error(err)
+	}
+
+	if accounts := paper.GetAccounts(); len(accounts) < 1 {
+		t.Error("expected the paper account to hold a balance")
+	}
+}
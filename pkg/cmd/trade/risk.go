@@ -0,0 +1,174 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"sort"
+	"sync"
+	"time"
+)
+
+// risk is the state of every position opened by a trade session, checked against the session risk limits before
+// every entry. A risk is safe for concurrent use.
+type risk struct {
+	*config.Risk
+	mu        sync.Mutex
+	positions int
+	products  map[string]float64
+	exposure  float64
+	day       time.Time
+	loss      float64
+	losses    int
+	cooldown  time.Time
+	killed    bool
+}
+
+func newRisk(limits *config.Risk) *risk {
+	if limits == nil {
+		limits = new(config.Risk)
+	}
+	return &risk{Risk: limits, products: map[string]float64{}}
+}
+
+// open reserves the given USD amount for a new position in the given product, or returns the limit it would break.
+func (r *risk) open(productID string, usd float64, now time.Time) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rollover(now)
+
+	if r.killed {
+		return fmt.Errorf("daily loss limit of %.2f reached", r.MaxDailyLoss)
+	}
+	if now.Before(r.cooldown) {
+		return fmt.Errorf("cooling down until %s after %d consecutive losses", r.cooldown.Format(time.Kitchen), r.MaxLosses)
+	}
+	if r.MaxPositions > 0 && r.positions >= r.MaxPositions {
+		return fmt.Errorf("max positions of %d reached", r.MaxPositions)
+	}
+	if r.MaxProductUsd > 0 && r.products[productID]+usd > r.MaxProductUsd {
+		return fmt.Errorf("max product usd of %.2f exceeded", r.MaxProductUsd)
+	}
+	if r.MaxExposure > 0 && r.exposure+usd > r.MaxExposure {
+		return fmt.Errorf("max exposure of %.2f exceeded", r.MaxExposure)
+	}
+
+	r.positions++
+	r.products[productID] += usd
+	r.exposure += usd
+	return nil
+}
+
+// resume reserves the given USD amount for a position opened before a restart, regardless of the limits.
+func (r *risk) resume(productID string, usd float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.positions++
+	r.products[productID] += usd
+	r.exposure += usd
+}
+
+// cancel releases a reservation that never became a position, eg. when the entry order failed.
+func (r *risk) cancel(productID string, usd float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(productID, usd)
+}
+
+// close releases the position opened with the given USD amount, and records the realized result of its exit.
+// It returns true if the result hits the daily loss limit, stopping every new entry.
+func (r *risk) close(productID string, usd, result float64, now time.Time) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.release(productID, usd)
+	r.rollover(now)
+
+	return r.record(result, now)
+}
+
+// restore rebuilds the realized daily loss, the consecutive losses and the kill switch from the given exited trades,
+// eg. after a restart, so that a restart does not reset the limits of the day. Trades are recorded in the order they
+// exited, and those which exited before the current UTC day are skipped. It returns true if the daily loss limit is hit.
+func (r *risk) restore(journals []journal.Journal, now time.Time) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rollover(now)
+
+	sort.SliceStable(journals, func(i, j int) bool {
+		return journals[i].UpdatedAt.Before(journals[j].UpdatedAt)
+	})
+
+	var killed bool
+	for _, j := range journals {
+		if j.State != journal.Exited || !j.UpdatedAt.UTC().Truncate(time.Hour*24).Equal(r.day) {
+			continue
+		}
+		killed = r.record(j.Result(), j.UpdatedAt) || killed
+	}
+	return killed
+}
+
+// record records the realized result of an exit at the given time, and returns true if it hits the daily loss limit.
+func (r *risk) record(result float64, now time.Time) bool {
+
+	if result >= 0 {
+		r.losses = 0
+		return false
+	}
+
+	r.loss -= result
+	r.losses++
+
+	if r.MaxLosses > 0 && r.losses >= r.MaxLosses {
+		r.cooldown = now.Add(r.Cooldown)
+		r.losses = 0
+	}
+
+	if r.MaxDailyLoss > 0 && r.loss >= r.MaxDailyLoss && !r.killed {
+		r.killed = true
+		return true
+	}
+
+	return false
+}
+
+func (r *risk) release(productID string, usd float64) {
+	r.positions--
+	r.products[productID] -= usd
+	r.exposure -= usd
+}
+
+// rollover resets the realized daily loss, the consecutive losses and the kill switch at the start of every UTC day,
+// the same limits restore rebuilds from the exits of the day, so they hold whether or not the session restarted.
+func (r *risk) rollover(now time.Time) {
+	if day := now.UTC().Truncate(time.Hour * 24); !day.Equal(r.day) {
+		r.day = day
+		r.loss = 0
+		r.losses = 0
+		r.killed = false
+	}
+}
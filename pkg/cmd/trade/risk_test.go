@@ -0,0 +1,133 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package trade
+
+import (
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/journal"
+	"testing"
+	"time"
+)
+
+func TestRisk(t *testing.T) {
+
+	now := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	r := newRisk(&config.Risk{
+		MaxPositions:  2,
+		MaxProductUsd: 15,
+		MaxExposure:   25,
+		MaxDailyLoss:  10,
+		MaxLosses:     2,
+		Cooldown:      time.Hour,
+	})
+
+	if err := r.open("ALGO-USD", 10, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.open("ALGO-USD", 10, now); err == nil {
+		t.Error("expected the max product usd to be exceeded")
+	}
+	if err := r.open("XLM-USD", 20, now); err == nil {
+		t.Error("expected the max exposure to be exceeded")
+	}
+	if err := r.open("XLM-USD", 10, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.open("TRB-USD", 1, now); err == nil {
+		t.Error("expected the max positions to be reached")
+	}
+
+	r.cancel("XLM-USD", 10)
+	if r.close("ALGO-USD", 10, -3, now) {
+		t.Error("expected the daily loss limit not to be reached")
+	}
+
+	// a second consecutive loss starts a cooldown
+	if err := r.open("ALGO-USD", 10, now); err != nil {
+		t.Fatal(err)
+	}
+	r.close("ALGO-USD", 10, -3, now)
+	if err := r.open("ALGO-USD", 10, now.Add(time.Minute)); err == nil {
+		t.Error("expected a cooldown after consecutive losses")
+	}
+
+	// losses are reset every day
+	later := now.Add(time.Hour * 24)
+	for i := 0; i < 3; i++ {
+		if err := r.open("ALGO-USD", 10, later); err != nil {
+			t.Fatal(err)
+		}
+		if r.close("ALGO-USD", 10, -4, later) != (i == 2) {
+			t.Errorf("expected the daily loss limit to be hit by the third loss, not loss %d", i+1)
+		}
+		later = later.Add(time.Hour * 2)
+	}
+
+	if err := r.open("ALGO-USD", 1, later); err == nil {
+		t.Error("expected the kill switch to stop every new entry")
+	}
+
+	// the kill switch is reset once the process crosses midnight UTC
+	midnight := later.UTC().Truncate(time.Hour * 24).Add(time.Hour * 24)
+	if err := r.open("ALGO-USD", 1, midnight.Add(-time.Second)); err == nil {
+		t.Error("expected the kill switch to stop every new entry until midnight")
+	}
+	if err := r.open("ALGO-USD", 1, midnight); err != nil {
+		t.Errorf("expected the kill switch to be reset at midnight, got %v", err)
+	} else if r.loss != 0 || r.losses != 0 {
+		t.Errorf("expected the daily loss and losses to be reset, got %f and %d", r.loss, r.losses)
+	}
+}
+
+func TestRiskRestore(t *testing.T) {
+
+	now := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	exited := func(result float64, at time.Time) journal.Journal {
+		j := journal.Journal{State: journal.Exited, Exit: 1, Size: "10", Cost: 10 - result}
+		j.UpdatedAt = at
+		return j
+	}
+
+	first, second := exited(-3, now.Add(-time.Minute*3)), exited(-3, now.Add(-time.Minute*2))
+
+	r := newRisk(&config.Risk{MaxDailyLoss: 10, MaxLosses: 2, Cooldown: time.Hour})
+	if r.restore([]journal.Journal{
+		exited(-8, now.Add(-time.Hour*24)), // yesterday
+		second,
+		first,
+		{State: journal.Climbing},
+	}, now) {
+		t.Error("expected the daily loss limit not to be reached")
+	}
+	if want := -first.Result() - second.Result(); r.loss != want {
+		t.Errorf("expected a daily loss of %f, got %f", want, r.loss)
+	}
+	if err := r.open("ALGO-USD", 10, now); err == nil {
+		t.Error("expected a cooldown after consecutive losses")
+	}
+
+	r = newRisk(&config.Risk{MaxDailyLoss: 10})
+	if !r.restore([]journal.Journal{exited(-6, now.Add(-time.Hour)), exited(-5, now.Add(-time.Minute))}, now) {
+		t.Error("expected the daily loss limit to be reached")
+	}
+	if err := r.open("ALGO-USD", 10, now); err == nil {
+		t.Error("expected the kill switch to be restored")
+	}
+}
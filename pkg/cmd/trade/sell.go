@@ -20,17 +20,22 @@ package trade
 
 import (
 	"fmt"
-	ws "github.com/gorilla/websocket"
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/indicator"
+	"github.com/nelsw/nuchal/pkg/journal"
 	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 	"sort"
+	"strconv"
 	"time"
 )
 
-// NewSells attempts to sell the available balance at or beyond goal prices.
+// NewSells attempts to sell the available balance at or beyond goal prices. Journaled trades are recovered and sold
+// with their journal, and active trades without one, eg. bought outside of a trade session, are journaled first.
 func NewSells(session *config.Session) error {
 
 	positions, err := cbp.GetTradingPositions()
@@ -44,23 +49,21 @@ func NewSells(session *config.Session) error {
 	}
 	sort.Strings(positionIds)
 
-	var tradeIds []int
-	for _, position := range positions {
-		for _, trade := range position.GetActiveTrades() {
-			tradeIds = append(tradeIds, trade.TradeID)
-		}
+	journals, err := sellJournals(session, positions)
+	if err != nil {
+		return err
 	}
 
 	log.Info().Msg(util.Shark + " .")
 	log.Info().Msg(util.Shark + " ..")
 	log.Info().Msg(util.Shark + " ... trade --sell")
 	log.Info().Int("positions", len(positionIds)).Msg(util.Shark + " ...")
-	log.Info().Int("   trades", len(tradeIds)).Msg(util.Shark + " ...")
+	log.Info().Int("   trades", len(journals)).Msg(util.Shark + " ...")
 	log.Info().Msg(util.Shark + " ..")
 	log.Info().Msg(util.Shark + " .")
 	log.Info().Msg(util.Shark + " ..")
 
-	if len(positions) < 1 {
+	if len(journals) < 1 {
 		log.Info().Msg(util.Shark + " ...")
 		log.Info().Msg(util.Shark + " ... no available balance found to sell")
 		log.Info().Msg(util.Shark + " ...")
@@ -71,161 +74,243 @@ func NewSells(session *config.Session) error {
 
 	done := make(chan error)
 
-	for _, productID := range session.UsdSelectionProductIDs() {
+	for _, j := range journals {
 
-		position := positions[productID]
+		go func(j *journal.Journal) {
 
-		for _, trade := range position.GetActiveTrades() {
+			productID := j.ProductID
+			goalPrice := session.GetPattern(productID).GoalPrice(j.Entry)
 
-			go func(productID string, trade cbp.Trade) {
-
-				tradeID := trade.CreatedAt.Time()
-				size := trade.Fill.Size
-				entryPrice := trade.Price()
-				entryTime := trade.CreatedAt.Time()
-				goalPrice := session.GetPattern(productID).GoalPrice(entryPrice)
+			if currentPrice, err := cbp.GetTickerPrice(productID); err == nil {
+				prt(zerolog.InfoLevel, j.Opened, productID, j.Entry, *currentPrice, goalPrice, util.Trading)
+			}
 
-				if currentPrice, err := cbp.GetTickerPrice(productID); err == nil {
-					prt(zerolog.InfoLevel, tradeID, productID, entryPrice, *currentPrice, goalPrice, util.Trading)
-				}
+			exitPrice, err := NewSell(session, j)
+			if err == nil {
+				prt(zerolog.InfoLevel, j.Opened, productID, j.Entry, *exitPrice, goalPrice, "sold")
+			}
 
-				if exitPrice, err := NewSell(session, tradeID, productID, size, entryPrice, goalPrice, entryTime); err == nil {
-					prt(zerolog.InfoLevel, tradeID, productID, entryPrice, *exitPrice, goalPrice, "sold")
-				}
+			done <- err
+		}(j)
+	}
 
-				done <- err
-				return
-			}(productID, trade)
+	for completions := 0; completions < len(journals); completions++ {
+		if err := <-done; err != nil {
+			log.Error().Err(err).Msg(util.Shark + " ...")
 		}
 	}
 
-	completions := 0
-	for {
-		select {
-		case err := <-done:
+	log.Info().Msg(util.Shark + " ...")
+	log.Info().Msg(util.Shark + " ... available balance sold, go party.")
+	log.Info().Msg(util.Shark + " ...")
+	log.Info().Msg(util.Shark + " ..")
+	log.Info().Msg(util.Shark + " .")
 
-			completions++
+	return nil
+}
 
-			if err != nil {
-				log.Error().Err(err).Msg(util.Shark + " ...")
-			}
+// sellJournals returns the journal of every open trade of the selected products, recovered with the exchange, and a
+// new journal for every active trade of the given positions that has none.
+func sellJournals(session *config.Session, positions map[string]cbp.Position) ([]*journal.Journal, error) {
 
-			if completions == len(tradeIds) {
-				log.Info().Msg(util.Shark + " ...")
-				log.Info().Msg(util.Shark + " ... available balance sold, go party.")
-				log.Info().Msg(util.Shark + " ...")
-				log.Info().Msg(util.Shark + " ..")
-				log.Info().Msg(util.Shark + " .")
-				return nil
-			}
-		}
+	pg, err := journal.NewDB()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, productID := range session.UsdSelectionProductIDs() {
+		selected[productID] = true
 	}
-}
 
-// NewSell is responsible for selling an available product balance at a goal price or better.
-func NewSell(
-	session *config.Session,
-	tradeID time.Time,
-	productID,
-	size string,
-	entryPrice,
-	goalPrice float64,
-	entryTime time.Time) (*float64, error) {
-
-	// websocket connection
-	var wsDialer ws.Dialer
-	wsConn, _, err := wsDialer.Dial("wss://ws-feed.pro.coinbase.com", nil)
+	open, err := journal.Find(pg, cbp.IsPaper())
 	if err != nil {
-		log.Error().Err(err).Str("action", "open").Msgf("%s ... %5s ...", util.Shark, util.GetCurrency(productID))
 		return nil, err
 	}
 
-	defer func(wsConn *ws.Conn) {
-		if err := wsConn.Close(); err != nil {
-			log.Error().Err(err).Str("action", "close").Msgf("%s ... %5s ...", util.Shark, util.GetCurrency(productID))
+	var journals []*journal.Journal
+	journaled := map[string]bool{}
+	for _, j := range open {
+		if !selected[j.ProductID] {
+			continue
 		}
-	}(wsConn)
-
-	// loop infinitely until we sell
-	var i int
-	for {
+		if j.EntryOrderID != "" {
+			journaled[j.EntryOrderID] = true
+		}
+		if err := j.Recover(); err != nil {
+			return nil, err
+		}
+		if j.State.Open() {
+			journals = append(journals, j)
+		}
+	}
 
-		// get the last known price for this product
-		currentPrice, err := cbp.GetPrice(wsConn, productID)
-		if err != nil {
-			if err = wsConn.Close(); err != nil {
-				log.Error().Err(err).Msgf("%s ... %s ... %s ", util.Shark, util.GetCurrency(productID), util.Ex)
+	for _, productID := range session.UsdSelectionProductIDs() {
+		position, ok := positions[productID]
+		if !ok {
+			continue
+		}
+		for _, trade := range position.GetActiveTrades() {
+			if journaled[trade.FillID] {
+				continue
 			}
-			if wsConn, _, err = wsDialer.Dial("wss://ws-feed.pro.coinbase.com", nil); err != nil {
-				log.Error().Err(err).Str("action", "open").Msgf("%s ... %5s ...", util.Shark, util.GetCurrency(productID))
+			j, err := adopt(session, pg, productID, trade)
+			if err != nil {
 				return nil, err
 			}
-			if currentPrice, err = cbp.GetTickerPrice(productID); err != nil {
-				log.Error().Msgf("%s ... %s ... %s ", util.Shark, util.GetCurrency(productID), util.Ex)
-				time.Sleep(time.Second * 5 * time.Duration(i))
-				continue
-			}
+			journals = append(journals, j)
 		}
+	}
 
-		// if we've met or exceeded our goal price, or ...
-		if *currentPrice >= goalPrice || // or
-			// if we haven't met our goal, but it has been at least 45 minutes
-			(entryTime.Add(time.Minute*45).After(time.Now()) && // and
-				// if we can get our money back, with fees
-				*currentPrice >= entryPrice+(entryPrice*cbp.Maker())) {
-			// then anchor and climb.
-			return anchor(session, tradeID, size, productID, entryPrice, *currentPrice, *currentPrice)
-		}
+	return journals, nil
+}
 
-		// else, get the next price and keep the dream alive that it meets or exceeds our goal price.
-		i++
-		if i%10 == 0 {
-			prt(zerolog.InfoLevel, tradeID, productID, entryPrice, *currentPrice, goalPrice, util.Trading)
-		}
+// adopt returns a new journal of the given active trade, entered at the trade fill with the average true range of
+// recent rates, so that it is sold and resumed like any other trade.
+func adopt(session *config.Session, pg *gorm.DB, productID string, trade cbp.Trade) (*journal.Journal, error) {
+
+	pattern := session.GetPattern(productID)
+
+	confirmation, err := indicator.NewConfirmation(nil)
+	if err != nil {
+		return nil, err
 	}
+	atr := indicator.NewATR(14)
+	warmup(productID, pattern.RateGranularity(), confirmation, atr)
+
+	var volatility float64
+	if atr.Ready() {
+		volatility = atr.Value()
+	}
+
+	j := journal.New(pg, productID, trade.Total(), volatility)
+	return j, j.Bought(&cb.Order{
+		ID:            trade.FillID,
+		FilledSize:    trade.Fill.Size,
+		ExecutedValue: strconv.FormatFloat(trade.Total(), 'f', -1, 64),
+		FillFees:      trade.Fee,
+		CreatedAt:     trade.CreatedAt,
+	})
 }
 
-// anchor attempts to create a new limit loss order for the given balance return climb.
-func anchor(session *config.Session, id time.Time, size, productID string, entryPrice, currentPrice, goalPrice float64) (*float64, error) {
-	prt(zerolog.WarnLevel, id, productID, entryPrice, currentPrice, goalPrice, util.Anchor)
-	order, err := cbp.CreateOrder(session.GetPattern(productID).NewLimitLossOrder(currentPrice, size))
+// NewSell sells the journaled position with the pattern exit, the same exit simulations model, and returns the exit
+// price. A stop loss order rests at the exit stop price and is replaced every time the stop rises. Limit and time exits
+// cancel it and sell at market, as the stop order holds the balance, and so does a stop the exchange has not filled.
+// Every step is written to the journal, and a journal with a resting stop order resumes with it.
+func NewSell(session *config.Session, j *journal.Journal) (*float64, error) {
+
+	productID := j.ProductID
+	tradeID := j.Opened
+	pattern := session.GetPattern(productID)
+
+	exit, err := pattern.NewExit(j.Entry, j.ATR, j.Opened)
 	if err != nil {
-		prt(zerolog.ErrorLevel, id, productID, entryPrice, currentPrice, goalPrice, err.Error())
 		return nil, err
 	}
-	return climb(session, id, size, order.ID, productID, entryPrice, currentPrice, goalPrice)
-}
 
-// climb attempts to sell the given available balance at a price greater than goal price.
-// climb polls live ticker rates and looks for a rate that closes higher than the given goal price.
-// climb recognizes limit loss order executions through rates with a low that is less than the given goal price.
-// climb attempts to cancel the given limit loss order when a higher goal price has been found, and returns anchor.
-func climb(session *config.Session, tradeID time.Time, size, orderID, productID string, entryPrice, currentPrice, goalPrice float64) (*float64, error) {
+	orderID := j.StopOrderID
+	var stop float64
+	if orderID != "" {
+		exit.Restore(j.Stop)
+		stop = j.Stop
+	}
+	j.Goal = exit.Goal
+
+	rates, cancel := cbp.SubscribeRates(productID)
+	defer cancel()
 
 	for {
 
-		prt(zerolog.WarnLevel, tradeID, productID, entryPrice, currentPrice, goalPrice, util.Climb)
+		if exit.Stop != stop {
+			if orderID, err = anchor(pattern, tradeID, orderID, j.Size, exit); err != nil {
+				return nil, err
+			}
+			stop = exit.Stop
+			if err := j.Anchored(orderID, stop); err != nil {
+				prt(zerolog.WarnLevel, tradeID, productID, j.Entry, stop, exit.Goal, err.Error())
+			}
+		}
 
-		rate, err := cbp.GetRate(productID)
-		if err != nil {
-			prt(zerolog.ErrorLevel, tradeID, productID, entryPrice, currentPrice, goalPrice, err.Error())
-			return nil, err
+		prt(zerolog.InfoLevel, tradeID, productID, j.Entry, stop, exit.Goal, util.Climb)
+
+		rate, ok := <-rates
+		if !ok {
+			prt(zerolog.ErrorLevel, tradeID, productID, j.Entry, stop, exit.Goal, cbp.ErrHubStopped.Error())
+			return nil, cbp.ErrHubStopped
+		}
+
+		price, kind := exit.Next(rate)
+		if kind == "" {
+			continue
 		}
 
-		if rate.Close > goalPrice {
-			prt(zerolog.WarnLevel, tradeID, productID, entryPrice, rate.Close, rate.Close, util.Camp)
+		if kind == cbp.StopFill {
+			if order, ok := filled(orderID); ok { // already sold
+				exitPrice := util.Float64(order.ExecutedValue) / util.Float64(order.FilledSize)
+				prt(zerolog.WarnLevel, tradeID, productID, j.Entry, exitPrice, exit.Goal, util.Fell)
+				if err := j.Sold(orderID, exitPrice, cbp.StopFill); err != nil {
+					prt(zerolog.WarnLevel, tradeID, productID, j.Entry, exitPrice, exit.Goal, err.Error())
+				}
+				return &exitPrice, nil
+			}
+			prt(zerolog.WarnLevel, tradeID, productID, j.Entry, price, exit.Goal, util.Fell)
+		}
+
+		prt(zerolog.WarnLevel, tradeID, productID, j.Entry, rate.Close, exit.Goal, util.Camp)
+		if orderID != "" {
 			if err := cbp.CancelOrder(orderID); err != nil {
-				prt(zerolog.ErrorLevel, tradeID, productID, entryPrice, rate.Close, rate.Close, err.Error())
+				prt(zerolog.ErrorLevel, tradeID, productID, j.Entry, rate.Close, exit.Goal, err.Error())
 				return nil, err
 			}
-			return anchor(session, tradeID, size, productID, entryPrice, rate.Close, rate.Close)
 		}
 
-		if rate.Low < goalPrice { // already sold
-			prt(zerolog.WarnLevel, tradeID, productID, entryPrice, rate.Close, goalPrice, util.Fell)
-			return &goalPrice, nil
+		order, err := cbp.CreateOrder(pattern.NewMarketSellOrder(j.Size))
+		if err != nil {
+			prt(zerolog.ErrorLevel, tradeID, productID, j.Entry, rate.Close, exit.Goal, err.Error())
+			return nil, err
+		}
+
+		exitPrice := util.Float64(order.ExecutedValue) / util.Float64(order.FilledSize)
+		if err := j.Sold(order.ID, exitPrice, cbp.MarketFill); err != nil {
+			prt(zerolog.WarnLevel, tradeID, productID, j.Entry, exitPrice, exit.Goal, err.Error())
+		}
+		return &exitPrice, nil
+	}
+}
+
+// filled returns the given stop loss order when the exchange has filled it. A stop the rates crossed may not have
+// filled yet, eg. when the price gapped through the limit, and then it is canceled and sold at market instead.
+func filled(orderID string) (*cb.Order, bool) {
+	if orderID == "" {
+		return nil, false
+	}
+	order, err := cbp.FindOrder(orderID)
+	if err != nil || order.Status != "done" || order.DoneReason != "filled" || util.IsZero(order.FilledSize) {
+		return nil, false
+	}
+	return order, true
+}
+
+// anchor replaces the given stop loss order, if any, with a stop loss order at the exit stop price, and returns the
+// id of the new order.
+func anchor(pattern *cbp.Pattern, tradeID time.Time, orderID, size string, exit *cbp.Exit) (string, error) {
+
+	prt(zerolog.WarnLevel, tradeID, pattern.ID, exit.Entry, exit.Stop, exit.Goal, util.Anchor)
+
+	if orderID != "" {
+		if err := cbp.CancelOrder(orderID); err != nil {
+			prt(zerolog.ErrorLevel, tradeID, pattern.ID, exit.Entry, exit.Stop, exit.Goal, err.Error())
+			return "", err
 		}
 	}
+
+	order, err := cbp.CreateOrder(pattern.NewLimitLossOrder(exit.Stop, size))
+	if err != nil {
+		prt(zerolog.ErrorLevel, tradeID, pattern.ID, exit.Entry, exit.Stop, exit.Goal, err.Error())
+		return "", err
+	}
+
+	return order.ID, nil
 }
 
 func prt(
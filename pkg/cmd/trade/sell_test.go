@@ -19,12 +19,65 @@
 package trade
 
 import (
+	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/test"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"testing"
+	"time"
 )
 
 func TestNewSells(t *testing.T) {
-	if err := NewSells(test.Session()); err != nil {
+	test.Dir(t)
+	if err := NewSells(test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
+
+func TestFilled(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	server := fake.NewServer(100, 0, []cbp.Rate{*cbp.NewRate("ALGO-USD", cb.HistoricRate{
+		Time:   alpha,
+		Low:    1,
+		High:   1,
+		Open:   1,
+		Close:  1,
+		Volume: 1,
+	})})
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10}
+	if _, err := cbp.CreateOrder(pattern.NewMarketBuyOrder()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := filled(""); ok {
+		t.Error("expected no stop order to be filled")
+	}
+
+	// a stop resting on the book has not sold the position
+	stop, err := cbp.CreateOrder(pattern.NewLimitLossOrder(.5, "10"))
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := filled(stop.ID); ok {
+		t.Error("expected a resting stop order to be unfilled")
+	}
+	if err := cbp.CancelOrder(stop.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	sold, err := cbp.CreateOrder(pattern.NewMarketSellOrder("10"))
+	if err != nil {
+		t.Fatal(err)
+	} else if order, ok := filled(sold.ID); !ok || order.FilledSize != "10.000000" {
+		t.Errorf("expected a filled order, got %+v", order)
+	}
+}
@@ -19,15 +19,26 @@
 package trade
 
 import (
+	"context"
 	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/pkg/indicator"
+	"github.com/nelsw/nuchal/pkg/journal"
 	"github.com/nelsw/nuchal/pkg/util"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"sort"
 	"time"
 )
 
 // New will attempt to buy and sell automagically.
 func New(ses *config.Session) error {
+	return run(context.Background(), ses)
+}
+
+// run trades until the given context is done, then stops the market data hub. Open positions stay journaled, and are
+// resumed by the next run.
+func run(ctx context.Context, ses *config.Session) error {
 
 	log.Info().Msg(util.Shark + " .")
 	log.Info().Msg(util.Shark + " ..")
@@ -38,61 +49,193 @@ func New(ses *config.Session) error {
 		return nil
 	}
 
-	exit := make(chan string)
-	go func() {
-		for _, productID := range ses.UsdSelectionProductIDs() {
-			go trade(ses, productID)
-		}
-	}()
-	for {
-		select {
-		case <-exit:
-			return nil
-		}
+	risk := newRisk(ses.Risk)
+	pg, err := journal.NewDB()
+	if err != nil {
+		return err
 	}
+
+	cbp.StartHub(ses.UsdSelectionProductIDs())
+	defer cbp.StopHub()
+
+	restore(ses, pg, risk)
+	resume(ses, pg, risk)
+
+	for _, productID := range ses.UsdSelectionProductIDs() {
+		go trade(ses, pg, productID, risk)
+	}
+
+	<-ctx.Done()
+	return nil
 }
 
-func trade(session *config.Session, productID string) {
+func trade(session *config.Session, pg *gorm.DB, productID string, risk *risk) {
 
 	log.Info().Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Trading)
 
-	var then, that cbp.Rate
-	for {
-		if this, err := cbp.GetRate(productID); err != nil {
-			then = cbp.Rate{}
-			that = cbp.Rate{}
-		} else if !session.GetPattern(productID).MatchesTweezerBottomPattern(then, that, *this) {
-			then = that
-			that = *this
-		} else {
-			go buy(session, productID)
-			then = cbp.Rate{}
-			that = cbp.Rate{}
+	pattern := session.GetPattern(productID)
+
+	confirmation, err := indicator.NewConfirmation(pattern.Confirm)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+	atr := indicator.NewATR(14)
+	warmup(productID, pattern.RateGranularity(), confirmation, atr)
+
+	feed, cancel, err := cbp.SubscribeCandles(productID, pattern.RateGranularity())
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+	defer cancel()
+
+	var rates []cbp.Rate
+	for this := range feed {
+
+		confirmation.Add(this)
+		atr.Add(this)
+
+		if rates = append(rates, this); len(rates) > pattern.Window() {
+			rates = rates[1:]
+		}
+
+		if pattern.Matches(rates) && confirmation.Confirms() {
+			var volatility float64
+			if atr.Ready() {
+				volatility = atr.Value()
+			}
+			go buy(session, pg, productID, risk, volatility)
+			rates = nil
 		}
 	}
 }
 
-func buy(session *config.Session, productID string) {
+// warmup seeds the confirmation indicators and the given average true range with recent historic rates of the given
+// granularity in seconds, so that trading may begin immediately. Coinbase Pro returns at most 300 rates for a single
+// request.
+func warmup(productID string, granularity int, confirmation *indicator.Confirmation, atr *indicator.ATR) {
 
-	log.Info().Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
+	n := confirmation.Warmup()
+	if n < 15 {
+		n = 15
+	} else if n > 300 {
+		n = 300
+	}
 
-	order, err := cbp.CreateOrder(session.GetPattern(productID).NewMarketBuyOrder())
-	if err == nil {
+	omega := time.Now()
+	alpha := omega.Add(-time.Second * time.Duration(n*granularity))
+
+	rates, err := cbp.GetHistoricCandles(productID, alpha, omega, granularity)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Unix < rates[j].Unix
+	})
+
+	for _, rate := range rates {
+		confirmation.Add(rate)
+		atr.Add(rate)
+	}
+}
+
+// buy creates a market buy order, sized by the pattern with the available USD balance and the given average true
+// range, when the order book is liquid enough and the risk limits allow it. Then sells the position with NewSell,
+// journaling every step.
+func buy(session *config.Session, pg *gorm.DB, productID string, risk *risk, atr float64) {
+
+	pattern := session.GetPattern(productID)
+
+	price, err := cbp.GetTickerPrice(productID)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
+		return
+	}
 
-		size := order.Size
-		entryPrice := util.Float64(order.ExecutedValue) / util.Float64(size)
-		goalPrice := session.GetPattern(productID).GoalPrice(entryPrice)
-		entryTime := order.CreatedAt.Time()
+	balance, err := cbp.GetAvailableUsd()
+	if err != nil {
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
+		return
+	}
+
+	order, err := pattern.NewSizedMarketBuyOrder(*price, balance, atr)
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+
+	book, _ := cbp.GetBook(productID)
+	if err := pattern.Liquid(book, order); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+
+	usd := util.Float64(order.Funds)
+	if usd == 0 {
+		usd = *price * util.Float64(order.Size)
+	}
+	if err := risk.open(productID, usd, time.Now()); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Ex)
+		return
+	}
+
+	log.Info().Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
 
-		if _, err := NewSell(session, entryTime, productID, size, entryPrice, goalPrice, entryTime); err != nil {
-			log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
+	j := journal.New(pg, productID, usd, atr)
+	order.ClientOID = j.ClientOID
+	if err := j.Save(); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... journal", util.Shark, util.GetCurrency(productID))
+	}
+
+	order, err = enter(pattern, order, j)
+	if err == nil {
+		if err := j.Bought(order); err != nil {
+			log.Warn().Err(err).Msgf("%s ... %5s ... journal", util.Shark, util.GetCurrency(productID))
 		}
+		sell(session, risk, j)
 		return
 	}
 
+	if err := j.Rejected(); err != nil {
+		log.Warn().Err(err).Msgf("%s ... %5s ... journal", util.Shark, util.GetCurrency(productID))
+	}
+
+	risk.cancel(productID, usd)
+
 	log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(productID), util.Receipt)
 
 	if util.IsInsufficientFunds(err) {
 		time.Sleep(time.Hour) // todo check if has funds and if more sleep required
 	}
 }
+
+// sell sells the journaled position with NewSell, and records its realized result with the risk limits.
+func sell(session *config.Session, risk *risk, j *journal.Journal) {
+
+	if _, err := NewSell(session, j); err != nil {
+		// the position is still open, so its reservation is kept
+		log.Error().Err(err).Msgf("%s ... %5s ... %s", util.Shark, util.GetCurrency(j.ProductID), util.Receipt)
+		return
+	}
+
+	if risk.close(j.ProductID, j.Usd, j.Result(), time.Now()) {
+		kill(session, risk)
+	}
+}
+
+// kill is called once when the daily loss limit is hit, new entries have stopped and positions may be liquidated.
+func kill(session *config.Session, risk *risk) {
+
+	log.Error().Msgf("%s ... daily loss limit of %s reached, no new entries", util.Shark, util.Usd(risk.MaxDailyLoss))
+
+	if !session.ExitOnKill {
+		return
+	}
+
+	if err := NewExits(session); err != nil {
+		log.Error().Err(err).Msgf("%s ... %s", util.Shark, util.Ex)
+	}
+}
@@ -15,16 +15,20 @@
  * limitations under the License.
  * /
  */
-
 package trade
 
 import (
+	"context"
 	"github.com/nelsw/nuchal/test"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
-	if err := New(test.Session()); err != nil {
+	test.Dir(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := run(ctx, test.Session(t)); err != nil {
 		t.Error(err)
 	}
 }
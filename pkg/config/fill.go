@@ -0,0 +1,162 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package config
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"gopkg.in/yaml.v2"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// FillModel defines how simulated orders are filled, so simulation results resemble those of live market orders.
+// The zero value fills every order exactly at the expected price.
+type FillModel struct {
+
+	// Slippage is a fixed fraction of the price lost on every market order.
+	Slippage float64 `envconfig:"FILL_SLIPPAGE" yaml:"slippage"`
+
+	// Volatility is the fraction of the fill candle range, high minus low, lost on every market order.
+	Volatility float64 `envconfig:"FILL_VOLATILITY" yaml:"volatility"`
+
+	// Spread is the bid/ask spread as a fraction of the price, where market orders cross half of it.
+	Spread float64 `envconfig:"FILL_SPREAD" yaml:"spread"`
+
+	// EstimateSpread estimates the spread from the high and low of the last two candles when Spread is zero.
+	EstimateSpread bool `envconfig:"FILL_ESTIMATE_SPREAD" yaml:"estimate_spread"`
+
+	// Latency is the amount of candles between a pattern match and the entry order fill.
+	Latency int `envconfig:"FILL_LATENCY" yaml:"latency"`
+
+	// StopAtLow fills triggered stop loss orders at the candle low rather than the stop price.
+	StopAtLow bool `envconfig:"FILL_STOP_AT_LOW" yaml:"stop_at_low"`
+
+	// Participation is the largest fraction of a candle volume an entry order may fill, the remaining size fills
+	// at the open of the candles that follow. Zero fills the entire order on the first candle.
+	Participation float64 `envconfig:"FILL_PARTICIPATION" yaml:"participation"`
+
+	// MakerFill is the chance a limit entry fills once a candle trades below its price, as its place in the queue is
+	// unknown. Zero fills every limit entry that is traded through.
+	MakerFill float64 `envconfig:"FILL_MAKER" yaml:"maker_fill"`
+}
+
+// NewFillModel reads the fill model from the environment, then from the fill section of the given config file.
+func NewFillModel(name string) *FillModel {
+
+	type fillConfig struct {
+		Fill FillModel `yaml:"fill"`
+	}
+
+	c := new(fillConfig)
+	if err := envconfig.Process("", c); err == nil && c.Fill != (FillModel{}) {
+		return &c.Fill
+	}
+
+	c = new(fillConfig)
+	if f, err := os.Open(name); err == nil {
+		if err := yaml.NewDecoder(f).Decode(c); err == nil {
+			return &c.Fill
+		}
+	}
+
+	return new(FillModel)
+}
+
+// SpreadOf returns the spread fraction for an order filled at the given rate, which follows the given previous rate.
+func (m *FillModel) SpreadOf(prev, this cbp.Rate) float64 {
+	if m == nil {
+		return 0
+	}
+	if m.Spread > 0 || !m.EstimateSpread {
+		return m.Spread
+	}
+	return estimateSpread(prev, this)
+}
+
+// SlippageOf returns the fraction of the price lost to slippage on a market order filled at the given rate.
+func (m *FillModel) SlippageOf(rate cbp.Rate) float64 {
+	if m == nil || rate.Open == 0 {
+		return 0
+	}
+	return m.Slippage + m.Volatility*(rate.High-rate.Low)/rate.Open
+}
+
+// Buy returns the price a market buy order expecting the given price fills at.
+func (m *FillModel) Buy(price float64, prev, this cbp.Rate) float64 {
+	return price * (1 + m.SpreadOf(prev, this)/2 + m.SlippageOf(this))
+}
+
+// Sell returns the price a market sell order expecting the given price fills at.
+func (m *FillModel) Sell(price float64, prev, this cbp.Rate) float64 {
+	return price * (1 - m.SpreadOf(prev, this)/2 - m.SlippageOf(this))
+}
+
+// Stop returns the price a stop loss order at the given price fills at when triggered by the given rate.
+func (m *FillModel) Stop(price float64, prev, this cbp.Rate) float64 {
+	if m == nil {
+		return price
+	}
+	if m.StopAtLow {
+		price = math.Min(price, this.Low)
+	}
+	return m.Sell(price, prev, this)
+}
+
+// Bid returns the best bid when the given price is traded, half the spread below it.
+func (m *FillModel) Bid(price float64, prev, this cbp.Rate) float64 {
+	return price * (1 - m.SpreadOf(prev, this)/2)
+}
+
+// Limit returns true if a resting limit buy at the given price fills during the given rate, which must trade below
+// the price. The chance of a fill is drawn from the rate time, so simulations are repeatable.
+func (m *FillModel) Limit(price float64, rate cbp.Rate) bool {
+	if rate.Low >= price {
+		return false
+	}
+	if m == nil || m.MakerFill <= 0 || m.MakerFill >= 1 {
+		return true
+	}
+	return rand.New(rand.NewSource(rate.Unix)).Float64() < m.MakerFill
+}
+
+// Fills returns the size of an entry order filled at the given rate, given the size that remains unfilled.
+func (m *FillModel) Fills(remaining float64, rate cbp.Rate) float64 {
+	if m == nil || m.Participation <= 0 {
+		return remaining
+	}
+	return math.Min(remaining, m.Participation*rate.Volume)
+}
+
+// estimateSpread is the Corwin-Schultz high-low spread estimator over two consecutive rates.
+func estimateSpread(prev, this cbp.Rate) float64 {
+
+	if prev.Low <= 0 || this.Low <= 0 {
+		return 0
+	}
+
+	k := 3 - 2*math.Sqrt2
+	beta := math.Pow(math.Log(prev.High/prev.Low), 2) + math.Pow(math.Log(this.High/this.Low), 2)
+	gamma := math.Pow(math.Log(math.Max(prev.High, this.High)/math.Min(prev.Low, this.Low)), 2)
+	alpha := (math.Sqrt(2*beta)-math.Sqrt(beta))/k - math.Sqrt(gamma/k)
+
+	spread := 2 * (math.Exp(alpha) - 1) / (1 + math.Exp(alpha))
+	return math.Max(spread, 0)
+}
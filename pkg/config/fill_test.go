@@ -0,0 +1,94 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package config
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+)
+
+func rate(open, high, low, close, volume float64) cbp.Rate {
+	return *cbp.NewRate("BTC-USD", cb.HistoricRate{Open: open, High: high, Low: low, Close: close, Volume: volume})
+}
+
+func TestFillModel(t *testing.T) {
+
+	prev, this := rate(100, 101, 99, 100, 10), rate(100, 102, 98, 101, 10)
+
+	var none *FillModel
+	if none.Buy(100, prev, this) != 100 || none.Stop(90, prev, this) != 90 || none.Fills(5, this) != 5 {
+		t.Error("expected a nil fill model to fill at the expected price")
+	}
+
+	m := &FillModel{Slippage: .001, Volatility: .5, Spread: .002, StopAtLow: true, Participation: .1}
+
+	// half the spread, fixed slippage, and half of the 4% range
+	if got := m.Buy(100, prev, this); math.Abs(got-102.2) > 1e-9 {
+		t.Errorf("buy = %f, want 102.2", got)
+	}
+	if got := m.Sell(100, prev, this); math.Abs(got-97.8) > 1e-9 {
+		t.Errorf("sell = %f, want 97.8", got)
+	}
+	if got := m.Stop(99, prev, this); math.Abs(got-98*.978) > 1e-9 {
+		t.Errorf("stop = %f, want %f", got, 98*.978)
+	}
+	if got := m.Fills(5, this); got != 1 {
+		t.Errorf("fills = %f, want 1", got)
+	}
+
+	estimated := &FillModel{EstimateSpread: true}
+	if spread := estimated.SpreadOf(prev, this); spread < 0 || spread > .04 {
+		t.Errorf("estimated spread = %f, want between 0 and the candle range", spread)
+	}
+}
+
+func TestFillModelLimit(t *testing.T) {
+
+	var none *FillModel
+	this := rate(100, 101, 99, 100, 1)
+
+	if none.Bid(100, this, this) != 100 {
+		t.Error("expected a nil fill model to bid at the price")
+	}
+	if !none.Limit(99.5, this) || none.Limit(99, this) {
+		t.Error("expected a limit to fill only when traded through")
+	}
+
+	m := &FillModel{Spread: .002, MakerFill: .5}
+	if got := m.Bid(100, this, this); math.Abs(got-99.9) > 1e-9 {
+		t.Errorf("bid = %f, want 99.9", got)
+	}
+
+	var filled int
+	for i := 0; i < 1000; i++ {
+		r := this
+		r.Unix = int64(i)
+		if m.Limit(99.5, r) {
+			filled++
+		}
+		if m.Limit(99.5, r) != m.Limit(99.5, r) {
+			t.Fatal("expected repeatable limit fills")
+		}
+	}
+	if filled < 400 || filled > 600 {
+		t.Errorf("expected about half of the limits to fill, got %d of 1000", filled)
+	}
+}
@@ -20,6 +20,9 @@ package config
 
 import (
 	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/indicator"
+	"github.com/nelsw/nuchal/pkg/util"
+	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 	"os"
 	"sort"
@@ -52,6 +55,17 @@ func NewParagon(name string, size, gain, loss, delta float64) *paragon {
 		if err = yaml.NewDecoder(f).Decode(c); err == nil && c.isValid() {
 			for _, pattern := range c.Patterns {
 				pattern.InitPattern(size, gain, loss, delta)
+				if _, ok := pattern.Candlestick(); !ok {
+					log.Warn().
+						Str("type", pattern.Type).
+						Strs("types", cbp.GetCandlestickNames()).
+						Msgf("%s ... %s ... unknown pattern type", util.Cichlid, pattern.ID)
+					continue
+				}
+				if _, err := indicator.NewConfirmation(pattern.Confirm); err != nil {
+					log.Warn().Err(err).Msgf("%s ... %s ... invalid pattern confirmation", util.Cichlid, pattern.ID)
+					continue
+				}
 				p.patterns[pattern.ID] = pattern
 			}
 			return p
@@ -66,11 +80,12 @@ func (p *paragon) GetPattern(productID string) *cbp.Pattern {
 		return &pattern
 	}
 	return &cbp.Pattern{
-		productID,
-		p.gain,
-		p.loss,
-		p.size,
-		p.delta,
+		ID:    productID,
+		Gain:  p.gain,
+		Loss:  p.loss,
+		Size:  p.size,
+		Delta: p.delta,
+		Type:  cbp.TweezerBottom,
 	}
 }
 
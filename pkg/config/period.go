@@ -21,6 +21,7 @@ package config
 import (
 	"fmt"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/nelsw/nuchal/pkg/cbp"
 	cb "github.com/preichenberger/go-coinbasepro/v2"
 	"gopkg.in/yaml.v2"
 	"os"
@@ -123,6 +124,33 @@ func (p *period) InPeriod(t time.Time) bool {
 	return p.Alpha.Before(t) && p.Omega.After(t)
 }
 
+// Fold is a pair of consecutive periods, one to tune pattern criteria and the next to evaluate them.
+type Fold struct {
+	In, Out *period
+}
+
+// WalkForward splits the period into rolling folds of the given in-sample and out-of-sample durations. Each
+// out-of-sample period immediately follows its in-sample period, and every fold starts one out-of-sample duration
+// after the last, so out-of-sample periods never overlap.
+func (p *period) WalkForward(in, out time.Duration) []Fold {
+
+	var folds []Fold
+	if in <= 0 || out <= 0 {
+		return folds
+	}
+
+	for alpha := *p.Alpha; !alpha.Add(in + out).After(*p.Omega); alpha = alpha.Add(out) {
+		folds = append(folds, Fold{newPeriod(alpha, in), newPeriod(alpha.Add(in), out)})
+	}
+
+	return folds
+}
+
+func newPeriod(alpha time.Time, duration time.Duration) *period {
+	omega := alpha.Add(duration)
+	return &period{Alpha: &alpha, Omega: &omega, Duration: &duration}
+}
+
 func (p *period) Start() *time.Time {
 	return p.Alpha
 }
@@ -131,17 +159,8 @@ func (p *period) Stop() *time.Time {
 	return p.Omega
 }
 
+// RateParams returns the historic rate requests of every minute of the period, each under the Coinbase Pro limit.
 func (p period) RateParams() *[]cb.GetHistoricRatesParams {
-	start := *p.Alpha
-	end := start.Add(time.Hour * 4)
-	var results []cb.GetHistoricRatesParams
-	for i := 0; i < 24; i += 4 {
-		results = append(results, cb.GetHistoricRatesParams{start, end, 60})
-		start = end
-		end = end.Add(time.Hour * 4)
-		if end.After(*p.Omega) {
-			break
-		}
-	}
-	return &results
+	params := cbp.RatePages(*p.Alpha, *p.Omega, cbp.Minute)
+	return &params
 }
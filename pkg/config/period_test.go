@@ -0,0 +1,52 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodWalkForward(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	p := newPeriod(alpha, time.Hour*10)
+
+	folds := p.WalkForward(time.Hour*4, time.Hour*2)
+	if len(folds) != 3 {
+		t.Fatalf("folds = %d, want 3", len(folds))
+	}
+
+	for i, fold := range folds {
+		if !fold.In.Omega.Equal(*fold.Out.Alpha) {
+			t.Errorf("fold %d out of sample does not follow in sample", i)
+		}
+		if i > 0 && !fold.Out.Alpha.Equal(*folds[i-1].Out.Omega) {
+			t.Errorf("fold %d out of sample does not follow the last fold", i)
+		}
+	}
+
+	if last := folds[len(folds)-1]; !last.Out.Omega.Equal(*p.Omega) {
+		t.Errorf("last fold ends at %s, want %s", last.Out.Omega, p.Omega)
+	}
+
+	if folds := p.WalkForward(time.Hour*8, time.Hour*4); len(folds) != 0 {
+		t.Errorf("folds = %d, want 0", len(folds))
+	}
+}
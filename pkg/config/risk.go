@@ -0,0 +1,73 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package config
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v2"
+	"os"
+	"time"
+)
+
+// Risk defines the limits every trade entry must pass. Zero values are unlimited.
+type Risk struct {
+
+	// MaxPositions is the largest amount of positions open at once.
+	MaxPositions int `envconfig:"RISK_MAX_POSITIONS" yaml:"max_positions"`
+
+	// MaxProductUsd is the largest USD amount open in a single product.
+	MaxProductUsd float64 `envconfig:"RISK_MAX_PRODUCT_USD" yaml:"max_product_usd"`
+
+	// MaxExposure is the largest USD amount open across every product.
+	MaxExposure float64 `envconfig:"RISK_MAX_EXPOSURE" yaml:"max_exposure"`
+
+	// MaxDailyLoss is the largest USD amount of realized losses in a UTC day, before new entries are stopped.
+	MaxDailyLoss float64 `envconfig:"RISK_MAX_DAILY_LOSS" yaml:"max_daily_loss"`
+
+	// MaxLosses is the amount of consecutive losing trades that start a cooldown.
+	MaxLosses int `envconfig:"RISK_MAX_LOSSES" yaml:"max_losses"`
+
+	// Cooldown is the amount of time new entries are paused after MaxLosses consecutive losing trades.
+	Cooldown time.Duration `envconfig:"RISK_COOLDOWN" yaml:"cooldown"`
+
+	// ExitOnKill liquidates every trading position when the daily loss limit is hit.
+	ExitOnKill bool `envconfig:"RISK_EXIT_ON_KILL" yaml:"exit_on_kill"`
+}
+
+// NewRisk reads the risk limits from the environment, then from the risk section of the given config file.
+func NewRisk(name string) *Risk {
+
+	type riskConfig struct {
+		Risk Risk `yaml:"risk"`
+	}
+
+	c := new(riskConfig)
+	if err := envconfig.Process("", c); err == nil && c.Risk != (Risk{}) {
+		return &c.Risk
+	}
+
+	c = new(riskConfig)
+	if f, err := os.Open(name); err == nil {
+		if err := yaml.NewDecoder(f).Decode(c); err == nil {
+			return &c.Risk
+		}
+	}
+
+	return new(Risk)
+}
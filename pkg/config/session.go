@@ -48,6 +48,8 @@ type Session struct {
 	*paragon
 	*period
 	*cull
+	*FillModel
+	*Risk
 }
 
 // NewSession reads configuration from environment variables and validates it
@@ -84,16 +86,18 @@ func NewSession(cfg, dur string, usd []string, size, gain, loss, delta float64,
 	log.Info().Msg(util.Cichlid + " . ")
 
 	// is the database established?
-	if err := db.Init(); err != nil {
+	if err := db.Init(cfg); err != nil {
 		return nil, err
 	}
 	log.Info().Msg(util.Cichlid + " .. ")
 	log.Info().Msgf(g0, util.Cichlid, util.Check)
 
 	// can we connect to coinbase?
-	var products []cbp.Product
-	pg := db.NewDB(cbp.Product{})
-	pg.Find(&products)
+	store := db.GetStore()
+	products, err := store.FindProducts()
+	if err != nil {
+		return nil, err
+	}
 	now, err := cbp.Init(cfg, &products)
 	if err != nil {
 		return nil, err
@@ -102,9 +106,14 @@ func NewSession(cfg, dur string, usd []string, size, gain, loss, delta float64,
 	log.Info().Msg(util.Cichlid + " .. ")
 
 	allProductIDs := cbp.GetAllProductIDs()
-	for _, productID := range allProductIDs {
-		product := cbp.GetProduct(productID)
-		pg.Create(&product)
+	if len(products) == 0 {
+		var cache []cbp.Product
+		for _, productID := range allProductIDs {
+			cache = append(cache, *cbp.GetProduct(productID))
+		}
+		if err := store.SaveProducts(cache); err != nil {
+			return nil, err
+		}
 	}
 
 	session := new(Session)
@@ -115,6 +124,9 @@ func NewSession(cfg, dur string, usd []string, size, gain, loss, delta float64,
 	log.Info().Msg(util.Cichlid + " .. ")
 	log.Info().Int(util.Quantity, len(allProductIDs)).Msgf(f2, util.Cichlid, util.Check)
 
+	session.FillModel = NewFillModel(cfg)
+	session.Risk = NewRisk(cfg)
+
 	session.paragon = NewParagon(cfg, size, gain, loss, delta)
 	var pat []string
 	for _, pattern := range session.paragon.patterns {
@@ -19,11 +19,13 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/nelsw/nuchal/pkg/cbp"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	reggol "gorm.io/gorm/logger"
@@ -35,102 +37,225 @@ import (
 	"time"
 )
 
+const (
+	Postgres = "postgres"
+	Sqlite   = "sqlite"
+)
+
+// Config selects and connects the database. Without a driver, Postgres is used when a host is configured, and an
+// embedded SQLite file otherwise.
 type Config struct {
-	Host string `envconfig:"POSTGRES_HOST"`
-	User string `envconfig:"POSTGRES_USER"`
-	Pass string `envconfig:"POSTGRES_PASSWORD"`
-	Name string `envconfig:"POSTGRES_DB"`
-	Port int    `envconfig:"POSTGRES_PORT"`
+
+	// Driver is the database backing the store, postgres or sqlite.
+	Driver string `envconfig:"DB_DRIVER" yaml:"driver"`
+
+	// Path is the file of the SQLite database.
+	Path string `envconfig:"SQLITE_PATH" yaml:"path"`
+
+	// Docker starts the nuchal_db Postgres container with docker compose when it isn't running.
+	Docker bool `envconfig:"DB_DOCKER" yaml:"docker"`
+
+	Host string `envconfig:"POSTGRES_HOST" yaml:"host"`
+	User string `envconfig:"POSTGRES_USER" yaml:"user"`
+	Pass string `envconfig:"POSTGRES_PASSWORD" yaml:"password"`
+	Name string `envconfig:"POSTGRES_DB" yaml:"name"`
+	Port int    `envconfig:"POSTGRES_PORT" yaml:"port"`
 }
 
 func (c *Config) dsn() string {
 	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d", c.Host, c.User, c.Pass, c.Name, c.Port)
 }
 
-var cfg *Config
+var store Store
+
+// Init connects the store configured by the database section of the given config file, overridden by the
+// environment, and then by the postgres variables of a .env file.
+func Init(name string) error {
 
-func Init() error {
+	if store != nil {
+		_ = store.Close()
+		store = nil
+	}
 
-	if bytes, err := exec.Command("/bin/sh", "-c", "docker ps --format '{{.Names}}'").Output(); err != nil {
+	s, err := NewConfig(name).open()
+	if err != nil {
 		return err
-	} else {
-		name := strings.TrimSpace(string(bytes))
-		if name != "nuchal_db" {
-			if _, err := exec.Command("/bin/sh", "-c", "docker compose -p nuchal up -d").Output(); err != nil {
-				return err
+	}
+
+	store = s
+	return nil
+}
+
+// NewConfig reads the database configuration from the database section of the given config file, overridden field by
+// field by the environment, and then from the postgres variables of a .env file, defaulting whatever is left.
+func NewConfig(name string) *Config {
+
+	type dbConfig struct {
+		Database Config `yaml:"database"`
+	}
+
+	c := new(dbConfig)
+	if f, err := os.Open(name); err == nil {
+		_ = yaml.NewDecoder(f).Decode(c)
+		_ = f.Close()
+	}
+	if err := envconfig.Process("", c); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	cfg := &c.Database
+
+	if cfg.Host == "" {
+		if envs, err := godotenv.Read(".env"); err == nil {
+			if port, err := strconv.Atoi(envs["POSTGRES_PORT"]); err == nil {
+				cfg.Host = envs["POSTGRES_HOST"]
+				cfg.User = envs["POSTGRES_USER"]
+				cfg.Name = envs["POSTGRES_DB"]
+				cfg.Pass = envs["POSTGRES_PASSWORD"]
+				cfg.Port = port
 			}
-			time.Sleep(time.Second * 5) // wait a few seconds to allow the docker composition to spin up
 		}
 	}
 
-	cfg = new(Config)
+	if cfg.Driver == "" && (cfg.Host != "" || cfg.Docker) {
+		cfg.Driver = Postgres
+	} else if cfg.Driver == "" {
+		cfg.Driver = Sqlite
+	}
 
-	_ = envconfig.Process("", cfg)
-	if err := cfg.validate(); err == nil {
-		return nil
+	if cfg.Path == "" {
+		cfg.Path = "nuchal.db"
 	}
 
-	if envs, err := godotenv.Read(".env"); err == nil {
-		if port, err := strconv.Atoi(envs["POSTGRES_PORT"]); err == nil {
-			cfg.Host = envs["POSTGRES_HOST"]
-			cfg.User = envs["POSTGRES_USER"]
-			cfg.Name = envs["POSTGRES_DB"]
-			cfg.Pass = envs["POSTGRES_PASSWORD"]
-			cfg.Port = port
-			if err = cfg.validate(); err == nil {
-				return nil
+	if cfg.Host == "" {
+		cfg.Host = "localhost"
+	}
+	if cfg.User == "" {
+		cfg.User = "postgres"
+	}
+	if cfg.Name == "" {
+		cfg.Name = "nuchal"
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 5432
+	}
+	if cfg.Pass == "" {
+		cfg.Pass = "somePassword"
+	}
+
+	return cfg
+}
+
+// open returns the store of the configured driver.
+func (c *Config) open() (Store, error) {
+
+	var db *gorm.DB
+	var err error
+
+	switch c.Driver {
+	case Postgres:
+		if c.Docker {
+			if err := compose(); err != nil {
+				return nil, err
 			}
 		}
+		db, err = openDB(postgres.Open(c.dsn()))
+	case Sqlite:
+		db, err = openSqlite(c.Path)
+	default:
+		return nil, fmt.Errorf("unknown database driver [%s], expected %s or %s", c.Driver, Postgres, Sqlite)
 	}
 
-	cfg.Host = "localhost"
-	cfg.User = "postgres"
-	cfg.Name = "nuchal"
-	cfg.Port = 5432
-	cfg.Pass = "somePassword"
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	if sql, err := db.DB(); err != nil {
+		return nil, err
+	} else if err := sql.Ping(); err != nil {
+		_ = sql.Close()
+		return nil, err
+	}
+
+	return newGormStore(db)
 }
 
-func (c Config) validate() error {
+// compose starts the nuchal_db container of the docker compose file unless it is running.
+func compose() error {
 
-	if pg, err := openDB(c.dsn()); err != nil {
-		return err
-	} else if sql, err := pg.DB(); err != nil {
-		return err
-	} else if err := sql.Ping(); err != nil {
-		return err
-	} else if err := sql.Close(); err != nil {
-		return err
-	} else if err := pg.AutoMigrate(cbp.Rate{}); err != nil {
+	bytes, err := exec.Command("/bin/sh", "-c", "docker ps --format '{{.Names}}'").Output()
+	if err != nil {
 		return err
-	} else if err := pg.AutoMigrate(cbp.Product{}); err != nil {
+	}
+
+	for _, name := range strings.Fields(string(bytes)) {
+		if name == "nuchal_db" {
+			return nil
+		}
+	}
+
+	if _, err := exec.Command("/bin/sh", "-c", "docker compose -p nuchal up -d").Output(); err != nil {
 		return err
 	}
+	time.Sleep(time.Second * 5) // wait a few seconds to allow the docker composition to spin up
 
 	return nil
 }
 
-func NewDB(vv ...interface{}) *gorm.DB {
+// NewStore returns a store of the SQLite database at the given path, for tests and tools that run without Init.
+func NewStore(path string) (Store, error) {
+	db, err := openSqlite(path)
+	if err != nil {
+		return nil, err
+	}
+	return newGormStore(db)
+}
 
-	db, err := openDB(cfg.dsn())
-	if err == nil && vv != nil && len(vv) > 0 {
-		for _, v := range vv {
-			if err = db.AutoMigrate(v); err != nil {
-				break
-			}
+// ErrNotInitialized is returned when the database is used before Init connects it.
+var ErrNotInitialized = errors.New("database not initialized")
+
+// GetStore returns the store connected by Init.
+func GetStore() Store {
+	return store
+}
+
+// NewDB returns the gorm handle of the store connected by Init, after migrating the given models, or
+// ErrNotInitialized before Init.
+func NewDB(vv ...interface{}) (*gorm.DB, error) {
+
+	if store == nil {
+		return nil, ErrNotInitialized
+	}
+
+	db := store.DB()
+	for _, v := range vv {
+		if err := db.AutoMigrate(v); err != nil {
+			return nil, err
 		}
 	}
 
+	return db, nil
+}
+
+// openSqlite opens the SQLite database at the given path through a single connection, as SQLite has a single writer.
+func openSqlite(path string) (*gorm.DB, error) {
+
+	db, err := openDB(sqlite.Open(path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"))
+	if err != nil {
+		return nil, err
+	}
+
+	sql, err := db.DB()
 	if err != nil {
-		log.Debug().Err(err).Send()
+		return nil, err
 	}
+	sql.SetMaxOpenConns(1)
 
-	return db
+	return db, nil
 }
 
-func openDB(dsn string) (*gorm.DB, error) {
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{
+func openDB(dialector gorm.Dialector) (*gorm.DB, error) {
+	return gorm.Open(dialector, &gorm.Config{
 		Logger: reggol.New(
 			gol.New(os.Stdout, "\r\n", gol.LstdFlags), // io writer
 			reggol.Config{
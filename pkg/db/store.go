@@ -0,0 +1,138 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package db
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Store persists the rates and products nuchal runs on, whichever database backs it.
+type Store interface {
+
+	// FindRates returns the stored minute rates of the given product from alpha through omega, oldest first.
+	FindRates(productID string, alpha, omega time.Time) ([]cbp.Rate, error)
+
+	// SaveRates stores the given minute rates, leaving those already stored under the same time and product.
+	SaveRates(rates []cbp.Rate) error
+
+	// FindCandles returns the stored rates of the given product and granularity in seconds from alpha up to, but
+	// excluding, omega, oldest first.
+	FindCandles(productID string, granularity int, alpha, omega time.Time) ([]cbp.Rate, error)
+
+	// SaveCandles stores the given rates of the given granularity in seconds, leaving those already stored under the
+	// same time and product, and returns how many it stored.
+	SaveCandles(granularity int, rates []cbp.Rate) (int64, error)
+
+	// FindProducts returns the cached Coinbase Pro products.
+	FindProducts() ([]cbp.Product, error)
+
+	// SaveProducts caches the given Coinbase Pro products.
+	SaveProducts(products []cbp.Product) error
+
+	// DB returns the gorm handle of the store, for the tables without a Store method.
+	DB() *gorm.DB
+
+	// Close closes the database connection.
+	Close() error
+}
+
+// gormStore is a Store of any database gorm has a driver for.
+type gormStore struct {
+	db *gorm.DB
+}
+
+// newGormStore returns a Store of the given database, migrating the product table and the rate table of every
+// granularity.
+func newGormStore(db *gorm.DB) (Store, error) {
+	if err := db.AutoMigrate(&cbp.Rate{}, &cbp.Product{}); err != nil {
+		return nil, err
+	}
+	for _, granularity := range cbp.Granularities {
+		if err := db.Table(cbp.RateTable(granularity)).AutoMigrate(&cbp.Rate{}); err != nil {
+			return nil, err
+		}
+	}
+	return &gormStore{db}, nil
+}
+
+func (s *gormStore) FindRates(productID string, alpha, omega time.Time) ([]cbp.Rate, error) {
+	var rates []cbp.Rate
+	err := s.db.
+		Where("product_id = ?", productID).
+		Where("unix BETWEEN ? AND ?", alpha.UnixNano(), omega.UnixNano()).
+		Order("unix asc").
+		Find(&rates).
+		Error
+	return rates, err
+}
+
+func (s *gormStore) SaveRates(rates []cbp.Rate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rates, 500).Error
+}
+
+func (s *gormStore) FindCandles(productID string, granularity int, alpha, omega time.Time) ([]cbp.Rate, error) {
+	var rates []cbp.Rate
+	err := s.db.
+		Table(cbp.RateTable(granularity)).
+		Where("product_id = ?", productID).
+		Where("unix >= ? AND unix < ?", alpha.UnixNano(), omega.UnixNano()).
+		Order("unix asc").
+		Find(&rates).
+		Error
+	return rates, err
+}
+
+func (s *gormStore) SaveCandles(granularity int, rates []cbp.Rate) (int64, error) {
+	if len(rates) == 0 {
+		return 0, nil
+	}
+	result := s.db.Table(cbp.RateTable(granularity)).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rates, 500)
+	return result.RowsAffected, result.Error
+}
+
+func (s *gormStore) FindProducts() ([]cbp.Product, error) {
+	var products []cbp.Product
+	err := s.db.Find(&products).Error
+	return products, err
+}
+
+func (s *gormStore) SaveProducts(products []cbp.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(products, 100).Error
+}
+
+func (s *gormStore) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *gormStore) Close() error {
+	sql, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sql.Close()
+}
@@ -0,0 +1,158 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package db
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSqliteStore(t *testing.T) {
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "nuchal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for i := 0; i < 10; i++ {
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(9-i)),
+			Low:    1,
+			High:   1,
+			Open:   1,
+			Close:  1,
+			Volume: 1,
+		}))
+	}
+	rates = append(rates, *cbp.NewRate("XLM-USD", cb.HistoricRate{Time: alpha, Low: 1, High: 1, Open: 1, Close: 1}))
+
+	if err := store.SaveRates(rates); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveRates(rates[:5]); err != nil {
+		t.Errorf("expected stored rates to be skipped, got %v", err)
+	}
+
+	out, err := store.FindRates("ALGO-USD", alpha.Add(time.Minute), alpha.Add(time.Minute*8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 8 {
+		t.Fatalf("expected 8 rates, got %d", len(out))
+	}
+	for i := 1; i < len(out); i++ {
+		if out[i-1].Unix >= out[i].Unix {
+			t.Fatal("expected the oldest rate first")
+		}
+	}
+	if !out[0].Time().Equal(alpha.Add(time.Minute)) {
+		t.Errorf("expected the first rate at %s, got %s", alpha.Add(time.Minute), out[0].Time())
+	}
+
+	// rates of other granularities are kept in a table of their own, from alpha up to omega
+	if stored, err := store.SaveCandles(300, rates[:3]); err != nil || stored != 3 {
+		t.Fatalf("expected 3 stored candles, got %d, %v", stored, err)
+	}
+	if stored, err := store.SaveCandles(300, rates[:5]); err != nil || stored != 2 {
+		t.Errorf("expected stored candles to be skipped, got %d, %v", stored, err)
+	}
+	if candles, err := store.FindCandles("ALGO-USD", 300, alpha, alpha.Add(time.Minute*9)); err != nil || len(candles) != 4 ||
+		!candles[0].Time().Equal(alpha.Add(time.Minute*5)) {
+		t.Errorf("expected the 4 candles before omega, oldest first, got %d, %v", len(candles), err)
+	}
+	if out, err := store.FindRates("ALGO-USD", alpha, alpha.Add(time.Minute*9)); err != nil || len(out) != 10 {
+		t.Errorf("expected the minute rates apart from the candles, got %d, %v", len(out), err)
+	}
+
+	products := []cbp.Product{
+		cbp.NewProduct(cb.Product{ID: "ALGO-USD", BaseCurrency: "ALGO", QuoteCurrency: "USD", BaseMinSize: "1", QuoteIncrement: "0.0001"}),
+		cbp.NewProduct(cb.Product{ID: "XLM-USD", BaseCurrency: "XLM", QuoteCurrency: "USD", BaseMinSize: "1", QuoteIncrement: "0.000001"}),
+	}
+	if err := store.SaveProducts(products); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := store.FindProducts(); err != nil || len(cached) != 2 || cached[0].ID() != "ALGO-USD" {
+		t.Errorf("expected the cached products, got %+v, %v", cached, err)
+	}
+}
+
+func TestNewDB(t *testing.T) {
+	if pg, err := NewDB(); pg != nil || err != ErrNotInitialized {
+		t.Errorf("expected an uninitialized database error, got %v", err)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+
+	setenv(t, "DB_DRIVER", "")
+	setenv(t, "POSTGRES_HOST", "")
+
+	dir := t.TempDir()
+	if c := NewConfig(filepath.Join(dir, "missing.yml")); c.Driver != Sqlite || c.Path != "nuchal.db" || c.Docker {
+		t.Errorf("expected an embedded sqlite database without docker, got %+v", c)
+	}
+
+	setenv(t, "POSTGRES_HOST", "db.example.com")
+	if c := NewConfig(""); c.Driver != Postgres || c.Host != "db.example.com" || c.Port != 5432 {
+		t.Errorf("expected postgres with a configured host, got %+v", c)
+	}
+
+	setenv(t, "DB_DRIVER", "mysql")
+	if _, err := NewConfig("").open(); err == nil {
+		t.Error("expected an unknown driver to fail")
+	}
+}
+
+func TestNewConfigMerge(t *testing.T) {
+
+	setenv(t, "DB_DRIVER", "sqlite")
+	setenv(t, "POSTGRES_HOST", "")
+
+	name := filepath.Join(t.TempDir(), "nuchal.yml")
+	yml := "database:\n  driver: postgres\n  path: data/nuchal.db\n  user: nuchal\n  port: 5433\n"
+	if err := os.WriteFile(name, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment overrides the driver alone, keeping the rest of the database section
+	if c := NewConfig(name); c.Driver != Sqlite || c.Path != "data/nuchal.db" || c.User != "nuchal" || c.Port != 5433 {
+		t.Errorf("expected the environment merged into the config file, got %+v", c)
+	}
+}
+
+// setenv sets the given environment variable until the test ends.
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	_ = os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package indicator
+
+import (
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	conditionRegex = regexp.MustCompile(`^\s*(.+?)\s*(<=|>=|<|>)\s*(.+?)\s*$`)
+	operandRegex   = regexp.MustCompile(`^([a-z_]+)(?:\(([\d.,\s]*)\))?$`)
+)
+
+// operand returns a value derived from the given rate and whether that value is ready to be compared.
+type operand func(rate cbp.Rate) (float64, bool)
+
+type condition struct {
+	left, right operand
+	operator    string
+}
+
+// Confirmation is the set of indicator conditions a pattern declares, which must all be true before a candlestick
+// match is traded. Conditions are comparisons like "rsi(14) < 30" or "close > ema(200)", where each side is a number,
+// a price of the latest rate (open, high, low, close, volume), or an indicator:
+//
+//	sma(period), ema(period), rsi(period), atr(period), vwap,
+//	macd(fast,slow,signal), macd_signal(fast,slow,signal), macd_histogram(fast,slow,signal),
+//	bollinger_upper(period,k), bollinger_middle(period,k), bollinger_lower(period,k)
+//
+// Indicators are updated with every rate given to Add, so a Confirmation is created once per product and series.
+type Confirmation struct {
+	indicators map[string]Indicator
+	conditions []condition
+	last       cbp.Rate
+}
+
+// NewConfirmation parses the given conditions.
+func NewConfirmation(expressions []string) (*Confirmation, error) {
+
+	c := new(Confirmation)
+	c.indicators = map[string]Indicator{}
+
+	for _, expression := range expressions {
+
+		chunks := conditionRegex.FindStringSubmatch(strings.ToLower(expression))
+		if chunks == nil {
+			return nil, fmt.Errorf("invalid condition [%s]", expression)
+		}
+
+		left, err := c.operand(chunks[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition [%s], %v", expression, err)
+		}
+
+		right, err := c.operand(chunks[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition [%s], %v", expression, err)
+		}
+
+		c.conditions = append(c.conditions, condition{left, right, chunks[2]})
+	}
+
+	return c, nil
+}
+
+// Add updates every indicator with the next rate in the series.
+func (c *Confirmation) Add(rate cbp.Rate) {
+	for _, indicator := range c.indicators {
+		indicator.Add(rate)
+	}
+	c.last = rate
+}
+
+// Confirms returns true if every condition holds for the latest rate, and every indicator it uses is ready.
+func (c *Confirmation) Confirms() bool {
+	for _, condition := range c.conditions {
+
+		left, ok := condition.left(c.last)
+		if !ok {
+			return false
+		}
+
+		right, ok := condition.right(c.last)
+		if !ok {
+			return false
+		}
+
+		var result bool
+		switch condition.operator {
+		case "<":
+			result = left < right
+		case "<=":
+			result = left <= right
+		case ">":
+			result = left > right
+		case ">=":
+			result = left >= right
+		}
+
+		if !result {
+			return false
+		}
+	}
+	return true
+}
+
+// Warmup returns the amount of rates required before every indicator is ready.
+func (c *Confirmation) Warmup() int {
+	var warmup int
+	for _, indicator := range c.indicators {
+		var n int
+		switch i := indicator.(type) {
+		case *SMA:
+			n = len(i.w.values)
+		case *EMA:
+			n = i.period
+		case *RSI:
+			n = i.period + 1
+		case *MACD:
+			n = i.slow.period + i.signal.period
+		case *Bollinger:
+			n = len(i.w.values)
+		case *ATR:
+			n = i.period
+		default:
+			n = 1
+		}
+		if n > warmup {
+			warmup = n
+		}
+	}
+	return warmup
+}
+
+func (c *Confirmation) operand(s string) (operand, error) {
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return func(cbp.Rate) (float64, bool) {
+			return f, true
+		}, nil
+	}
+
+	switch s {
+	case "open":
+		return func(r cbp.Rate) (float64, bool) { return r.Open, true }, nil
+	case "high":
+		return func(r cbp.Rate) (float64, bool) { return r.High, true }, nil
+	case "low":
+		return func(r cbp.Rate) (float64, bool) { return r.Low, true }, nil
+	case "close":
+		return func(r cbp.Rate) (float64, bool) { return r.Close, true }, nil
+	case "volume":
+		return func(r cbp.Rate) (float64, bool) { return r.Volume, true }, nil
+	}
+
+	chunks := operandRegex.FindStringSubmatch(s)
+	if chunks == nil {
+		return nil, fmt.Errorf("unknown operand [%s]", s)
+	}
+
+	name := chunks[1]
+
+	var args []float64
+	for _, arg := range strings.Split(chunks[2], ",") {
+		if arg = strings.TrimSpace(arg); arg == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument [%s]", arg)
+		}
+		args = append(args, f)
+	}
+
+	arg := func(i int, f float64) float64 {
+		if i < len(args) {
+			return args[i]
+		}
+		return f
+	}
+
+	switch name {
+	case "sma":
+		i := c.indicator(fmt.Sprintf("sma(%d)", int(arg(0, 20))), func() Indicator { return NewSMA(int(arg(0, 20))) })
+		return value(i, i.Value), nil
+	case "ema":
+		i := c.indicator(fmt.Sprintf("ema(%d)", int(arg(0, 20))), func() Indicator { return NewEMA(int(arg(0, 20))) })
+		return value(i, i.Value), nil
+	case "rsi":
+		i := c.indicator(fmt.Sprintf("rsi(%d)", int(arg(0, 14))), func() Indicator { return NewRSI(int(arg(0, 14))) })
+		return value(i, i.Value), nil
+	case "atr":
+		i := c.indicator(fmt.Sprintf("atr(%d)", int(arg(0, 14))), func() Indicator { return NewATR(int(arg(0, 14))) })
+		return value(i, i.Value), nil
+	case "vwap":
+		i := c.indicator("vwap", func() Indicator { return NewVWAP() })
+		return value(i, i.Value), nil
+	case "macd", "macd_signal", "macd_histogram":
+		fast, slow, signal := int(arg(0, 12)), int(arg(1, 26)), int(arg(2, 9))
+		key := fmt.Sprintf("macd(%d,%d,%d)", fast, slow, signal)
+		i := c.indicator(key, func() Indicator { return NewMACD(fast, slow, signal) }).(*MACD)
+		switch name {
+		case "macd_signal":
+			return value(i, i.Signal), nil
+		case "macd_histogram":
+			return value(i, i.Histogram), nil
+		}
+		return value(i, i.Value), nil
+	case "bollinger_upper", "bollinger_middle", "bollinger_lower":
+		period, k := int(arg(0, 20)), arg(1, 2)
+		key := fmt.Sprintf("bollinger(%d,%f)", period, k)
+		i := c.indicator(key, func() Indicator { return NewBollinger(period, k) }).(*Bollinger)
+		switch name {
+		case "bollinger_upper":
+			return value(i, i.Upper), nil
+		case "bollinger_lower":
+			return value(i, i.Lower), nil
+		}
+		return value(i, i.Value), nil
+	}
+
+	return nil, fmt.Errorf("unknown indicator [%s]", name)
+}
+
+// indicator returns the indicator with the given key, creating it when it does not yet exist.
+func (c *Confirmation) indicator(key string, fn func() Indicator) Indicator {
+	if i, ok := c.indicators[key]; ok {
+		return i
+	}
+	i := fn()
+	c.indicators[key] = i
+	return i
+}
+
+func value(i Indicator, fn func() float64) operand {
+	return func(cbp.Rate) (float64, bool) {
+		return fn(), i.Ready()
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+// Package indicator computes technical indicators incrementally, one rate at a time, so the same code serves both the
+// cached rate series of a simulation and the live one minute rates of a trade.
+package indicator
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"math"
+	"time"
+)
+
+// Indicator is a technical indicator that is updated with every new rate.
+type Indicator interface {
+
+	// Add updates the indicator with the next rate in the series.
+	Add(rate cbp.Rate)
+
+	// Value returns the current indicator value.
+	Value() float64
+
+	// Ready returns true once enough rates have been added for Value to be meaningful.
+	Ready() bool
+}
+
+// window is a fixed size ring of the most recent values added to it.
+type window struct {
+	values []float64
+	next   int
+	full   bool
+	sum    float64
+}
+
+func newWindow(size int) *window {
+	if size < 1 {
+		size = 1
+	}
+	return &window{values: make([]float64, size)}
+}
+
+func (w *window) add(f float64) {
+	w.sum += f - w.values[w.next]
+	w.values[w.next] = f
+	w.next = (w.next + 1) % len(w.values)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *window) mean() float64 {
+	return w.sum / float64(len(w.values))
+}
+
+func (w *window) stddev() float64 {
+	mean := w.mean()
+	var sum float64
+	for _, v := range w.values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(w.values)))
+}
+
+// SMA is the simple moving average of rate closes.
+type SMA struct {
+	w *window
+}
+
+// NewSMA returns a simple moving average over the given period.
+func NewSMA(period int) *SMA {
+	return &SMA{newWindow(period)}
+}
+
+func (i *SMA) Add(rate cbp.Rate) {
+	i.w.add(rate.Close)
+}
+
+func (i *SMA) Value() float64 {
+	return i.w.mean()
+}
+
+func (i *SMA) Ready() bool {
+	return i.w.full
+}
+
+// EMA is the exponential moving average of rate closes, seeded with the simple moving average of the first period.
+type EMA struct {
+	period int
+	count  int
+	value  float64
+	seed   float64
+}
+
+// NewEMA returns an exponential moving average over the given period.
+func NewEMA(period int) *EMA {
+	if period < 1 {
+		period = 1
+	}
+	return &EMA{period: period}
+}
+
+func (i *EMA) Add(rate cbp.Rate) {
+	i.add(rate.Close)
+}
+
+func (i *EMA) add(f float64) {
+	i.count++
+	if i.count <= i.period {
+		i.seed += f
+		i.value = i.seed / float64(i.count)
+		return
+	}
+	k := 2 / float64(i.period+1)
+	i.value = f*k + i.value*(1-k)
+}
+
+func (i *EMA) Value() float64 {
+	return i.value
+}
+
+func (i *EMA) Ready() bool {
+	return i.count >= i.period
+}
+
+// RSI is the Wilder relative strength index of rate closes, from 0 to 100.
+type RSI struct {
+	period           int
+	count            int
+	last             float64
+	gain, loss       float64
+	avgGain, avgLoss float64
+}
+
+// NewRSI returns a relative strength index over the given period.
+func NewRSI(period int) *RSI {
+	if period < 1 {
+		period = 1
+	}
+	return &RSI{period: period}
+}
+
+func (i *RSI) Add(rate cbp.Rate) {
+
+	i.count++
+	if i.count == 1 {
+		i.last = rate.Close
+		return
+	}
+
+	change := rate.Close - i.last
+	i.last = rate.Close
+
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+
+	n := float64(i.period)
+	if i.count <= i.period+1 {
+		i.gain += gain
+		i.loss += loss
+		i.avgGain = i.gain / n
+		i.avgLoss = i.loss / n
+		return
+	}
+
+	i.avgGain = (i.avgGain*(n-1) + gain) / n
+	i.avgLoss = (i.avgLoss*(n-1) + loss) / n
+}
+
+func (i *RSI) Value() float64 {
+	if i.avgLoss == 0 {
+		if i.avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+i.avgGain/i.avgLoss)
+}
+
+func (i *RSI) Ready() bool {
+	return i.count > i.period
+}
+
+// MACD is the moving average convergence divergence of rate closes. Value returns the MACD line.
+type MACD struct {
+	fast, slow, signal *EMA
+}
+
+// NewMACD returns a moving average convergence divergence for the given fast, slow and signal periods.
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{NewEMA(fast), NewEMA(slow), NewEMA(signal)}
+}
+
+func (i *MACD) Add(rate cbp.Rate) {
+	i.fast.Add(rate)
+	i.slow.Add(rate)
+	if i.slow.Ready() {
+		i.signal.add(i.Value())
+	}
+}
+
+func (i *MACD) Value() float64 {
+	return i.fast.Value() - i.slow.Value()
+}
+
+// Signal returns the signal line, the moving average of the MACD line.
+func (i *MACD) Signal() float64 {
+	return i.signal.Value()
+}
+
+// Histogram returns the difference between the MACD and signal lines.
+func (i *MACD) Histogram() float64 {
+	return i.Value() - i.Signal()
+}
+
+func (i *MACD) Ready() bool {
+	return i.slow.Ready() && i.signal.Ready()
+}
+
+// Bollinger are the Bollinger Bands of rate closes. Value returns the middle band.
+type Bollinger struct {
+	w *window
+	k float64
+}
+
+// NewBollinger returns Bollinger Bands over the given period, k standard deviations wide.
+func NewBollinger(period int, k float64) *Bollinger {
+	return &Bollinger{newWindow(period), k}
+}
+
+func (i *Bollinger) Add(rate cbp.Rate) {
+	i.w.add(rate.Close)
+}
+
+func (i *Bollinger) Value() float64 {
+	return i.w.mean()
+}
+
+// Upper returns the upper band.
+func (i *Bollinger) Upper() float64 {
+	return i.w.mean() + i.k*i.w.stddev()
+}
+
+// Lower returns the lower band.
+func (i *Bollinger) Lower() float64 {
+	return i.w.mean() - i.k*i.w.stddev()
+}
+
+func (i *Bollinger) Ready() bool {
+	return i.w.full
+}
+
+// ATR is the Wilder average true range of rates.
+type ATR struct {
+	period int
+	count  int
+	last   float64
+	sum    float64
+	value  float64
+}
+
+// NewATR returns an average true range over the given period.
+func NewATR(period int) *ATR {
+	if period < 1 {
+		period = 1
+	}
+	return &ATR{period: period}
+}
+
+func (i *ATR) Add(rate cbp.Rate) {
+
+	tr := rate.High - rate.Low
+	if i.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(rate.High-i.last), math.Abs(rate.Low-i.last)))
+	}
+	i.last = rate.Close
+	i.count++
+
+	n := float64(i.period)
+	if i.count <= i.period {
+		i.sum += tr
+		i.value = i.sum / float64(i.count)
+		return
+	}
+
+	i.value = (i.value*(n-1) + tr) / n
+}
+
+func (i *ATR) Value() float64 {
+	return i.value
+}
+
+func (i *ATR) Ready() bool {
+	return i.count >= i.period
+}
+
+// VWAP is the volume weighted average typical price of rates, reset at the start of every UTC day.
+type VWAP struct {
+	day          time.Time
+	price, value float64
+	volume       float64
+}
+
+// NewVWAP returns a volume weighted average price.
+func NewVWAP() *VWAP {
+	return new(VWAP)
+}
+
+func (i *VWAP) Add(rate cbp.Rate) {
+
+	day := rate.Time().UTC().Truncate(time.Hour * 24)
+	if !day.Equal(i.day) {
+		i.day = day
+		i.price = 0
+		i.volume = 0
+	}
+
+	typical := (rate.High + rate.Low + rate.Close) / 3
+	i.price += typical * rate.Volume
+	i.volume += rate.Volume
+
+	if i.volume > 0 {
+		i.value = i.price / i.volume
+	} else {
+		i.value = typical
+	}
+}
+
+func (i *VWAP) Value() float64 {
+	return i.value
+}
+
+func (i *VWAP) Ready() bool {
+	return !i.day.IsZero()
+}
@@ -0,0 +1,129 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package indicator
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"testing"
+	"time"
+)
+
+func closes(fs ...float64) []cbp.Rate {
+	var rates []cbp.Rate
+	for i, f := range fs {
+		rates = append(rates, *cbp.NewRate("BTC-USD", cb.HistoricRate{
+			Time:   time.Unix(int64(i*60), 0),
+			Open:   f,
+			High:   f + 1,
+			Low:    f - 1,
+			Close:  f,
+			Volume: 1,
+		}))
+	}
+	return rates
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestIndicators(t *testing.T) {
+
+	sma := NewSMA(3)
+	ema := NewEMA(3)
+	rsi := NewRSI(3)
+	atr := NewATR(3)
+	vwap := NewVWAP()
+	bollinger := NewBollinger(3, 2)
+
+	for i, rate := range closes(1, 2, 3, 4, 5) {
+		for _, indicator := range []Indicator{sma, ema, rsi, atr, vwap, bollinger} {
+			indicator.Add(rate)
+		}
+		if i == 1 && sma.Ready() {
+			t.Error("expected sma not to be ready before its period")
+		}
+	}
+
+	if !near(sma.Value(), 4) {
+		t.Errorf("sma = %f, want 4", sma.Value())
+	}
+
+	// seeded with 2, then 4*.5 + 2*.5 = 3, then 5*.5 + 3*.5 = 4
+	if !near(ema.Value(), 4) {
+		t.Errorf("ema = %f, want 4", ema.Value())
+	}
+
+	if !near(rsi.Value(), 100) {
+		t.Errorf("rsi = %f, want 100", rsi.Value())
+	}
+
+	if !near(atr.Value(), 2) {
+		t.Errorf("atr = %f, want 2", atr.Value())
+	}
+
+	if !near(vwap.Value(), 3) {
+		t.Errorf("vwap = %f, want 3", vwap.Value())
+	}
+
+	if !near(bollinger.Upper()-bollinger.Value(), 2*math.Sqrt(2.0/3)) {
+		t.Errorf("bollinger upper = %f, want %f", bollinger.Upper(), 4+2*math.Sqrt(2.0/3))
+	}
+}
+
+func TestConfirmation(t *testing.T) {
+
+	if _, err := NewConfirmation([]string{"rsi(14) ~ 30"}); err == nil {
+		t.Error("expected an invalid operator error")
+	}
+
+	if _, err := NewConfirmation([]string{"foo(3) < 30"}); err == nil {
+		t.Error("expected an unknown indicator error")
+	}
+
+	c, err := NewConfirmation([]string{"close > sma(3)", "rsi(3) >= 50", "macd_histogram(2, 3, 2) > 0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Warmup() != 5 {
+		t.Errorf("warmup = %d, want 5", c.Warmup())
+	}
+
+	for _, rate := range closes(1, 2, 3) {
+		c.Add(rate)
+	}
+	if c.Confirms() {
+		t.Error("expected no confirmation before every indicator is ready")
+	}
+
+	for _, rate := range closes(4, 6, 9) {
+		c.Add(rate)
+	}
+	if !c.Confirms() {
+		t.Error("expected an accelerating uptrend to confirm")
+	}
+
+	c.Add(closes(1)[0])
+	if c.Confirms() {
+		t.Error("expected a close below the sma not to confirm")
+	}
+}
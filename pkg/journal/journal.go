@@ -0,0 +1,322 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package journal
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/db"
+	"github.com/nelsw/nuchal/pkg/util"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Journal is the state machine of a live trade. Every transition is written as it happens, so that a restarted trade
+// session reattaches to every open trade rather than reconstructing it from fills, and reports match every fill of
+// the trade to its entry. Journals are persisted when pg is not nil.
+type Journal struct {
+	gorm.Model
+	pg *gorm.DB `gorm:"-"`
+
+	// ProductID is the product traded, and Paper is true when the trade was filled by a paper account.
+	ProductID string `gorm:"index"`
+	Paper     bool
+
+	// State is the lifecycle step of the trade.
+	State State `gorm:"index"`
+
+	// ClientOID identifies the entry order before the exchange returns it, and EntryOrderID once it has.
+	ClientOID    string
+	EntryOrderID string
+
+	// Size is the filled base currency size, Entry the average fill price, and Cost the filled value plus fees.
+	Size  string
+	Entry float64
+	Cost  float64
+
+	// Usd is the amount reserved with the risk limits, and ATR the average true range at the entry.
+	Usd float64
+	ATR float64
+
+	// Opened is when the entry order was created.
+	Opened time.Time
+
+	// Goal is the goal price, and Stop the price of the resting stop order with the id StopOrderID.
+	Goal        float64
+	Stop        float64
+	StopOrderID string
+
+	// SellOrderIDs is the comma separated id of every sell order placed for the trade, each stop order and the market
+	// exit, as any of them may have filled.
+	SellOrderIDs string
+
+	// Exit is the price the trade was sold at, and ExitFill the kind of order it was sold with, which decides the fee.
+	Exit     float64
+	ExitFill string
+}
+
+// NewDB returns the database journals are written to.
+func NewDB() (*gorm.DB, error) {
+	return db.NewDB(&Journal{})
+}
+
+// New returns the journal of a new entry in the given product, reserving the given USD amount.
+func New(pg *gorm.DB, productID string, usd, atr float64) *Journal {
+	j := new(Journal)
+	j.pg = pg
+	j.ProductID = productID
+	j.Paper = cbp.IsPaper()
+	j.ClientOID = newClientOID()
+	j.Usd = usd
+	j.ATR = atr
+	j.State = Pending
+	return j
+}
+
+// Save writes the journal.
+func (j *Journal) Save() error {
+	if j.pg == nil {
+		return nil
+	}
+	return j.pg.Save(j).Error
+}
+
+// Renew gives the journal a new client order id for its next entry order, and writes it.
+func (j *Journal) Renew() error {
+	j.ClientOID = newClientOID()
+	return j.Save()
+}
+
+// fire moves the journal to the state the given event leads to, and writes it.
+func (j *Journal) fire(e Event) error {
+	next, err := j.State.Next(e)
+	if err != nil {
+		return err
+	}
+	j.State = next
+	return j.Save()
+}
+
+// Bought records the filled entry order.
+func (j *Journal) Bought(order *cb.Order) error {
+	j.EntryOrderID = order.ID
+	j.Size = order.FilledSize
+	j.Entry = util.Float64(order.ExecutedValue) / util.Float64(order.FilledSize)
+	j.Cost = util.Float64(order.ExecutedValue) + util.Float64(order.FillFees)
+	j.Opened = order.CreatedAt.Time()
+	return j.fire(EntryFilled)
+}
+
+// Rejected records an entry order that failed or never filled.
+func (j *Journal) Rejected() error {
+	return j.fire(EntryRejected)
+}
+
+// Anchored records the stop order resting at the given price, which either places the first stop or raises it.
+func (j *Journal) Anchored(orderID string, stop float64) error {
+	e := StopPlaced
+	if j.StopOrderID != "" {
+		e = StopRaised
+	}
+	j.sellOrder(orderID)
+	j.StopOrderID = orderID
+	j.Stop = stop
+	return j.fire(e)
+}
+
+// Sold records the exit price, the kind of order that filled at it, and the sell order, if any.
+func (j *Journal) Sold(orderID string, exit float64, fill string) error {
+	j.Exit = exit
+	j.ExitFill = fill
+	j.sellOrder(orderID)
+	return j.fire(PositionSold)
+}
+
+// Result returns the realized result of the exited trade, after fees. Market exits pay the taker fee, and every other
+// exit the maker fee of a resting order.
+func (j *Journal) Result() float64 {
+	fee := cbp.Maker()
+	if j.ExitFill == cbp.MarketFill {
+		fee = cbp.Taker()
+	}
+	return j.Exit*util.Float64(j.Size)*(1-fee) - j.Cost
+}
+
+// SellOrders returns the id of every sell order placed for the trade, oldest first.
+func (j *Journal) SellOrders() []string {
+	var ids []string
+	if j.SellOrderIDs != "" {
+		ids = strings.Split(j.SellOrderIDs, ",")
+	}
+	if j.StopOrderID != "" && !contains(ids, j.StopOrderID) {
+		// journaled before every sell order was kept
+		ids = append(ids, j.StopOrderID)
+	}
+	return ids
+}
+
+// sellOrder adds the given order id to the sell orders of the trade.
+func (j *Journal) sellOrder(orderID string) {
+	ids := j.SellOrders()
+	if orderID != "" && !contains(ids, orderID) {
+		ids = append(ids, orderID)
+	}
+	j.SellOrderIDs = strings.Join(ids, ",")
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Recover reconciles the journal with the exchange, as the entry or stop order may have filled while the trade
+// session was down. An entry that can't be found never filled, and an entry still resting on the book is cancelled
+// first, so that it can't fill once nothing tracks it. A stop order that can't be found or is done without filling was
+// cancelled, and is replaced by the next sell. Any other error is returned, as the order may yet be found.
+func (j *Journal) Recover() error {
+
+	switch j.State {
+	case Pending:
+		order, err := cbp.FindOrder("client:" + j.ClientOID)
+		if util.IsNotFound(err) {
+			return j.Rejected()
+		} else if err != nil {
+			return err
+		}
+		if order, err = settle(order); err != nil {
+			return err
+		} else if order == nil || util.Float64(order.FilledSize) == 0 {
+			return j.Rejected()
+		}
+		return j.Bought(order)
+
+	case Anchored, Climbing:
+		order, err := cbp.FindOrder(j.StopOrderID)
+		if err != nil && !util.IsNotFound(err) {
+			return err
+		}
+		if err == nil && order.Status != "done" {
+			return nil
+		}
+		if err == nil && order.DoneReason == "filled" {
+			return j.Sold(order.ID, util.Float64(order.ExecutedValue)/util.Float64(order.FilledSize), cbp.StopFill)
+		}
+		j.StopOrderID = ""
+		return j.fire(StopReleased)
+	}
+
+	return nil
+}
+
+// settle cancels the given order unless it is done, and returns it once the exchange confirms it is done, or nil when
+// the exchange no longer has it, as Coinbase drops cancelled orders that never filled.
+func settle(order *cb.Order) (*cb.Order, error) {
+
+	if done(order) {
+		return order, nil
+	}
+
+	if err := cbp.CancelOrder(order.ID); err != nil {
+		return nil, err
+	}
+
+	order, err := cbp.FindOrder(order.ID)
+	if util.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if !done(order) {
+		return nil, fmt.Errorf("order [%s] is still %s", order.ID, order.Status)
+	}
+	return order, nil
+}
+
+// done returns true if the given order can no longer fill.
+func done(order *cb.Order) bool {
+	return order.Status == "done" || order.Status == "rejected"
+}
+
+// Find returns the journal of every open trade, of paper accounts or not, oldest first and written to the given
+// database.
+func Find(pg *gorm.DB, paper bool) ([]*Journal, error) {
+
+	var open []Journal
+	if err := pg.
+		Where("state IN ? AND paper = ?", OpenStates(), paper).
+		Order("created_at asc").
+		Find(&open).Error; err != nil {
+		return nil, err
+	}
+
+	journals := make([]*Journal, len(open))
+	for i := range open {
+		open[i].pg = pg
+		journals[i] = &open[i]
+	}
+	return journals, nil
+}
+
+// FindExited returns the journal of every trade, of paper accounts or not, that exited since the given time, in the
+// order they exited.
+func FindExited(pg *gorm.DB, paper bool, since time.Time) ([]Journal, error) {
+	var journals []Journal
+	err := pg.
+		Where("state = ? AND paper = ? AND updated_at >= ?", Exited, paper, since).
+		Order("updated_at asc").
+		Find(&journals).Error
+	return journals, err
+}
+
+// GetOpenJournals returns the journal of every live trade that has not exited or failed, oldest first.
+func GetOpenJournals() ([]Journal, error) {
+	pg, err := NewDB()
+	if err != nil {
+		return nil, err
+	}
+	var journals []Journal
+	err = pg.Where("state IN ?", OpenStates()).Order("created_at asc").Find(&journals).Error
+	return journals, err
+}
+
+// GetJournals returns the journal of every live trade, oldest first.
+func GetJournals() ([]Journal, error) {
+	pg, err := NewDB()
+	if err != nil {
+		return nil, err
+	}
+	var journals []Journal
+	err = pg.Order("created_at asc").Find(&journals).Error
+	return journals, err
+}
+
+// newClientOID returns a random version 4 uuid, the client order id format Coinbase Pro requires.
+func newClientOID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
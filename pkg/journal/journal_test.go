@@ -0,0 +1,197 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package journal
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+
+	j := New(nil, "BTC-USD", 100, 2)
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(j.ClientOID) {
+		t.Errorf("expected a version 4 uuid client oid, got %s", j.ClientOID)
+	}
+	if j.ClientOID == New(nil, "BTC-USD", 100, 2).ClientOID {
+		t.Error("expected unique client oids")
+	}
+	if j.State != Pending {
+		t.Errorf("expected a pending journal, got %s", j.State)
+	}
+
+	if err := j.Sold("", 1, cbp.MarketFill); err == nil {
+		t.Error("expected a pending trade not to be sold")
+	}
+
+	opened := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	if err := j.Bought(&cb.Order{
+		ID:            "entry",
+		FilledSize:    "2",
+		ExecutedValue: "100",
+		FillFees:      "0.5",
+		CreatedAt:     cb.Time(opened),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if j.State != Entered || j.Entry != 50 || j.Cost != 100.5 || j.Size != "2" || !j.Opened.Equal(opened) {
+		t.Errorf("unexpected entered journal %+v", j)
+	}
+
+	if err := j.Anchored("stop", 45); err != nil || j.State != Anchored || j.StopOrderID != "stop" || j.Stop != 45 {
+		t.Errorf("unexpected anchored journal %+v, %v", j, err)
+	}
+
+	if err := j.Anchored("higher", 52); err != nil || j.State != Climbing || j.StopOrderID != "higher" {
+		t.Errorf("unexpected climbing journal %+v, %v", j, err)
+	}
+
+	if err := j.Sold("market", 55, cbp.MarketFill); err != nil || j.State != Exited || j.Exit != 55 {
+		t.Errorf("unexpected exited journal %+v, %v", j, err)
+	}
+
+	if ids := j.SellOrders(); len(ids) != 3 || ids[0] != "stop" || ids[1] != "higher" || ids[2] != "market" {
+		t.Errorf("expected every sell order, got %v", ids)
+	}
+	if ids := (&Journal{StopOrderID: "stop"}).SellOrders(); len(ids) != 1 || ids[0] != "stop" {
+		t.Errorf("expected the stop order of a journal without sell orders, got %v", ids)
+	}
+}
+
+func TestJournalRecover(t *testing.T) {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	var rates []cbp.Rate
+	for i, price := range []float64{1, 1.01, .9, .9} {
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    price,
+			High:   price,
+			Open:   price,
+			Close:  price,
+			Volume: 1,
+		}))
+	}
+
+	server := fake.NewServer(100, 0, rates)
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	taker, ok := os.LookupEnv("COINBASE_PRO_TAKER_FEE")
+	_ = os.Setenv("COINBASE_PRO_TAKER_FEE", ".006")
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv("COINBASE_PRO_TAKER_FEE", taker)
+		} else {
+			_ = os.Unsetenv("COINBASE_PRO_TAKER_FEE")
+		}
+	})
+
+	if _, err := cbp.Init("", &[]cbp.Product{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10}
+
+	// an entry which filled while the trade session was down
+	entered := New(nil, "ALGO-USD", 10, 0)
+	order := pattern.NewMarketBuyOrder()
+	order.ClientOID = entered.ClientOID
+	if _, err := cbp.CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+
+	// an entry which never reached the exchange
+	lost := New(nil, "ALGO-USD", 10, 0)
+
+	// an entry which still rests on the book
+	resting := New(nil, "ALGO-USD", 10, 0)
+	limit := pattern.NewPostOnlyBuyOrder(.5, pattern.NewMarketBuyOrder())
+	limit.ClientOID = resting.ClientOID
+	if _, err := cbp.CreateOrder(limit); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stop order which filled while the trade session was down
+	stop, err := cbp.CreateOrder(pattern.NewLimitLossOrder(.95, "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := &Journal{ProductID: "ALGO-USD", State: Anchored, Size: "10", Cost: 10, StopOrderID: stop.ID, Stop: .95}
+
+	for i := 0; i < 12; i++ {
+		server.Advance()
+	}
+
+	for _, j := range []*Journal{entered, lost, resting, stopped} {
+		if err := j.Recover(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entered.State != Entered || entered.Size != "10.000000" || entered.Entry != 1 {
+		t.Errorf("expected the entry to be recovered, got %+v", entered)
+	}
+	if lost.State != Failed {
+		t.Errorf("expected the lost entry to fail, got %s", lost.State)
+	}
+	if resting.State != Failed {
+		t.Errorf("expected the resting entry to fail, got %s", resting.State)
+	} else if orders, err := cbp.GetOrders("ALGO-USD"); err != nil || len(*orders) != 0 {
+		t.Errorf("expected the resting entry to be cancelled, got %v, %v", orders, err)
+	}
+	if stopped.State != Exited || stopped.Exit != .95 || stopped.ExitFill != cbp.StopFill {
+		t.Errorf("expected the stop to have exited, got %s at %f", stopped.State, stopped.Exit)
+	}
+
+	// a stop exit pays the maker fee of its resting order, and a market exit the taker fee
+	if want := .95*10*(1-cbp.Maker()) - stopped.Cost; stopped.Result() != want {
+		t.Errorf("expected a stop exit result of %f, got %f", want, stopped.Result())
+	}
+	market := *stopped
+	if market.ExitFill = cbp.MarketFill; market.Result() != .95*10*(1-.006)-stopped.Cost {
+		t.Errorf("expected a market exit to pay the taker fee, got %f", market.Result())
+	}
+
+	// a stop order which was cancelled, and no longer exists
+	released := &Journal{ProductID: "ALGO-USD", State: Climbing, StopOrderID: "cancelled", Stop: .95}
+	if err := released.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if released.State != Entered || released.StopOrderID != "" {
+		t.Errorf("expected the missing stop to be released, got %s with %s", released.State, released.StopOrderID)
+	}
+
+	// an entry which can't be looked up while the exchange is down
+	cbp.SetExchange(cbp.NewCoinbase("http://127.0.0.1:1", "ws://127.0.0.1:1", "key", "pass", "c2VjcmV0"))
+	unknown := New(nil, "ALGO-USD", 10, 0)
+	if err := unknown.Recover(); err == nil {
+		t.Error("expected an unreachable exchange to fail the recovery")
+	}
+	if unknown.State != Pending {
+		t.Errorf("expected the entry to stay pending, got %s", unknown.State)
+	}
+}
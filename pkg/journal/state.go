@@ -0,0 +1,76 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package journal
+
+import "fmt"
+
+// State is a step of the trade lifecycle.
+//
+//	pending  → entered  → anchored → climbing → exited
+//	        ↘ failed             ↘ exited
+//
+// An entered trade may also exit without a stop order, and a trade whose stop order is cancelled elsewhere returns to
+// entered, to be anchored again.
+type State string
+
+const (
+	Pending  State = "pending"
+	Entered  State = "entered"
+	Anchored State = "anchored"
+	Climbing State = "climbing"
+	Exited   State = "exited"
+	Failed   State = "failed"
+)
+
+// Event is something that happens to a trade, moving it from one state to another.
+type Event string
+
+const (
+	EntryFilled   Event = "entry filled"
+	EntryRejected Event = "entry rejected"
+	StopPlaced    Event = "stop placed"
+	StopRaised    Event = "stop raised"
+	StopReleased  Event = "stop released"
+	PositionSold  Event = "position sold"
+)
+
+var transitions = map[State]map[Event]State{
+	Pending:  {EntryFilled: Entered, EntryRejected: Failed},
+	Entered:  {StopPlaced: Anchored, PositionSold: Exited},
+	Anchored: {StopRaised: Climbing, StopReleased: Entered, PositionSold: Exited},
+	Climbing: {StopRaised: Climbing, StopReleased: Entered, PositionSold: Exited},
+}
+
+// Next returns the state the given event moves the state to, or an error if the event can't happen in the state.
+func (s State) Next(e Event) (State, error) {
+	if next, ok := transitions[s][e]; ok {
+		return next, nil
+	}
+	return s, fmt.Errorf("invalid trade transition, %s when %s", e, s)
+}
+
+// Open returns true until the trade has exited or failed.
+func (s State) Open() bool {
+	return s != Exited && s != Failed
+}
+
+// OpenStates returns every state of a trade that has not exited or failed.
+func OpenStates() []State {
+	return []State{Pending, Entered, Anchored, Climbing}
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package journal
+
+import "testing"
+
+func TestStateNext(t *testing.T) {
+
+	tests := []struct {
+		state State
+		event Event
+		want  State
+		valid bool
+	}{
+		{Pending, EntryFilled, Entered, true},
+		{Pending, EntryRejected, Failed, true},
+		{Pending, StopPlaced, Pending, false},
+		{Entered, StopPlaced, Anchored, true},
+		{Entered, PositionSold, Exited, true},
+		{Entered, StopRaised, Entered, false},
+		{Anchored, StopRaised, Climbing, true},
+		{Anchored, StopReleased, Entered, true},
+		{Anchored, PositionSold, Exited, true},
+		{Climbing, StopRaised, Climbing, true},
+		{Climbing, PositionSold, Exited, true},
+		{Exited, PositionSold, Exited, false},
+		{Failed, EntryFilled, Failed, false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.state.Next(tt.event)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("%s when %s = %s, %v, want %s", tt.event, tt.state, got, err, tt.want)
+		}
+	}
+
+	for _, state := range OpenStates() {
+		if !state.Open() {
+			t.Errorf("expected %s to be open", state)
+		}
+	}
+	if Exited.Open() || Failed.Open() {
+		t.Error("expected exited and failed to be closed")
+	}
+}
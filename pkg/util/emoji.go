@@ -23,6 +23,7 @@ const (
 	Shark   = `🦈`
 	Tuna    = `🐟`
 	Puffer  = `🐡`
+	Octopus = `🐙`
 
 	Trading     = `🎲`
 	TradingUp   = `📈`
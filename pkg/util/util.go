@@ -106,6 +106,12 @@ func IsInsufficientFunds(err error) bool {
 	return err != nil && err.Error() == "Insufficient funds"
 }
 
+// IsNotFound returns true if the error is the Coinbase Pro response for an order or resource that doesn't exist, eg. an
+// order cancelled before it filled.
+func IsNotFound(err error) bool {
+	return err != nil && err.Error() == "NotFound"
+}
+
 func IsZero(s string) bool {
 	return Float64(s) == 0.0
 }
@@ -18,7 +18,18 @@
 
 package test
 
-import "github.com/nelsw/nuchal/pkg/config"
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	"github.com/nelsw/nuchal/pkg/config"
+	"github.com/nelsw/nuchal/test/fake"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
 
 const (
 	size  = 1.0
@@ -32,12 +43,97 @@ const (
 
 var (
 	usd = []string{}
+
+	server *fake.Server
+	once   sync.Once
 )
 
-func Session() *config.Session {
+// Session returns a new session configured against an in-process fake Coinbase Pro server, storing into a SQLite
+// database in a temporary directory removed when the given test ends, along with the environment it sets.
+func Session(t *testing.T) *config.Session {
+
+	once.Do(func() {
+		server = Server()
+	})
+
+	t.Setenv("COINBASE_PRO_KEY", "key")
+	t.Setenv("COINBASE_PRO_PASSPHRASE", "pass")
+	t.Setenv("COINBASE_PRO_SECRET", "c2VjcmV0")
+	t.Setenv("COINBASE_PRO_URL", server.Url())
+	t.Setenv("COINBASE_PRO_WEBSOCKET", server.WebsocketUrl())
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "nuchal.db"))
+
 	session, err := config.NewSession(cfg, dur, usd, size, gain, loss, delta, debug)
 	if err != nil {
 		panic(err)
 	}
 	return session
 }
+
+// Dir changes the working directory to a temporary directory for the rest of the given test, so that the html and
+// results directories written by commands are not left in the package.
+func Dir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Server returns a new fake Coinbase Pro server replaying Rates with a USD balance of 1000.
+func Server() *fake.Server {
+	return fake.NewServer(1000, time.Millisecond*10, Rates())
+}
+
+// Rates returns a deterministic day of one minute rates for a couple of products, from 12:00 to 22:00 UTC.
+// Every 30 minutes the series prints a tweezer bottom; two down candles with matching lows followed by an up candle.
+func Rates() []cbp.Rate {
+
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	var rates []cbp.Rate
+	for _, productID := range []string{"ALGO-USD", "XLM-USD"} {
+		price := 1.0
+		for i := 0; i < 600; i++ {
+
+			t := alpha.Add(time.Minute * time.Duration(i))
+			wave := math.Sin(float64(i)/15) * .01
+
+			var open, closing float64
+			switch i % 30 {
+			case 27, 28:
+				open, closing = price+.004, price
+			case 29:
+				open, closing = price, price+.006
+			default:
+				open, closing = price, price+wave
+			}
+
+			low := math.Min(open, closing) - .001
+			high := math.Max(open, closing) + .001
+			if i%30 == 28 || i%30 == 29 {
+				low = math.Min(open, closing)
+			}
+
+			rates = append(rates, *cbp.NewRate(productID, cb.HistoricRate{
+				Time:   t,
+				Low:    low,
+				High:   high,
+				Open:   open,
+				Close:  closing,
+				Volume: 100,
+			}))
+			price = closing
+		}
+	}
+
+	return rates
+}
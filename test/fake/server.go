@@ -0,0 +1,485 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+// Package fake provides an in-process stand-in for the Coinbase Pro REST and websocket APIs.
+// Recorded rates are replayed as ticker and match messages and orders are filled against a cbp.Paper account, so every
+// command can be driven offline by pointing COINBASE_PRO_URL and COINBASE_PRO_WEBSOCKET at the server.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeLayout is a microsecond precision layout that the go-coinbasepro client is able to parse.
+const timeLayout = "2006-01-02T15:04:05.999999Z"
+
+// Server is an in-process Coinbase Pro stand-in.
+type Server struct {
+	*httptest.Server
+
+	// Paper is the account orders are filled against.
+	Paper *cbp.Paper
+
+	mu          sync.Mutex
+	products    []cb.Product
+	rates       map[string][]cbp.Rate
+	ticks       map[string][]float64
+	cursor      map[string]int
+	subscribers map[chan cb.Message]bool
+	sequence    int
+	interval    time.Duration
+	done        chan bool
+}
+
+// NewServer starts a Server which replays the given rates, one ticker price every interval, with the given USD balance.
+// Each rate is replayed as four ticker prices; open, low or high, high or low, and close.
+func NewServer(usd float64, interval time.Duration, rates []cbp.Rate) *Server {
+
+	s := new(Server)
+	s.Paper = cbp.NewPaper(usd, .005, .005, nil)
+	s.rates = map[string][]cbp.Rate{}
+	s.ticks = map[string][]float64{}
+	s.cursor = map[string]int{}
+	s.subscribers = map[chan cb.Message]bool{}
+	s.interval = interval
+	s.done = make(chan bool)
+
+	for _, rate := range rates {
+		s.rates[rate.ProductId] = append(s.rates[rate.ProductId], rate)
+	}
+
+	for productID, productRates := range s.rates {
+
+		sort.SliceStable(productRates, func(i, j int) bool {
+			return productRates[i].Unix < productRates[j].Unix
+		})
+
+		for _, rate := range productRates {
+			if rate.IsDown() {
+				s.ticks[productID] = append(s.ticks[productID], rate.Open, rate.High, rate.Low, rate.Close)
+			} else {
+				s.ticks[productID] = append(s.ticks[productID], rate.Open, rate.Low, rate.High, rate.Close)
+			}
+		}
+
+		currency := strings.Split(productID, "-")[0]
+		s.products = append(s.products, cb.Product{
+			ID:             productID,
+			BaseCurrency:   currency,
+			QuoteCurrency:  "USD",
+			BaseMinSize:    "0.1",
+			BaseMaxSize:    "100000",
+			QuoteIncrement: "0.0001",
+		})
+	}
+
+	sort.SliceStable(s.products, func(i, j int) bool {
+		return s.products[i].ID < s.products[j].ID
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/time", s.handleTime)
+	mux.HandleFunc("/products", s.handleProducts)
+	mux.HandleFunc("/products/", s.handleProduct)
+	mux.HandleFunc("/accounts", s.handleAccounts)
+	mux.HandleFunc("/fills", s.handleFills)
+	mux.HandleFunc("/orders", s.handleOrders)
+	mux.HandleFunc("/orders/", s.handleOrder)
+	mux.HandleFunc("/ws", s.handleWebsocket)
+
+	s.Server = httptest.NewServer(mux)
+
+	if interval > 0 {
+		go s.replay()
+	}
+
+	return s
+}
+
+// Url returns the REST api url of the server.
+func (s *Server) Url() string {
+	return s.Server.URL
+}
+
+// WebsocketUrl returns the websocket feed url of the server.
+func (s *Server) WebsocketUrl() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http") + "/ws"
+}
+
+// Close stops the replay and shuts the server down.
+func (s *Server) Close() {
+	close(s.done)
+	s.Server.Close()
+}
+
+// Now returns the time of the last recorded rate, or the current time when no rates were given.
+func (s *Server) Now() time.Time {
+	var last int64
+	for _, productRates := range s.rates {
+		if n := len(productRates); n > 0 && productRates[n-1].Unix > last {
+			last = productRates[n-1].Unix
+		}
+	}
+	if last == 0 {
+		return time.Now()
+	}
+	return time.Unix(0, last).Add(time.Minute)
+}
+
+// Advance moves every product replay forward by a single ticker price, filling any open orders the new price crosses.
+func (s *Server) Advance() {
+
+	s.mu.Lock()
+
+	var messages []cb.Message
+	for productID, ticks := range s.ticks {
+		if s.cursor[productID] >= len(ticks)-1 {
+			continue
+		}
+		s.cursor[productID]++
+		s.Paper.Match(productID, s.price(productID))
+		messages = append(messages, s.ticker(productID), s.match(productID))
+	}
+
+	var subscribers []chan cb.Message
+	for subscriber := range s.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+
+	s.mu.Unlock()
+
+	for _, message := range messages {
+		for _, subscriber := range subscribers {
+			select {
+			case subscriber <- message:
+			default:
+			}
+		}
+	}
+}
+
+// Price returns the current replay price of the given product.
+func (s *Server) Price(productID string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.price(productID)
+}
+
+func (s *Server) replay() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Advance()
+		}
+	}
+}
+
+func (s *Server) price(productID string) float64 {
+	ticks := s.ticks[productID]
+	if len(ticks) == 0 {
+		return 0
+	}
+	return ticks[s.cursor[productID]]
+}
+
+// clock returns the time of the rate currently being replayed for the given product.
+func (s *Server) clock(productID string) time.Time {
+	rates := s.rates[productID]
+	if len(rates) == 0 {
+		return time.Now().UTC().Truncate(time.Microsecond)
+	}
+	return rates[s.cursor[productID]/4].Time().UTC()
+}
+
+func (s *Server) ticker(productID string) cb.Message {
+	s.sequence++
+	price := s.format(s.price(productID))
+	return cb.Message{
+		Type:      "ticker",
+		Time:      cb.Time(s.clock(productID)),
+		ProductID: productID,
+		Sequence:  int64(s.sequence),
+		TradeID:   s.sequence,
+		Price:     price,
+		BestBid:   price,
+		BestAsk:   price,
+		Side:      "buy",
+		LastSize:  "1",
+	}
+}
+
+func (s *Server) handleTime(w http.ResponseWriter, _ *http.Request) {
+	now := s.Now()
+	writeJSON(w, cb.ServerTime{ISO: now.UTC().Format(time.RFC3339), Epoch: float64(now.Unix())})
+}
+
+func (s *Server) handleProducts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.products)
+}
+
+// handleProduct serves the /products/{id}/ticker and /products/{id}/candles endpoints.
+func (s *Server) handleProduct(w http.ResponseWriter, r *http.Request) {
+
+	chunks := strings.Split(strings.TrimPrefix(r.URL.Path, "/products/"), "/")
+	if len(chunks) != 2 {
+		writeError(w, http.StatusNotFound, "NotFound")
+		return
+	}
+
+	productID := chunks[0]
+	if _, ok := s.rates[productID]; !ok {
+		writeError(w, http.StatusNotFound, "NotFound")
+		return
+	}
+
+	switch chunks[1] {
+	case "ticker":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		price := s.format(s.price(productID))
+		writeJSON(w, map[string]string{
+			"price": price,
+			"size":  "1",
+			"bid":   price,
+			"ask":   price,
+			"time":  s.clock(productID).Format(timeLayout),
+		})
+	case "candles":
+		s.handleCandles(w, r, productID)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+// handleCandles writes recorded rates in the Coinbase Pro [time, low, high, open, close, volume] format, newest first.
+// Rates are aggregated when the requested granularity is greater than one minute.
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request, productID string) {
+
+	start, _ := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+	end, _ := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+
+	granularity, err := strconv.Atoi(r.URL.Query().Get("granularity"))
+	if err != nil || granularity < 60 {
+		granularity = 60
+	}
+	width := int64(granularity)
+
+	var buckets []cbp.Rate
+	for _, rate := range s.rates[productID] {
+
+		t := rate.Time()
+		if !start.IsZero() && t.Before(start) || !end.IsZero() && t.After(end) {
+			continue
+		}
+
+		bucket := t.Unix() - t.Unix()%width
+		if n := len(buckets); n > 0 && buckets[n-1].HistoricRate.Time.Unix() == bucket {
+			b := &buckets[n-1]
+			if rate.High > b.High {
+				b.High = rate.High
+			}
+			if rate.Low < b.Low {
+				b.Low = rate.Low
+			}
+			b.Close = rate.Close
+			b.Volume += rate.Volume
+			continue
+		}
+
+		aggregate := rate
+		aggregate.HistoricRate.Time = time.Unix(bucket, 0)
+		buckets = append(buckets, aggregate)
+	}
+
+	candles := make([][6]float64, 0, len(buckets))
+	for i := len(buckets) - 1; i >= 0; i-- {
+		b := buckets[i]
+		candles = append(candles, [6]float64{float64(b.HistoricRate.Time.Unix()), b.Low, b.High, b.Open, b.Close, b.Volume})
+	}
+
+	writeJSON(w, candles)
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.Paper.GetAccounts())
+}
+
+func (s *Server) handleFills(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Paper.GetFills(r.URL.Query().Get("product_id"), r.URL.Query().Get("order_id")))
+}
+
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeJSON(w, s.Paper.GetOrders(r.URL.Query().Get("product_id")))
+		return
+	}
+
+	order := new(cb.Order)
+	if err := json.NewDecoder(r.Body).Decode(order); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productID := order.ProductID
+	if _, ok := s.ticks[productID]; !ok {
+		writeError(w, http.StatusBadRequest, "Product not found")
+		return
+	}
+
+	created, err := s.Paper.CreateOrder(order, s.Price(productID))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, created)
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+
+	id := strings.TrimPrefix(r.URL.Path, "/orders/")
+
+	if r.Method == http.MethodDelete {
+		if err := s.Paper.CancelOrder(id); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, []string{id})
+		return
+	}
+
+	order, err := s.Paper.GetOrder(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, order)
+}
+
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+
+	var upgrader ws.Upgrader
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer wsConn.Close()
+
+	messages := make(chan cb.Message, 1024)
+	s.mu.Lock()
+	s.subscribers[messages] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, messages)
+		s.mu.Unlock()
+	}()
+
+	var mu sync.Mutex
+	subscriptions := map[string]bool{}
+	closed := make(chan bool)
+
+	go func() {
+		defer close(closed)
+		for {
+			var message cb.Message
+			if err := wsConn.ReadJSON(&message); err != nil {
+				return
+			}
+			mu.Lock()
+			for _, channel := range message.Channels {
+				for _, productID := range channel.ProductIds {
+					subscriptions[productID] = message.Type == "subscribe"
+				}
+			}
+			for _, productID := range message.ProductIds {
+				subscriptions[productID] = message.Type == "subscribe"
+			}
+			mu.Unlock()
+			messages <- cb.Message{Type: "subscriptions", Channels: message.Channels}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		case message := <-messages:
+			mu.Lock()
+			subscribed := message.Type == "subscriptions" || subscriptions[message.ProductID]
+			mu.Unlock()
+			if !subscribed {
+				continue
+			}
+			if err := wsConn.WriteJSON(message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// match returns a matches channel message of the current replay price, for the ticker message just sent.
+func (s *Server) match(productID string) cb.Message {
+	return cb.Message{
+		Type:      "match",
+		Time:      cb.Time(s.clock(productID)),
+		ProductID: productID,
+		Sequence:  int64(s.sequence),
+		TradeID:   s.sequence,
+		Price:     s.format(s.price(productID)),
+		Size:      "1",
+		Side:      "buy",
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(cb.Error{Message: message})
+}
+
+func (s *Server) format(f float64) string {
+	return fmt.Sprintf("%.4f", f)
+}
@@ -0,0 +1,122 @@
+/*
+ *
+ * Copyright © 2021 Connor Van Elswyk ConnorVanElswyk@gmail.com
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * /
+ */
+
+package fake
+
+import (
+	"github.com/nelsw/nuchal/pkg/cbp"
+	cb "github.com/preichenberger/go-coinbasepro/v2"
+	"testing"
+	"time"
+)
+
+func rates() []cbp.Rate {
+	alpha := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	var rates []cbp.Rate
+	for i := 0; i < 10; i++ {
+		price := 1 + float64(i)/100
+		rates = append(rates, *cbp.NewRate("ALGO-USD", cb.HistoricRate{
+			Time:   alpha.Add(time.Minute * time.Duration(i)),
+			Low:    price - .005,
+			High:   price + .015,
+			Open:   price,
+			Close:  price + .01,
+			Volume: 1,
+		}))
+	}
+	return rates
+}
+
+func TestServer(t *testing.T) {
+
+	server := NewServer(100, 0, rates())
+	defer server.Close()
+
+	cbp.SetExchange(cbp.NewCoinbase(server.Url(), server.WebsocketUrl(), "key", "pass", "c2VjcmV0"))
+	defer cbp.SetExchange(nil)
+
+	now, err := cbp.Init("", &[]cbp.Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !now.Equal(server.Now()) {
+		t.Errorf("expected server time %v, got %v", server.Now(), now)
+	}
+
+	rates, err := cbp.GetHistoricRates("ALGO-USD", time.Unix(0, 0), server.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rates) != 10 {
+		t.Errorf("expected 10 rates, got %d", len(rates))
+	}
+
+	pattern := &cbp.Pattern{ID: "ALGO-USD", Size: 10}
+	order, err := cbp.CreateOrder(pattern.NewMarketBuyOrder())
+	if err != nil {
+		t.Fatal(err)
+	} else if order.Status != "done" {
+		t.Errorf("expected a done order, got %s", order.Status)
+	}
+
+	positions, err := cbp.GetTradingPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := positions["ALGO-USD"]
+	if len(position.GetActiveTrades()) != 1 {
+		t.Errorf("expected 1 active ALGO-USD trade")
+	}
+
+	stop, err := cbp.CreateOrder(pattern.NewLimitLossOrder(1.005, "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := cbp.NewPriceStream("ALGO-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			time.Sleep(time.Millisecond * 50)
+			server.Advance()
+		}
+	}()
+
+	price, err := stream.Price()
+	if err != nil {
+		t.Fatal(err)
+	} else if *price != .995 {
+		t.Errorf("unexpected price %f", *price)
+	}
+
+	time.Sleep(time.Millisecond * 300)
+
+	if order, err := cbp.GetOrder(stop.ID); err != nil {
+		t.Fatal(err)
+	} else if order.Status != "done" {
+		t.Errorf("expected the stop loss order to fill, got %s", order.Status)
+	}
+
+	if _, err := cbp.CreateOrder(&cb.Order{ProductID: "ALGO-USD", Side: "buy", Type: "market", Size: "1000"}); err == nil ||
+		err.Error() != "Insufficient funds" {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+}